@@ -0,0 +1,306 @@
+// Package agents keeps track of the agents flows are accepted from
+package agents
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Protocols agents can be identified by
+const (
+	protocolNetflowV9 = "netflow_v9"
+	protocolIPFIX     = "ipfix"
+	protocolSflow     = "sflow"
+)
+
+// identity identifies an agent by protocol level information
+// (NetFlow v9 source ID, IPFIX observation domain ID or sFlow agent address)
+// optionally combined with the source address of its packets
+type identity struct {
+	protocol string
+	src      string
+	id       string
+}
+
+// Registry maps agent addresses to names. Unknown agents are registered
+// automatically if auto registration is enabled.
+type Registry struct {
+	agents      []config.Agent
+	nameByIP    map[string]string
+	identities  map[identity]net.IP
+	names       map[string]struct{}
+	pending     map[string]struct{}
+	subscribers []func(config.Agent)
+	mu          sync.RWMutex
+
+	auto       *config.AutoRegistration
+	prefixes   []*net.IPNet
+	lookupAddr func(addr string) ([]string, error)
+
+	// registered is the number of agents registered automatically, including pending ones
+	registered int
+	full       bool
+}
+
+// New creates a new Registry containing `agents`. Unknown agents are registered according to `auto`.
+func New(agents []config.Agent, auto *config.AutoRegistration) (*Registry, error) {
+	r := &Registry{
+		nameByIP:   make(map[string]string),
+		identities: make(map[identity]net.IP),
+		names:      make(map[string]struct{}),
+		pending:    make(map[string]struct{}),
+		lookupAddr: net.LookupAddr,
+	}
+
+	for _, a := range agents {
+		if err := r.addIdentities(a); err != nil {
+			return nil, err
+		}
+		r.add(a)
+	}
+
+	if auto == nil || !auto.Enabled {
+		return r, nil
+	}
+
+	r.auto = auto
+	for _, p := range auto.Prefixes {
+		_, pfx, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid auto registration prefix %s", p)
+		}
+		r.prefixes = append(r.prefixes, pfx)
+	}
+
+	return r, nil
+}
+
+// Subscribe registers `f` to be called for every automatically registered agent
+func (r *Registry) Subscribe(f func(config.Agent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscribers = append(r.subscribers, f)
+}
+
+// Name returns the name of agent `ip`. If the agent is unknown it is registered if
+// auto registration permits it. As reverse lookups are done in the background flows
+// of such agents are not accepted until their registration completed.
+func (r *Registry) Name(ip net.IP) (string, bool) {
+	key := ip.String()
+
+	r.mu.RLock()
+	name, ok := r.nameByIP[key]
+	full := r.full
+	r.mu.RUnlock()
+	if ok || !r.permitted(ip) {
+		return name, ok
+	}
+	if full {
+		atomic.AddUint64(&stats.GlobalStats.AgentsRefused, 1)
+		return "", false
+	}
+
+	r.mu.Lock()
+	if name, ok := r.nameByIP[key]; ok {
+		r.mu.Unlock()
+		return name, true
+	}
+	if _, ok := r.pending[key]; ok {
+		r.mu.Unlock()
+		return "", false
+	}
+	if r.auto.MaxAgents > 0 && r.registered >= r.auto.MaxAgents {
+		if !r.full {
+			glog.Warningf("Refusing to register agent %s: %d agents registered automatically already", key, r.registered)
+		}
+		r.full = true
+		r.mu.Unlock()
+		atomic.AddUint64(&stats.GlobalStats.AgentsRefused, 1)
+		return "", false
+	}
+	r.registered++
+	r.pending[key] = struct{}{}
+	r.mu.Unlock()
+
+	if r.auto.ReverseLookup {
+		go r.register(ip, r.lookupName(ip))
+		return "", false
+	}
+
+	return r.register(ip, r.templateName(ip)).Name, true
+}
+
+// ResolveSourceID returns the address of the agent that sent a NetFlow v9 packet
+// with source ID `sourceID` from `src`. If there is none `src` is returned.
+func (r *Registry) ResolveSourceID(src net.IP, sourceID uint32) net.IP {
+	return r.resolve(protocolNetflowV9, src, strconv.FormatUint(uint64(sourceID), 10))
+}
+
+// ResolveDomainID returns the address of the agent that sent an IPFIX message
+// with observation domain ID `domainID` from `src`. If there is none `src` is returned.
+func (r *Registry) ResolveDomainID(src net.IP, domainID uint32) net.IP {
+	return r.resolve(protocolIPFIX, src, strconv.FormatUint(uint64(domainID), 10))
+}
+
+// ResolveSflowAgent returns the address of the agent that sent an sFlow datagram
+// with agent address `agent` from `src`. If there is none `src` is returned.
+func (r *Registry) ResolveSflowAgent(src net.IP, agent net.IP) net.IP {
+	return r.resolve(protocolSflow, src, agent.String())
+}
+
+// resolve looks up an agent by identity. Identities combined with the source address take precedence.
+func (r *Registry) resolve(protocol string, src net.IP, id string) net.IP {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.identities) == 0 {
+		return src
+	}
+
+	if ip, ok := r.identities[identity{protocol: protocol, src: src.String(), id: id}]; ok {
+		return ip
+	}
+	if ip, ok := r.identities[identity{protocol: protocol, id: id}]; ok {
+		return ip
+	}
+	return src
+}
+
+// addIdentities adds the protocol level identities of agent `a`
+func (r *Registry) addIdentities(a config.Agent) error {
+	ip := net.ParseIP(a.IPAddress)
+	if ip == nil {
+		if a.SourceID == nil && a.ObservationDomainID == nil && a.SflowAgentAddress == "" {
+			return nil
+		}
+		return fmt.Errorf("Invalid IP address of agent %s: %s", a.Name, a.IPAddress)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	src := ""
+	if a.SourceAddress != "" {
+		srcIP := net.ParseIP(a.SourceAddress)
+		if srcIP == nil {
+			return fmt.Errorf("Invalid source address of agent %s: %s", a.Name, a.SourceAddress)
+		}
+		src = srcIP.String()
+	}
+
+	ids := make([]identity, 0)
+	if a.SourceID != nil {
+		ids = append(ids, identity{protocol: protocolNetflowV9, src: src, id: strconv.FormatUint(uint64(*a.SourceID), 10)})
+	}
+	if a.ObservationDomainID != nil {
+		ids = append(ids, identity{protocol: protocolIPFIX, src: src, id: strconv.FormatUint(uint64(*a.ObservationDomainID), 10)})
+	}
+	if a.SflowAgentAddress != "" {
+		agentIP := net.ParseIP(a.SflowAgentAddress)
+		if agentIP == nil {
+			return fmt.Errorf("Invalid sFlow agent address of agent %s: %s", a.Name, a.SflowAgentAddress)
+		}
+		ids = append(ids, identity{protocol: protocolSflow, src: src, id: agentIP.String()})
+	}
+
+	for _, id := range ids {
+		if _, ok := r.identities[id]; ok {
+			return fmt.Errorf("Agent %s: duplicate %s identity %s", a.Name, id.protocol, id.id)
+		}
+		r.identities[id] = ip
+	}
+
+	return nil
+}
+
+// Agents returns all known agents
+func (r *Registry) Agents() []config.Agent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	agents := make([]config.Agent, len(r.agents))
+	copy(agents, r.agents)
+	return agents
+}
+
+// permitted checks if agent `ip` may be registered automatically
+func (r *Registry) permitted(ip net.IP) bool {
+	if r.auto == nil {
+		return false
+	}
+	if len(r.prefixes) == 0 {
+		return true
+	}
+
+	for _, pfx := range r.prefixes {
+		if pfx.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// register adds agent `ip` named `name` and notifies subscribers
+func (r *Registry) register(ip net.IP, name string) config.Agent {
+	r.mu.Lock()
+	if _, ok := r.names[name]; ok || name == "" {
+		name = ip.String()
+	}
+
+	a := config.Agent{
+		Name:          name,
+		IPAddress:     ip.String(),
+		SNMPCommunity: r.auto.SNMPCommunity,
+		SampleRate:    r.auto.SampleRate,
+	}
+	r.add(a)
+	delete(r.pending, ip.String())
+	subscribers := r.subscribers
+	r.mu.Unlock()
+
+	atomic.AddUint64(&stats.GlobalStats.AgentsRegistered, 1)
+	glog.Infof("Registered agent %s (%s)", a.Name, a.IPAddress)
+
+	for _, f := range subscribers {
+		f(a)
+	}
+
+	return a
+}
+
+func (r *Registry) add(a config.Agent) {
+	key := a.IPAddress
+	if ip := net.ParseIP(a.IPAddress); ip != nil {
+		key = ip.String()
+	}
+
+	r.agents = append(r.agents, a)
+	r.nameByIP[key] = a.Name
+	r.names[a.Name] = struct{}{}
+}
+
+// lookupName names agent `ip` after its PTR record. The name template is used if there is none.
+func (r *Registry) lookupName(ip net.IP) string {
+	names, err := r.lookupAddr(ip.String())
+	if err != nil || len(names) == 0 {
+		glog.Infof("Reverse lookup of agent %s failed: %v", ip.String(), err)
+		return r.templateName(ip)
+	}
+
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// templateName names agent `ip` using the name template
+func (r *Registry) templateName(ip net.IP) string {
+	return strings.Replace(r.auto.NameTemplate, "{ip}", ip.String(), -1)
+}
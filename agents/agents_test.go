@@ -0,0 +1,194 @@
+package agents
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAgents = []config.Agent{
+	{Name: "rtr01", IPAddress: "192.0.2.1"},
+	{Name: "rtr02", IPAddress: "2001:0db8::1"},
+}
+
+func TestStatic(t *testing.T) {
+	r, err := New(testAgents, &config.AutoRegistration{})
+	assert.Nil(t, err)
+
+	name, ok := r.Name(net.IP{192, 0, 2, 1})
+	assert.True(t, ok)
+	assert.Equal(t, "rtr01", name)
+
+	name, ok = r.Name(net.ParseIP("192.0.2.1"))
+	assert.True(t, ok)
+	assert.Equal(t, "rtr01", name)
+
+	name, ok = r.Name(net.ParseIP("2001:db8::1"))
+	assert.True(t, ok)
+	assert.Equal(t, "rtr02", name)
+
+	_, ok = r.Name(net.IP{192, 0, 2, 2})
+	assert.False(t, ok)
+	assert.Equal(t, 2, len(r.Agents()))
+}
+
+func TestAutoRegistration(t *testing.T) {
+	r, err := New(testAgents, &config.AutoRegistration{
+		Enabled:       true,
+		Prefixes:      []string{"198.51.100.0/24"},
+		NameTemplate:  "auto-{ip}",
+		SNMPCommunity: "secret",
+		SampleRate:    1000,
+	})
+	assert.Nil(t, err)
+
+	registered := make([]config.Agent, 0)
+	r.Subscribe(func(a config.Agent) {
+		registered = append(registered, a)
+	})
+
+	_, ok := r.Name(net.IP{192, 0, 2, 2})
+	assert.False(t, ok)
+
+	name, ok := r.Name(net.IP{198, 51, 100, 1})
+	assert.True(t, ok)
+	assert.Equal(t, "auto-198.51.100.1", name)
+
+	name, ok = r.Name(net.IP{198, 51, 100, 1})
+	assert.True(t, ok)
+	assert.Equal(t, "auto-198.51.100.1", name)
+
+	assert.Equal(t, []config.Agent{
+		{Name: "auto-198.51.100.1", IPAddress: "198.51.100.1", SNMPCommunity: "secret", SampleRate: 1000},
+	}, registered)
+	assert.Equal(t, 3, len(r.Agents()))
+}
+
+func TestAutoRegistrationReverseLookup(t *testing.T) {
+	r, err := New(nil, &config.AutoRegistration{
+		Enabled:       true,
+		ReverseLookup: true,
+		NameTemplate:  "{ip}",
+	})
+	assert.Nil(t, err)
+	r.lookupAddr = func(addr string) ([]string, error) {
+		switch addr {
+		case "192.0.2.1", "192.0.2.2":
+			return []string{"rtr01.example.com."}, nil
+		}
+		return nil, fmt.Errorf("NXDOMAIN")
+	}
+
+	done := make(chan config.Agent, 3)
+	r.Subscribe(func(a config.Agent) {
+		done <- a
+	})
+
+	for _, ip := range []net.IP{{192, 0, 2, 1}, {192, 0, 2, 2}, {192, 0, 2, 3}} {
+		// Flows are not accepted until the reverse lookup completed
+		_, ok := r.Name(ip)
+		assert.False(t, ok)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Agent %s was not registered", ip)
+		}
+	}
+
+	tests := map[string]string{
+		"192.0.2.1": "rtr01.example.com",
+		// Names are unique
+		"192.0.2.2": "192.0.2.2",
+		// Name template is used if there is no PTR record
+		"192.0.2.3": "192.0.2.3",
+	}
+	for ip, expected := range tests {
+		name, ok := r.Name(net.ParseIP(ip))
+		assert.True(t, ok)
+		assert.Equal(t, expected, name)
+	}
+}
+
+func TestAutoRegistrationMaxAgents(t *testing.T) {
+	r, err := New(testAgents, &config.AutoRegistration{
+		Enabled:      true,
+		MaxAgents:    2,
+		NameTemplate: "{ip}",
+	})
+	assert.Nil(t, err)
+
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+		name, ok := r.Name(net.ParseIP(ip))
+		assert.True(t, ok)
+		assert.Equal(t, ip, name)
+	}
+
+	_, ok := r.Name(net.ParseIP("198.51.100.3"))
+	assert.False(t, ok)
+
+	// Registered and static agents are still accepted
+	name, ok := r.Name(net.ParseIP("198.51.100.1"))
+	assert.True(t, ok)
+	assert.Equal(t, "198.51.100.1", name)
+	_, ok = r.Name(net.IP{192, 0, 2, 1})
+	assert.True(t, ok)
+	assert.Equal(t, 4, len(r.Agents()))
+}
+
+func TestInvalidPrefix(t *testing.T) {
+	_, err := New(nil, &config.AutoRegistration{
+		Enabled:  true,
+		Prefixes: []string{"198.51.100.0/33"},
+	})
+	assert.NotNil(t, err)
+}
+
+func uint32Ptr(x uint32) *uint32 {
+	return &x
+}
+
+func TestResolve(t *testing.T) {
+	r, err := New([]config.Agent{
+		{Name: "rtr01", IPAddress: "192.0.2.1", SourceID: uint32Ptr(1), ObservationDomainID: uint32Ptr(100)},
+		{Name: "rtr02", IPAddress: "192.0.2.2", SourceID: uint32Ptr(1), SourceAddress: "198.51.100.1"},
+		{Name: "rtr03", IPAddress: "192.0.2.3", SflowAgentAddress: "10.0.0.3"},
+		{Name: "rtr04", IPAddress: "192.0.2.4"},
+	}, nil)
+	assert.Nil(t, err)
+
+	nat := net.IP{198, 51, 100, 1}
+	other := net.IP{198, 51, 100, 2}
+
+	// Identities combined with the source address take precedence
+	assert.Equal(t, net.IP{192, 0, 2, 2}, r.ResolveSourceID(nat, 1))
+	assert.Equal(t, net.IP{192, 0, 2, 1}, r.ResolveSourceID(other, 1))
+	assert.Equal(t, other, r.ResolveSourceID(other, 2))
+
+	assert.Equal(t, net.IP{192, 0, 2, 1}, r.ResolveDomainID(nat, 100))
+	assert.Equal(t, nat, r.ResolveDomainID(nat, 1))
+
+	assert.Equal(t, net.IP{192, 0, 2, 3}, r.ResolveSflowAgent(nat, net.IP{10, 0, 0, 3}))
+	assert.Equal(t, nat, r.ResolveSflowAgent(nat, net.IP{10, 0, 0, 4}))
+
+	name, ok := r.Name(r.ResolveSflowAgent(nat, net.IP{10, 0, 0, 3}))
+	assert.True(t, ok)
+	assert.Equal(t, "rtr03", name)
+}
+
+func TestResolveErrors(t *testing.T) {
+	_, err := New([]config.Agent{
+		{Name: "rtr01", IPAddress: "192.0.2.1", SourceID: uint32Ptr(1)},
+		{Name: "rtr02", IPAddress: "192.0.2.2", SourceID: uint32Ptr(1)},
+	}, nil)
+	assert.NotNil(t, err)
+
+	_, err = New([]config.Agent{
+		{Name: "rtr01", IPAddress: "192.0.2.1", SflowAgentAddress: "foo"},
+	}, nil)
+	assert.NotNil(t, err)
+}
@@ -13,93 +13,114 @@
 package annotation
 
 import (
-	"context"
 	"sync/atomic"
+	"time"
 
-	"github.com/bio-routing/tflow2/annotation/bird"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/shedding"
 	"github.com/bio-routing/tflow2/stats"
-
-	"github.com/golang/glog"
-	"google.golang.org/grpc"
 )
 
-// Annotator represents an flow annotator
-type Annotator struct {
+// Layer represents the annotation layer. It passes batches of flows through the configured annotators.
+type Layer struct {
 	inputs        []chan *netflow.Flow
-	output        chan *netflow.Flow
+	output        *queue.Queue
 	numWorkers    int
-	bgpAugment    bool
-	birdAnnotator *bird.Annotator
-	debug         int
+	batchSize     int
+	flushInterval time.Duration
+	annotators    []*namedAnnotator
+	sampler       *shedding.Sampler
 	cfg           *config.Config
 }
 
-// New creates a new `Annotator` instance
-func New(inputs []chan *netflow.Flow, output chan *netflow.Flow, numWorkers int, cfg *config.Config) *Annotator {
-	a := &Annotator{
+// New creates a new `Layer` instance with the annotators configured in `cfg`
+func New(inputs []chan *netflow.Flow, output *queue.Queue, numWorkers int, cfg *config.Config) (*Layer, error) {
+	annotators, err := newAnnotators(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Layer{
 		inputs:     inputs,
 		output:     output,
 		numWorkers: numWorkers,
+		batchSize:  1,
+		annotators: annotators,
+		sampler:    shedding.New(cfg),
 		cfg:        cfg,
 	}
-	if cfg.BGPAugmentation.Enabled {
-		a.birdAnnotator = bird.NewAnnotator(cfg.BGPAugmentation.BIRDSocket, cfg.BGPAugmentation.BIRD6Socket, cfg.Debug)
+	if cfg.Annotation != nil {
+		a.batchSize = cfg.Annotation.BatchSize
+		a.flushInterval = time.Duration(cfg.Annotation.FlushInterval) * time.Millisecond
 	}
+
 	a.Init()
-	return a
+	return a, nil
 }
 
 // Init get's the annotation layer started, receives flows, annotates them, and carries them
 // further to the database module
-func (a *Annotator) Init() {
+func (a *Layer) Init() {
 	for _, ch := range a.inputs {
 		for i := 0; i < a.numWorkers; i++ {
 			go func(ch chan *netflow.Flow) {
-				clients := make([]netflow.AnnotatorClient, 0)
-				for _, an := range a.cfg.Annotators {
-					var opts []grpc.DialOption
-					opts = append(opts, grpc.WithInsecure())
-					glog.Infof("Connecting to annotator %s at %s", an.Name, an.Target)
-					conn, err := grpc.Dial(an.Target, opts...)
-					if err != nil {
-						glog.Errorf("Failed to dial: %v", err)
-					}
-
-					clients = append(clients, netflow.NewAnnotatorClient(conn))
-				}
-
+				batch := make([]*netflow.Flow, 0, a.batchSize)
 				for {
-					// Read flow from netflow/IPFIX module
-					fl := <-ch
-
-					// Align timestamp on `aggrTime` raster
-					fl.Timestamp = fl.Timestamp - (fl.Timestamp % a.cfg.AggregationPeriod)
-
-					// Update global statstics
-					atomic.AddUint64(&stats.GlobalStats.FlowBytes, fl.Size)
-					atomic.AddUint64(&stats.GlobalStats.FlowPackets, uint64(fl.Packets))
-
-					// Send flow to external annotators
-					for _, c := range clients {
-						tmpFlow, err := c.Annotate(context.Background(), fl)
-						if err != nil {
-							glog.Errorf("Unable to annotate")
-							continue
-						}
-						fl = tmpFlow
-					}
+					// Read flows from netflow/IPFIX module
+					batch = a.readBatch(ch, batch[:0])
 
-					// Annotate flows with ASN and Prefix information from local BIRD (bird.nic.cz) instance
-					if a.bgpAugment {
-						a.birdAnnotator.Augment(fl)
+					// Pass flows through the annotators in configured order
+					for _, an := range a.annotators {
+						an.annotate(batch)
 					}
 
-					// Send flow over to database module
-					a.output <- fl
+					// Send flows over to database module
+					for _, fl := range batch {
+						a.output.Put(fl)
+					}
 				}
 			}(ch)
 		}
 	}
 }
+
+// readBatch appends flows from `ch` to `batch` until the batch is full or the flush interval
+// passed after the first flow
+func (a *Layer) readBatch(ch chan *netflow.Flow, batch []*netflow.Flow) []*netflow.Flow {
+	batch = a.admit(batch, <-ch)
+	if a.batchSize <= 1 {
+		return batch
+	}
+
+	timer := time.NewTimer(a.flushInterval)
+	defer timer.Stop()
+
+	for len(batch) < a.batchSize {
+		select {
+		case fl := <-ch:
+			batch = a.admit(batch, fl)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// admit prepares `fl` for annotation and appends it to `batch` unless it is shed
+func (a *Layer) admit(batch []*netflow.Flow, fl *netflow.Flow) []*netflow.Flow {
+	// Align timestamp on `aggrTime` raster
+	fl.Timestamp = fl.Timestamp - (fl.Timestamp % a.cfg.AggregationPeriod)
+
+	// Update global statstics
+	atomic.AddUint64(&stats.GlobalStats.FlowBytes, fl.Size)
+	atomic.AddUint64(&stats.GlobalStats.FlowPackets, uint64(fl.Packets))
+
+	// Shed load if the pipeline is overloaded
+	if !a.sampler.Sample(fl) {
+		return batch
+	}
+
+	return append(batch, fl)
+}
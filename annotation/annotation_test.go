@@ -16,20 +16,23 @@ import (
 
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/queue"
 )
 
 func TestTimestampAggr(t *testing.T) {
-	outCh := make(chan *netflow.Flow)
+	outQ := queue.New("annotation", 0, queue.PolicyBlock)
 	nWorkers := 1
 
 	inCh := make([]chan *netflow.Flow, 0)
 	inCh = append(inCh, make(chan *netflow.Flow))
 
-	a := New(inCh, outCh, nWorkers, &config.Config{
+	_, err := New(inCh, outQ, nWorkers, &config.Config{
 		AggregationPeriod: 60,
 		BGPAugmentation:   &config.BGPAugment{},
 	})
-	a.Init()
+	if err != nil {
+		t.Fatalf("Unable to create annotation layer: %v", err)
+	}
 
 	testData := []struct {
 		ts   int64
@@ -51,7 +54,7 @@ func TestTimestampAggr(t *testing.T) {
 		}
 
 		inCh[0] <- fl
-		fl = <-outCh
+		fl = <-outQ.C
 		if fl.Timestamp != test.want {
 			t.Errorf("Input: %d, Got: %d, Expected: %d, ", test.ts, fl.Timestamp, test.want)
 		}
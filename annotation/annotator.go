@@ -0,0 +1,183 @@
+package annotation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/annotation/bgp"
+	"github.com/bio-routing/tflow2/annotation/bird"
+	"github.com/bio-routing/tflow2/annotation/geoip"
+	"github.com/bio-routing/tflow2/annotation/mrt"
+	"github.com/bio-routing/tflow2/annotation/static"
+	"github.com/bio-routing/tflow2/annotation/tag"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Annotator adds meta data to flows
+type Annotator interface {
+	// Annotate adds meta data to flow `fl` in place
+	Annotate(ctx context.Context, fl *netflow.Flow) error
+}
+
+// BatchAnnotator is implemented by annotators that annotate multiple flows at once
+type BatchAnnotator interface {
+	Annotator
+
+	// AnnotateBatch adds meta data to flows `flows` in place
+	AnnotateBatch(ctx context.Context, flows []*netflow.Flow) error
+}
+
+// Factory creates an annotator from its configuration `acfg`. `cfg` is the global configuration.
+type Factory func(acfg config.Annotator, cfg *config.Config) (Annotator, error)
+
+var (
+	factories   = make(map[string]Factory)
+	factoriesMu sync.RWMutex
+)
+
+func init() {
+	RegisterType("grpc", newGRPCAnnotator)
+	RegisterType("bird", func(acfg config.Annotator, cfg *config.Config) (Annotator, error) {
+		return bird.NewAnnotator(acfg, cfg.Agents, cfg.Debug)
+	})
+	RegisterType("static", func(acfg config.Annotator, cfg *config.Config) (Annotator, error) {
+		return static.New(acfg.Files, time.Duration(acfg.ReloadInterval)*time.Millisecond)
+	})
+	RegisterType("mrt", func(acfg config.Annotator, cfg *config.Config) (Annotator, error) {
+		return mrt.NewAnnotator(acfg.Directory, time.Duration(acfg.ReloadInterval)*time.Millisecond)
+	})
+	RegisterType("bgp", func(acfg config.Annotator, cfg *config.Config) (Annotator, error) {
+		return bgp.NewSpeaker(acfg, cfg.Agents)
+	})
+	RegisterType("geoip", func(acfg config.Annotator, cfg *config.Config) (Annotator, error) {
+		return geoip.New(acfg.Files, time.Duration(acfg.ReloadInterval)*time.Millisecond)
+	})
+	RegisterType("tag", func(acfg config.Annotator, cfg *config.Config) (Annotator, error) {
+		return tag.New(cfg.TagGroups, cfg.Agents)
+	})
+}
+
+// RegisterType makes annotators of type `typ` available to the annotator configuration
+func RegisterType(typ string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[typ]; ok {
+		panic(fmt.Sprintf("Annotator type %s registered twice", typ))
+	}
+	factories[typ] = f
+}
+
+// namedAnnotator is an annotator with the name it is configured with. Calls are bounded by a
+// timeout and bypassed while the annotator is unhealthy.
+type namedAnnotator struct {
+	Annotator
+	name    string
+	timeout time.Duration
+	breaker *breaker
+	stats   *stats.AnnotatorStats
+}
+
+// newAnnotators creates the annotators configured in `cfg` in configured order
+func newAnnotators(cfg *config.Config) ([]*namedAnnotator, error) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	annotators := make([]*namedAnnotator, 0, len(cfg.Annotators))
+	for _, acfg := range cfg.Annotators {
+		f, ok := factories[acfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("Unknown type %q of annotator %s", acfg.Type, acfg.Name)
+		}
+
+		a, err := f(acfg, cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to create annotator %s", acfg.Name)
+		}
+
+		na := &namedAnnotator{
+			Annotator: a,
+			name:      acfg.Name,
+			timeout:   time.Duration(acfg.Timeout) * time.Millisecond,
+			stats:     stats.NewAnnotatorStats(acfg.Name),
+		}
+		if acfg.FailureThreshold > 0 {
+			na.breaker = newBreaker(acfg.FailureThreshold, time.Duration(acfg.ProbeInterval)*time.Millisecond)
+		}
+		annotators = append(annotators, na)
+	}
+
+	return annotators, nil
+}
+
+// annotate passes `flows` through the annotator. Flows that can not be annotated are passed on unchanged.
+func (a *namedAnnotator) annotate(flows []*netflow.Flow) {
+	if len(flows) == 0 {
+		return
+	}
+
+	if b, ok := a.Annotator.(BatchAnnotator); ok {
+		a.call(len(flows), func(ctx context.Context) error {
+			return b.AnnotateBatch(ctx, flows)
+		})
+		return
+	}
+
+	for _, fl := range flows {
+		a.call(1, func(ctx context.Context) error {
+			return a.Annotate(ctx, fl)
+		})
+	}
+}
+
+// call calls `f` annotating `n` flows unless the annotator is bypassed
+func (a *namedAnnotator) call(n int, f func(ctx context.Context) error) {
+	probe := false
+	if a.breaker != nil {
+		var allowed bool
+		allowed, probe = a.breaker.allow()
+		if !allowed {
+			atomic.AddUint64(&a.stats.Bypassed, uint64(n))
+			return
+		}
+	}
+
+	ctx := context.Background()
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := f(ctx)
+	atomic.AddUint64(&a.stats.LatencySum, uint64(time.Since(start)/time.Microsecond))
+	atomic.AddUint64(&a.stats.Calls, 1)
+
+	if err != nil {
+		atomic.AddUint64(&a.stats.Errors, 1)
+		if ctx.Err() == context.DeadlineExceeded {
+			atomic.AddUint64(&a.stats.Timeouts, 1)
+		}
+		glog.Errorf("Unable to annotate flows with %s: %v", a.name, err)
+	}
+
+	if a.breaker == nil || !a.breaker.record(err, probe) {
+		return
+	}
+
+	if a.breaker.isOpen() {
+		glog.Warningf("Annotator %s is unhealthy. Bypassing it.", a.name)
+		atomic.StoreUint64(&a.stats.CircuitOpen, 1)
+		return
+	}
+	glog.Infof("Annotator %s recovered", a.name)
+	atomic.StoreUint64(&a.stats.CircuitOpen, 0)
+}
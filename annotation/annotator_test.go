@@ -0,0 +1,105 @@
+package annotation
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+// asAnnotator sets the source AS of flows
+type asAnnotator struct {
+	as  uint32
+	err error
+}
+
+func (a *asAnnotator) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	if a.err != nil {
+		return a.err
+	}
+	fl.SrcAs = a.as
+	return nil
+}
+
+// hangingAnnotator blocks until the context of a call is done
+type hangingAnnotator struct{}
+
+func (a *hangingAnnotator) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func init() {
+	RegisterType("test-as", func(acfg config.Annotator, cfg *config.Config) (Annotator, error) {
+		switch acfg.Target {
+		case "fail":
+			return &asAnnotator{err: fmt.Errorf("failed")}, nil
+		case "invalid":
+			return nil, fmt.Errorf("invalid")
+		}
+
+		var as uint32
+		fmt.Sscanf(acfg.Target, "%d", &as)
+		return &asAnnotator{as: as}, nil
+	})
+}
+
+func TestAnnotatorOrder(t *testing.T) {
+	inCh := make(chan *netflow.Flow)
+	outQ := queue.New("annotation", 0, queue.PolicyBlock)
+
+	_, err := New([]chan *netflow.Flow{inCh}, outQ, 1, &config.Config{
+		AggregationPeriod: 60,
+		Annotators: []config.Annotator{
+			{Name: "first", Type: "test-as", Target: "100"},
+			{Name: "second", Type: "test-as", Target: "200"},
+			{Name: "broken", Type: "test-as", Target: "fail"},
+		},
+	})
+	assert.Nil(t, err)
+
+	inCh <- &netflow.Flow{Timestamp: 1000}
+	fl := <-outQ.C
+	assert.Equal(t, uint32(200), fl.SrcAs)
+}
+
+func TestAnnotatorErrors(t *testing.T) {
+	tests := []config.Annotator{
+		{Name: "unknown", Type: "foo"},
+		{Name: "invalid", Type: "test-as", Target: "invalid"},
+	}
+
+	for _, test := range tests {
+		_, err := New(nil, nil, 1, &config.Config{
+			Annotators: []config.Annotator{test},
+		})
+		assert.NotNilf(t, err, "Annotator %s", test.Name)
+	}
+}
+
+func TestAnnotatorTimeout(t *testing.T) {
+	a := &namedAnnotator{
+		Annotator: &hangingAnnotator{},
+		name:      "hanging",
+		timeout:   10 * time.Millisecond,
+		breaker:   newBreaker(2, time.Hour),
+		stats:     stats.NewAnnotatorStats("hanging"),
+	}
+
+	// The annotator is bypassed after two timeouts
+	for i := 0; i < 3; i++ {
+		a.annotate([]*netflow.Flow{{}, {}})
+	}
+
+	assert.Equal(t, uint64(2), a.stats.Calls)
+	assert.Equal(t, uint64(2), a.stats.Timeouts)
+	assert.Equal(t, uint64(2), a.stats.Errors)
+	assert.Equal(t, uint64(4), a.stats.Bypassed)
+	assert.Equal(t, uint64(1), a.stats.CircuitOpen)
+}
@@ -0,0 +1,295 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Message header and types (RFC 4271)
+const (
+	markerLen     = 16
+	headerLen     = 19
+	maxMessageLen = 4096
+
+	msgTypeOpen         = 1
+	msgTypeUpdate       = 2
+	msgTypeNotification = 3
+	msgTypeKeepalive    = 4
+)
+
+// OPEN message
+const (
+	version = 4
+
+	optParamCapabilities = 2
+	capMultiprotocol     = 1
+	capAS4               = 65
+
+	afiIPv4     = 1
+	afiIPv6     = 2
+	safiUnicast = 1
+
+	// asTrans is sent in place of 4 byte AS numbers in the My AS field (RFC 6793)
+	asTrans = 23456
+)
+
+// NOTIFICATION error codes and subcodes
+const (
+	errCodeOpen        = 2
+	errCodeUpdate      = 3
+	errCodeHoldTimer   = 4
+	errCodeFSM         = 5
+	errCodeCease       = 6
+	errSubcodeHoldTime = 6
+)
+
+// open is a decoded OPEN message
+type open struct {
+	as       uint32
+	holdTime uint16
+	routerID net.IP
+
+	// as4 is set if the peer supports 4 byte AS numbers
+	as4 bool
+}
+
+// update is a decoded UPDATE message
+type update struct {
+	withdrawn []*net.IPNet
+	path      *Path
+	nlri      []*net.IPNet
+}
+
+// readMessage reads a message from `r` and returns its type and body
+func readMessage(r io.Reader) (uint8, []byte, error) {
+	hdr := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, nil, err
+	}
+
+	for _, b := range hdr[:markerLen] {
+		if b != 0xff {
+			return 0, nil, fmt.Errorf("Invalid marker")
+		}
+	}
+
+	length := int(binary.BigEndian.Uint16(hdr[16:18]))
+	if length < headerLen || length > maxMessageLen {
+		return 0, nil, fmt.Errorf("Invalid message length %d", length)
+	}
+
+	body := make([]byte, length-headerLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return hdr[18], body, nil
+}
+
+// encodeMessage encodes a message of type `typ` with body `body`
+func encodeMessage(typ uint8, body []byte) []byte {
+	b := make([]byte, headerLen, headerLen+len(body))
+	for i := 0; i < markerLen; i++ {
+		b[i] = 0xff
+	}
+	binary.BigEndian.PutUint16(b[16:18], uint16(headerLen+len(body)))
+	b[18] = typ
+	return append(b, body...)
+}
+
+// encodeOpen encodes an OPEN message announcing IPv4 and IPv6 unicast and 4 byte AS numbers
+func encodeOpen(as uint32, holdTime uint16, routerID net.IP) []byte {
+	caps := []byte{
+		capMultiprotocol, 4, 0, afiIPv4, 0, safiUnicast,
+		capMultiprotocol, 4, 0, afiIPv6, 0, safiUnicast,
+		capAS4, 4, 0, 0, 0, 0,
+	}
+	binary.BigEndian.PutUint32(caps[len(caps)-4:], as)
+
+	myAS := uint16(asTrans)
+	if as <= 0xffff {
+		myAS = uint16(as)
+	}
+
+	b := make([]byte, 10, 12+len(caps))
+	b[0] = version
+	binary.BigEndian.PutUint16(b[1:3], myAS)
+	binary.BigEndian.PutUint16(b[3:5], holdTime)
+	copy(b[5:9], routerID.To4())
+	b[9] = byte(2 + len(caps))
+	b = append(b, optParamCapabilities, byte(len(caps)))
+	b = append(b, caps...)
+
+	return encodeMessage(msgTypeOpen, b)
+}
+
+// decodeOpen decodes the body of an OPEN message
+func decodeOpen(b []byte) (*open, error) {
+	if len(b) < 10 {
+		return nil, fmt.Errorf("Short OPEN message")
+	}
+	if b[0] != version {
+		return nil, fmt.Errorf("Unsupported version %d", b[0])
+	}
+
+	o := &open{
+		as:       uint32(binary.BigEndian.Uint16(b[1:3])),
+		holdTime: binary.BigEndian.Uint16(b[3:5]),
+		routerID: net.IP(append([]byte{}, b[5:9]...)),
+	}
+
+	params := b[10:]
+	if len(params) != int(b[9]) {
+		return nil, fmt.Errorf("Invalid optional parameters length %d", b[9])
+	}
+
+	for len(params) > 0 {
+		if len(params) < 2 || len(params) < 2+int(params[1]) {
+			return nil, fmt.Errorf("Short optional parameter")
+		}
+		typ, value := params[0], params[2:2+int(params[1])]
+		params = params[2+int(params[1]):]
+
+		if typ != optParamCapabilities {
+			continue
+		}
+
+		for len(value) > 0 {
+			if len(value) < 2 || len(value) < 2+int(value[1]) {
+				return nil, fmt.Errorf("Short capability")
+			}
+			code, capValue := value[0], value[2:2+int(value[1])]
+			value = value[2+int(value[1]):]
+
+			if code == capAS4 && len(capValue) == 4 {
+				o.as4 = true
+				o.as = binary.BigEndian.Uint32(capValue)
+			}
+		}
+	}
+	return o, nil
+}
+
+// encodeNotification encodes a NOTIFICATION message
+func encodeNotification(code uint8, subcode uint8) []byte {
+	return encodeMessage(msgTypeNotification, []byte{code, subcode})
+}
+
+// decodeUpdate decodes the body of an UPDATE message. Only IPv4 and IPv6 unicast routes are returned.
+func decodeUpdate(b []byte, as4 bool) (*update, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("Short UPDATE message")
+	}
+	withdrawnLen := int(binary.BigEndian.Uint16(b[0:2]))
+	b = b[2:]
+	if len(b) < withdrawnLen+2 {
+		return nil, fmt.Errorf("Short withdrawn routes")
+	}
+
+	u := &update{}
+	var err error
+	if u.withdrawn, err = decodePrefixes(b[:withdrawnLen], net.IPv4len); err != nil {
+		return nil, err
+	}
+	b = b[withdrawnLen:]
+
+	attrLen := int(binary.BigEndian.Uint16(b[0:2]))
+	b = b[2:]
+	if len(b) < attrLen {
+		return nil, fmt.Errorf("Short path attributes")
+	}
+
+	attrs, err := decodeAttributes(b[:attrLen], as4)
+	if err != nil {
+		return nil, err
+	}
+	u.path = attrs.path
+
+	if u.nlri, err = decodePrefixes(b[attrLen:], net.IPv4len); err != nil {
+		return nil, err
+	}
+
+	if len(attrs.mpReach) > 0 {
+		nlri, err := decodeMPReach(attrs.mpReach)
+		if err != nil {
+			return nil, err
+		}
+		u.nlri = append(u.nlri, nlri...)
+	}
+
+	if len(attrs.mpUnreach) > 0 {
+		withdrawn, err := decodeMPUnreach(attrs.mpUnreach)
+		if err != nil {
+			return nil, err
+		}
+		u.withdrawn = append(u.withdrawn, withdrawn...)
+	}
+	return u, nil
+}
+
+// decodeMPReach decodes the unicast prefixes of an MP_REACH_NLRI attribute (RFC 4760)
+func decodeMPReach(b []byte) ([]*net.IPNet, error) {
+	if len(b) < 5 {
+		return nil, fmt.Errorf("Short MP_REACH_NLRI")
+	}
+	afi, safi, nhLen := binary.BigEndian.Uint16(b[0:2]), b[2], int(b[3])
+	if len(b) < 5+nhLen {
+		return nil, fmt.Errorf("Short MP_REACH_NLRI")
+	}
+	afLen := addressLength(afi)
+	if afLen == 0 || safi != safiUnicast {
+		return nil, nil
+	}
+	return decodePrefixes(b[5+nhLen:], afLen)
+}
+
+// decodeMPUnreach decodes the unicast prefixes of an MP_UNREACH_NLRI attribute (RFC 4760)
+func decodeMPUnreach(b []byte) ([]*net.IPNet, error) {
+	if len(b) < 3 {
+		return nil, fmt.Errorf("Short MP_UNREACH_NLRI")
+	}
+	afi, safi := binary.BigEndian.Uint16(b[0:2]), b[2]
+	afLen := addressLength(afi)
+	if afLen == 0 || safi != safiUnicast {
+		return nil, nil
+	}
+	return decodePrefixes(b[3:], afLen)
+}
+
+// addressLength returns the length of addresses of address family `afi`. It returns 0 for
+// unsupported address families.
+func addressLength(afi uint16) int {
+	switch afi {
+	case afiIPv4:
+		return net.IPv4len
+	case afiIPv6:
+		return net.IPv6len
+	}
+	return 0
+}
+
+// decodePrefixes decodes a list of prefixes of address length `afLen`
+func decodePrefixes(b []byte, afLen int) ([]*net.IPNet, error) {
+	pfxs := make([]*net.IPNet, 0)
+	for len(b) > 0 {
+		pfxLen := int(b[0])
+		if pfxLen > afLen*8 {
+			return nil, fmt.Errorf("Invalid prefix length %d", pfxLen)
+		}
+		n := (pfxLen + 7) / 8
+		if len(b) < 1+n {
+			return nil, fmt.Errorf("Short prefix")
+		}
+
+		ip := make(net.IP, afLen)
+		copy(ip, b[1:1+n])
+		mask := net.CIDRMask(pfxLen, afLen*8)
+		pfxs = append(pfxs, &net.IPNet{
+			IP:   ip.Mask(mask),
+			Mask: mask,
+		})
+		b = b[1+n:]
+	}
+	return pfxs, nil
+}
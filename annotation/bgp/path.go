@@ -0,0 +1,195 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Path attribute flags and types
+const (
+	attrFlagOptional       = 0x80
+	attrFlagTransitive     = 0x40
+	attrFlagExtendedLength = 0x10
+
+	attrTypeOrigin           = 1
+	attrTypeASPath           = 2
+	attrTypeNextHop          = 3
+	attrTypeCommunities      = 8
+	attrTypeMPReachNLRI      = 14
+	attrTypeMPUnreachNLRI    = 15
+	attrTypeAS4Path          = 17
+	attrTypeLargeCommunities = 32
+)
+
+// AS path segment types
+const (
+	asPathSegmentSet      = 1
+	asPathSegmentSequence = 2
+)
+
+const (
+	communityLen      = 4
+	largeCommunityLen = 12
+)
+
+// Path holds the BGP attributes of a route used to annotate flows
+type Path struct {
+	// ASPath is the AS path of the route. Of AS sets only the first AS is kept.
+	ASPath []uint32
+
+	// OriginAS is the last AS of the AS path
+	OriginAS uint32
+
+	// NextHopAS is the first AS of the AS path
+	NextHopAS uint32
+
+	// Communities are the standard (a:b) and large (a:b:c) communities of the route
+	Communities []string
+}
+
+// attributes are the decoded path attributes of an UPDATE message
+type attributes struct {
+	path *Path
+
+	// mpReach and mpUnreach are the values of the MP_REACH_NLRI and MP_UNREACH_NLRI attributes
+	mpReach   []byte
+	mpUnreach []byte
+}
+
+// DecodePath decodes the path attributes `b`. With `as4` AS numbers in AS_PATH are 4 bytes long,
+// otherwise they are 2 bytes long and AS4_PATH is used to restore 4 byte AS numbers.
+func DecodePath(b []byte, as4 bool) (*Path, error) {
+	attrs, err := decodeAttributes(b, as4)
+	if err != nil {
+		return nil, err
+	}
+	return attrs.path, nil
+}
+
+// decodeAttributes decodes the path attributes `b`
+func decodeAttributes(b []byte, as4 bool) (*attributes, error) {
+	attrs := &attributes{
+		path: &Path{},
+	}
+
+	asLen := 2
+	if as4 {
+		asLen = 4
+	}
+
+	var asPath, as4Path []uint32
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return nil, fmt.Errorf("Short attribute header")
+		}
+		flags, typ := b[0], b[1]
+		var length int
+		if flags&attrFlagExtendedLength != 0 {
+			if len(b) < 4 {
+				return nil, fmt.Errorf("Short attribute header")
+			}
+			length = int(binary.BigEndian.Uint16(b[2:4]))
+			b = b[4:]
+		} else {
+			length = int(b[2])
+			b = b[3:]
+		}
+		if len(b) < length {
+			return nil, fmt.Errorf("Short attribute %d", typ)
+		}
+		value := b[:length]
+		b = b[length:]
+
+		var err error
+		switch typ {
+		case attrTypeASPath:
+			asPath, err = decodeASPath(value, asLen)
+		case attrTypeAS4Path:
+			if !as4 {
+				as4Path, err = decodeASPath(value, 4)
+			}
+		case attrTypeCommunities:
+			err = attrs.path.decodeCommunities(value)
+		case attrTypeLargeCommunities:
+			err = attrs.path.decodeLargeCommunities(value)
+		case attrTypeMPReachNLRI:
+			attrs.mpReach = value
+		case attrTypeMPUnreachNLRI:
+			attrs.mpUnreach = value
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// AS4_PATH replaces the trailing part of AS_PATH of the same length (RFC 6793)
+	if len(as4Path) > 0 && len(as4Path) <= len(asPath) {
+		asPath = append(asPath[:len(asPath)-len(as4Path)], as4Path...)
+	}
+
+	attrs.path.ASPath = asPath
+	if len(asPath) > 0 {
+		attrs.path.NextHopAS = asPath[0]
+		attrs.path.OriginAS = asPath[len(asPath)-1]
+	}
+	return attrs, nil
+}
+
+// decodeASPath decodes an AS_PATH or AS4_PATH attribute with AS numbers of `asLen` bytes.
+// Of AS sets only the first AS is kept. Confederation segments are skipped.
+func decodeASPath(b []byte, asLen int) ([]uint32, error) {
+	path := make([]uint32, 0)
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("Short AS path segment")
+		}
+		segType, count := b[0], int(b[1])
+		b = b[2:]
+		if len(b) < asLen*count {
+			return nil, fmt.Errorf("Short AS path segment")
+		}
+		seg := b[:asLen*count]
+		b = b[asLen*count:]
+
+		if segType != asPathSegmentSequence && segType != asPathSegmentSet {
+			continue
+		}
+
+		for i := 0; i < count; i++ {
+			if segType == asPathSegmentSet && i > 0 {
+				break
+			}
+
+			if asLen == 2 {
+				path = append(path, uint32(binary.BigEndian.Uint16(seg[2*i:])))
+			} else {
+				path = append(path, binary.BigEndian.Uint32(seg[4*i:]))
+			}
+		}
+	}
+	return path, nil
+}
+
+// decodeCommunities decodes a COMMUNITIES attribute (RFC 1997)
+func (p *Path) decodeCommunities(b []byte) error {
+	if len(b)%communityLen != 0 {
+		return fmt.Errorf("Invalid communities length %d", len(b))
+	}
+	for i := 0; i < len(b); i += communityLen {
+		p.Communities = append(p.Communities, fmt.Sprintf("%d:%d",
+			binary.BigEndian.Uint16(b[i:]), binary.BigEndian.Uint16(b[i+2:])))
+	}
+	return nil
+}
+
+// decodeLargeCommunities decodes a LARGE_COMMUNITY attribute (RFC 8092)
+func (p *Path) decodeLargeCommunities(b []byte) error {
+	if len(b)%largeCommunityLen != 0 {
+		return fmt.Errorf("Invalid large communities length %d", len(b))
+	}
+	for i := 0; i < len(b); i += largeCommunityLen {
+		p.Communities = append(p.Communities, fmt.Sprintf("%d:%d:%d",
+			binary.BigEndian.Uint32(b[i:]), binary.BigEndian.Uint32(b[i+4:]), binary.BigEndian.Uint32(b[i+8:])))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package bgp
+
+import (
+	"net"
+	"sync"
+
+	"github.com/bio-routing/tflow2/lpm"
+)
+
+// adjRIBIn holds the routes received from a peer
+type adjRIBIn struct {
+	mu    sync.RWMutex
+	table *lpm.Table
+}
+
+func newAdjRIBIn() *adjRIBIn {
+	return &adjRIBIn{
+		table: lpm.New(),
+	}
+}
+
+// update applies the withdrawals and announcements of UPDATE message `u`
+func (r *adjRIBIn) update(u *update) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, pfx := range u.withdrawn {
+		r.table.Delete(pfx)
+	}
+	for _, pfx := range u.nlri {
+		r.table.Insert(pfx, u.path)
+	}
+}
+
+// lookup returns the most specific route to `addr`
+func (r *adjRIBIn) lookup(addr net.IP) (*net.IPNet, *Path) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pfx, v, ok := r.table.Lookup(addr)
+	if !ok {
+		return nil, nil
+	}
+	return pfx, v.(*Path)
+}
+
+// len returns the number of prefixes
+func (r *adjRIBIn) len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.table.Len()
+}
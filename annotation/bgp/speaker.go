@@ -0,0 +1,321 @@
+// Package bgp implements a passive BGP speaker that annotates flows with the routes
+// received from the agent that exported them
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// openHoldTime bounds the time waiting for the OPEN message of a peer (RFC 4271 suggests 4 minutes)
+const openHoldTime = 4 * time.Minute
+
+// Speaker accepts BGP sessions from agents and keeps an Adj-RIB-In per agent. It never
+// announces routes.
+type Speaker struct {
+	localAS  uint32
+	routerID net.IP
+	holdTime uint16
+	listener net.Listener
+
+	// agents maps addresses of peers to the addresses of the agents their sessions belong to
+	agents map[string]string
+
+	// mu protects sessions
+	mu       sync.RWMutex
+	sessions map[string]*session
+}
+
+// session is an established session with an agent
+type session struct {
+	conn net.Conn
+	as   uint32
+	as4  bool
+	rib  *adjRIBIn
+
+	// holdTime is the negotiated hold time
+	holdTime time.Duration
+
+	// writeMu serializes writes to conn
+	writeMu sync.Mutex
+}
+
+// NewSpeaker creates a speaker listening for sessions of `agents` as configured in `acfg`
+func NewSpeaker(acfg config.Annotator, agents []config.Agent) (*Speaker, error) {
+	if acfg.LocalAS == 0 {
+		return nil, fmt.Errorf("Local AS of BGP annotator %s not configured", acfg.Name)
+	}
+
+	routerID := net.ParseIP(acfg.RouterID).To4()
+	if routerID == nil {
+		return nil, fmt.Errorf("Invalid router ID %q of BGP annotator %s", acfg.RouterID, acfg.Name)
+	}
+
+	if (acfg.HoldTime != 0 && acfg.HoldTime < 3) || acfg.HoldTime > 0xffff {
+		return nil, fmt.Errorf("Invalid hold time %d of BGP annotator %s", acfg.HoldTime, acfg.Name)
+	}
+
+	s := &Speaker{
+		localAS:  acfg.LocalAS,
+		routerID: routerID,
+		holdTime: uint16(acfg.HoldTime),
+		agents:   make(map[string]string),
+		sessions: make(map[string]*session),
+	}
+
+	for _, agent := range agents {
+		addr := agent.BGPAddress
+		if addr == "" {
+			addr = agent.IPAddress
+		}
+
+		peer, rtr := net.ParseIP(addr), net.ParseIP(agent.IPAddress)
+		if peer == nil || rtr == nil {
+			return nil, fmt.Errorf("Invalid BGP address of agent %s", agent.Name)
+		}
+		s.agents[peer.String()] = rtr.String()
+	}
+
+	l, err := net.Listen("tcp", acfg.Listen)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to listen on %s", acfg.Listen)
+	}
+	s.listener = l
+
+	glog.Infof("Accepting BGP sessions on %s", l.Addr())
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the speaker listens on
+func (s *Speaker) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops accepting sessions and closes all sessions
+func (s *Speaker) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sess := range s.sessions {
+		sess.close()
+	}
+}
+
+// Annotate adds the prefixes, AS numbers, AS paths and communities of the routes the
+// agent `fl` was received from has to the source and destination addresses
+func (s *Speaker) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	s.mu.RLock()
+	sess := s.sessions[net.IP(fl.Router).String()]
+	s.mu.RUnlock()
+	if sess == nil {
+		return nil
+	}
+
+	if pfx, p := sess.rib.lookup(fl.SrcAddr); p != nil {
+		fl.SrcPfx = &netflow.Pfx{IP: pfx.IP, Mask: pfx.Mask}
+		fl.SrcAs = sess.originAS(p)
+		fl.SrcAsPath = p.ASPath
+		fl.SrcCommunities = p.Communities
+	}
+
+	if pfx, p := sess.rib.lookup(fl.DstAddr); p != nil {
+		fl.DstPfx = &netflow.Pfx{IP: pfx.IP, Mask: pfx.Mask}
+		fl.DstAs = sess.originAS(p)
+		fl.DstAsPath = p.ASPath
+		fl.DstCommunities = p.Communities
+		fl.NextHopAs = p.NextHopAS
+	}
+
+	return nil
+}
+
+// originAS returns the origin AS of path `p`. Routes with an empty AS path originate in the AS of the peer.
+func (sess *session) originAS(p *Path) uint32 {
+	if len(p.ASPath) == 0 {
+		return sess.as
+	}
+	return p.OriginAS
+}
+
+// serve accepts connections
+func (s *Speaker) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+// handle runs a session on connection `conn`
+func (s *Speaker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	peer := conn.RemoteAddr().(*net.TCPAddr).IP.String()
+	agent, ok := s.agents[peer]
+	if !ok {
+		glog.Warningf("Rejected BGP connection from unknown peer %s", peer)
+		return
+	}
+
+	sess, err := s.establish(conn)
+	if err != nil {
+		glog.Warningf("Unable to establish BGP session with %s: %v", peer, err)
+		return
+	}
+
+	s.mu.Lock()
+	if old := s.sessions[agent]; old != nil {
+		old.close()
+	}
+	s.sessions[agent] = sess
+	s.mu.Unlock()
+	glog.Infof("BGP session with %s (AS%d) established", peer, sess.as)
+
+	err = sess.run()
+
+	s.mu.Lock()
+	if s.sessions[agent] == sess {
+		delete(s.sessions, agent)
+	}
+	s.mu.Unlock()
+	glog.Infof("BGP session with %s closed after receiving %d prefixes: %v", peer, sess.rib.len(), err)
+}
+
+// establish exchanges OPEN messages on `conn`
+func (s *Speaker) establish(conn net.Conn) (*session, error) {
+	if _, err := conn.Write(encodeOpen(s.localAS, s.holdTime, s.routerID)); err != nil {
+		return nil, errors.Wrap(err, "Unable to send OPEN")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(openHoldTime))
+	typ, body, err := readMessage(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read OPEN")
+	}
+	if typ != msgTypeOpen {
+		conn.Write(encodeNotification(errCodeFSM, 0))
+		return nil, fmt.Errorf("Received message of type %d instead of OPEN", typ)
+	}
+
+	o, err := decodeOpen(body)
+	if err != nil {
+		conn.Write(encodeNotification(errCodeOpen, 0))
+		return nil, err
+	}
+	if o.holdTime == 1 || o.holdTime == 2 {
+		conn.Write(encodeNotification(errCodeOpen, errSubcodeHoldTime))
+		return nil, fmt.Errorf("Unacceptable hold time %d", o.holdTime)
+	}
+
+	holdTime := s.holdTime
+	if o.holdTime < holdTime {
+		holdTime = o.holdTime
+	}
+
+	if _, err := conn.Write(encodeMessage(msgTypeKeepalive, nil)); err != nil {
+		return nil, errors.Wrap(err, "Unable to send KEEPALIVE")
+	}
+
+	return &session{
+		conn:     conn,
+		as:       o.as,
+		as4:      o.as4,
+		rib:      newAdjRIBIn(),
+		holdTime: time.Duration(holdTime) * time.Second,
+	}, nil
+}
+
+// run receives messages until the session fails. Keepalives are sent every third of the hold time.
+func (sess *session) run() error {
+	done := make(chan struct{})
+	defer close(done)
+
+	if sess.holdTime > 0 {
+		go sess.keepalive(sess.holdTime/3, done)
+	}
+
+	for {
+		if sess.holdTime > 0 {
+			sess.conn.SetReadDeadline(time.Now().Add(sess.holdTime))
+		} else {
+			sess.conn.SetReadDeadline(time.Time{})
+		}
+
+		typ, body, err := readMessage(sess.conn)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				sess.send(encodeNotification(errCodeHoldTimer, 0))
+				return fmt.Errorf("Hold timer expired")
+			}
+			return err
+		}
+
+		switch typ {
+		case msgTypeUpdate:
+			u, err := decodeUpdate(body, sess.as4)
+			if err != nil {
+				sess.send(encodeNotification(errCodeUpdate, 0))
+				return errors.Wrap(err, "Invalid UPDATE")
+			}
+			sess.rib.update(u)
+		case msgTypeNotification:
+			if len(body) >= 2 {
+				return fmt.Errorf("Received NOTIFICATION %d/%d", body[0], body[1])
+			}
+			return fmt.Errorf("Received NOTIFICATION")
+		case msgTypeKeepalive:
+		default:
+			sess.send(encodeNotification(errCodeFSM, 0))
+			return fmt.Errorf("Unexpected message of type %d", typ)
+		}
+	}
+}
+
+// keepalive sends KEEPALIVE messages every `interval` until `done` is closed
+func (sess *session) keepalive(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := sess.send(encodeMessage(msgTypeKeepalive, nil)); err != nil {
+				sess.conn.Close()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// close closes the session with a NOTIFICATION
+func (sess *session) close() {
+	sess.send(encodeNotification(errCodeCease, 0))
+	sess.conn.Close()
+}
+
+// send writes message `msg`
+func (sess *session) send(msg []byte) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	_, err := sess.conn.Write(msg)
+	return err
+}
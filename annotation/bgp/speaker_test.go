@@ -0,0 +1,206 @@
+package bgp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// encodePrefix encodes prefix `pfx` as used in NLRI
+func encodePrefix(pfx string) []byte {
+	_, n, _ := net.ParseCIDR(pfx)
+	ones, _ := n.Mask.Size()
+	ip := n.IP.To4()
+	if ip == nil {
+		ip = n.IP
+	}
+	return append([]byte{byte(ones)}, ip[:(ones+7)/8]...)
+}
+
+// encodeAttribute encodes a path attribute
+func encodeAttribute(flags uint8, typ uint8, value []byte) []byte {
+	return append([]byte{flags, typ, byte(len(value))}, value...)
+}
+
+// encodeASPath encodes an AS_PATH of one AS_SEQUENCE with AS numbers of `asLen` bytes
+func encodeASPath(asLen int, path ...uint32) []byte {
+	b := []byte{asPathSegmentSequence, byte(len(path))}
+	for _, as := range path {
+		a := make([]byte, 4)
+		binary.BigEndian.PutUint32(a, as)
+		b = append(b, a[4-asLen:]...)
+	}
+	return encodeAttribute(attrFlagTransitive, attrTypeASPath, b)
+}
+
+// encodeUpdate encodes an UPDATE message
+func encodeUpdate(withdrawn []string, attrs []byte, nlri []string) []byte {
+	var w, n []byte
+	for _, pfx := range withdrawn {
+		w = append(w, encodePrefix(pfx)...)
+	}
+	for _, pfx := range nlri {
+		n = append(n, encodePrefix(pfx)...)
+	}
+
+	b := []byte{byte(len(w) >> 8), byte(len(w))}
+	b = append(b, w...)
+	b = append(b, byte(len(attrs)>>8), byte(len(attrs)))
+	b = append(b, attrs...)
+	b = append(b, n...)
+	return encodeMessage(msgTypeUpdate, b)
+}
+
+// peer is a BGP peer stand-in
+type peer struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (p *peer) expect(typ uint8) []byte {
+	p.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msgType, body, err := readMessage(p.conn)
+	if err != nil {
+		p.t.Fatalf("Unable to read message: %v", err)
+	}
+	if msgType != typ {
+		p.t.Fatalf("Received message of type %d instead of %d", msgType, typ)
+	}
+	return body
+}
+
+func (p *peer) send(msg []byte) {
+	if _, err := p.conn.Write(msg); err != nil {
+		p.t.Fatalf("Unable to send message: %v", err)
+	}
+}
+
+// annotate annotates a flow from router `rtr` until `cond` holds
+func annotate(t *testing.T, s *Speaker, rtr string, src string, dst string, cond func(fl *netflow.Flow) bool) *netflow.Flow {
+	for i := 0; i < 100; i++ {
+		fl := &netflow.Flow{
+			Router:  net.ParseIP(rtr),
+			SrcAddr: net.ParseIP(src),
+			DstAddr: net.ParseIP(dst),
+		}
+		assert.Nil(t, s.Annotate(context.Background(), fl))
+		if cond(fl) {
+			return fl
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Flow from %s to %s not annotated as expected", src, dst)
+	return nil
+}
+
+func TestSpeaker(t *testing.T) {
+	s, err := NewSpeaker(config.Annotator{
+		Name:     "bgp",
+		Listen:   "127.0.0.1:0",
+		LocalAS:  4200000000,
+		RouterID: "192.0.2.254",
+		HoldTime: 90,
+	}, []config.Agent{
+		{
+			Name:       "rtr01",
+			IPAddress:  "192.0.2.1",
+			BGPAddress: "127.0.0.1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create speaker: %v", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close()
+	p := &peer{t: t, conn: conn}
+
+	o, err := decodeOpen(p.expect(msgTypeOpen))
+	assert.Nil(t, err)
+	assert.True(t, o.as4)
+	assert.Equal(t, uint32(4200000000), o.as)
+	assert.Equal(t, uint16(90), o.holdTime)
+	assert.Equal(t, "192.0.2.254", o.routerID.String())
+
+	p.send(encodeOpen(64496, 30, net.ParseIP("192.0.2.1")))
+	p.expect(msgTypeKeepalive)
+	p.send(encodeMessage(msgTypeKeepalive, nil))
+
+	// IPv4 routes
+	attrs := encodeAttribute(attrFlagTransitive, attrTypeOrigin, []byte{0})
+	attrs = append(attrs, encodeASPath(4, 64496, 4200000001)...)
+	attrs = append(attrs, encodeAttribute(attrFlagTransitive, attrTypeNextHop, []byte{192, 0, 2, 1})...)
+	attrs = append(attrs, encodeAttribute(attrFlagOptional|attrFlagTransitive, attrTypeCommunities, []byte{0xfb, 0xf0, 0, 1})...)
+	p.send(encodeUpdate(nil, attrs, []string{"198.51.100.0/24", "203.0.113.0/24"}))
+
+	// IPv6 route originated by the peer
+	mpReach := []byte{0, afiIPv6, safiUnicast, 16}
+	mpReach = append(mpReach, net.ParseIP("2001:db8::1")...)
+	mpReach = append(mpReach, 0)
+	mpReach = append(mpReach, encodePrefix("2001:db8::/32")...)
+	attrs = encodeAttribute(attrFlagTransitive, attrTypeOrigin, []byte{0})
+	attrs = append(attrs, encodeASPath(4)...)
+	attrs = append(attrs, encodeAttribute(attrFlagOptional, attrTypeMPReachNLRI, mpReach)...)
+	p.send(encodeUpdate(nil, attrs, nil))
+
+	fl := annotate(t, s, "192.0.2.1", "198.51.100.1", "203.0.113.1", func(fl *netflow.Flow) bool {
+		return fl.DstAs != 0
+	})
+	assert.Equal(t, uint32(4200000001), fl.SrcAs)
+	assert.Equal(t, uint32(4200000001), fl.DstAs)
+	assert.Equal(t, uint32(64496), fl.NextHopAs)
+	assert.Equal(t, []uint32{64496, 4200000001}, fl.DstAsPath)
+	assert.Equal(t, []string{"64496:1"}, fl.DstCommunities)
+	assert.Equal(t, net.IP{198, 51, 100, 0}, net.IP(fl.SrcPfx.IP))
+
+	fl = annotate(t, s, "192.0.2.1", "2001:db8::1", "2001:db9::1", func(fl *netflow.Flow) bool {
+		return fl.SrcAs != 0
+	})
+	assert.Equal(t, uint32(64496), fl.SrcAs)
+	assert.Equal(t, uint32(0), fl.DstAs)
+	assert.Equal(t, "2001:db8::", net.IP(fl.SrcPfx.IP).String())
+
+	// Flows of other agents are not annotated by the peer's routes
+	fl = &netflow.Flow{
+		Router:  net.ParseIP("192.0.2.2"),
+		SrcAddr: net.ParseIP("198.51.100.1"),
+	}
+	assert.Nil(t, s.Annotate(context.Background(), fl))
+	assert.Equal(t, uint32(0), fl.SrcAs)
+
+	// Withdrawal
+	p.send(encodeUpdate([]string{"198.51.100.0/24"}, nil, nil))
+	annotate(t, s, "192.0.2.1", "198.51.100.1", "203.0.113.1", func(fl *netflow.Flow) bool {
+		return fl.SrcAs == 0 && fl.DstAs != 0
+	})
+
+	// Routes are removed with the session
+	conn.Close()
+	annotate(t, s, "192.0.2.1", "198.51.100.1", "203.0.113.1", func(fl *netflow.Flow) bool {
+		return fl.DstAs == 0
+	})
+}
+
+func TestDecodeUpdateAS4Path(t *testing.T) {
+	attrs := encodeASPath(2, 64496, asTrans)
+	attrs = append(attrs, encodeAttribute(attrFlagOptional|attrFlagTransitive, attrTypeAS4Path, encodeASPath(4, 4200000001)[3:])...)
+	msg := encodeUpdate(nil, attrs, []string{"198.51.100.0/24"})
+
+	u, err := decodeUpdate(msg[headerLen:], false)
+	if err != nil {
+		t.Fatalf("Unable to decode update: %v", err)
+	}
+	assert.Equal(t, []uint32{64496, 4200000001}, u.path.ASPath)
+	assert.Equal(t, uint32(4200000001), u.path.OriginAS)
+	assert.Equal(t, "198.51.100.0/24", u.nlri[0].String())
+}
@@ -14,15 +14,16 @@
 package bird
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"net"
-	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
+	"time"
 
+	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/netflow"
-	"github.com/bio-routing/tflow2/stats"
 	"github.com/golang/glog"
 )
 
@@ -37,26 +38,45 @@ type QueryResult struct {
 
 	// NhAs is the ASN of the subject IPs associated Next Hop
 	NHAS uint32
-}
 
-// QueryCache represents a set of QueryResults that have been cached
-type QueryCache struct {
-	cache map[string]QueryResult
-	lock  sync.RWMutex
+	// ASPath is the AS path of the prefix. Of AS sets only the first AS is kept.
+	ASPath []uint32
+
+	// Communities are the standard (a:b) and large (a:b:c) communities of the prefix
+	Communities []string
+
+	// networks is the number of networks of a count query
+	networks int
+
+	// count is the reply of a count query, e.g. "3 of 4 routes for 2 networks"
+	count string
 }
 
-// Query represents a query to BIRD and encapsulates it with a channel where it's result is expected
+// Query represents a query to BIRD and encapsulates it with a channel where it's result is expected.
+// Failed queries are answered with nil and their error is set in err.
 type Query struct {
 	birdQuery string
+	ipv6      bool
 	retCh     chan *QueryResult
+	err       error
 }
 
+// Backoff between attempts to connect to BIRD
+const (
+	minReconnectBackoff = 100 * time.Millisecond
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// replyTimeout bounds the time BIRD may take to reply to a query
+const replyTimeout = 10 * time.Second
+
 // birdCon represents a connection to a BIRD instance
 type birdCon struct {
-	sock  string
-	con   net.Conn
-	recon chan bool
-	lock  sync.RWMutex
+	sock   string
+	con    net.Conn
+	reader *bufio.Reader
+	recon  chan bool
+	lock   sync.RWMutex
 }
 
 // Annotator represents a BIRD based BGP annotator
@@ -69,39 +89,117 @@ type Annotator struct {
 	// connection to BIRD
 	bird4 *birdCon
 
-	// connectio to BIRD6
+	// connectio to BIRD6. With BIRD 2 it is the connection to BIRD.
 	bird6 *birdCon
 
+	// table4 and table6 are the tables queried for IPv4 and IPv6 addresses
+	table4 string
+	table6 string
+
+	// template, countTemplate and watchTemplate are the query templates unless agents have their own
+	template      string
+	countTemplate string
+	watchTemplate string
+	agents        map[string]agent
+
 	// debug level
 	debug int
 }
 
-// NewAnnotator creates a new BIRD annotator and get's service started
-func NewAnnotator(sock string, sock6 string, debug int) *Annotator {
+// agent is a configured agent with its query templates, if any
+type agent struct {
+	name          string
+	template      string
+	countTemplate string
+	watchTemplate string
+}
+
+// NewAnnotator creates a new BIRD annotator as configured in `acfg` and get's service started.
+// BIRD 1 is queried on BIRDSocket for IPv4 and BIRD6Socket for IPv6 addresses, BIRD 2 on
+// BIRDSocket for both. Queries are formed from the template of the agent if it has one.
+// Cached results of agents are invalidated when the number of their routes changes.
+func NewAnnotator(acfg config.Annotator, agents []config.Agent, debug int) (*Annotator, error) {
 	a := &Annotator{
-		cache:  newQueryCache(),
-		queryC: make(chan *Query),
-		debug:  debug,
+		cache:         newQueryCache(acfg.CacheSize, time.Duration(acfg.CacheTTL)*time.Second),
+		queryC:        make(chan *Query),
+		table4:        acfg.BIRDTable4,
+		table6:        acfg.BIRDTable6,
+		template:      acfg.BIRDQuery,
+		countTemplate: acfg.BIRDCountQuery,
+		watchTemplate: acfg.BIRDWatchQuery,
+		agents:        make(map[string]agent),
+		debug:         debug,
 	}
 
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		a.bird4 = newBirdCon(sock)
-	}()
+	if acfg.BIRDVersion != 1 && acfg.BIRDVersion != 2 {
+		return nil, fmt.Errorf("Unsupported BIRD version %d", acfg.BIRDVersion)
+	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		a.bird6 = newBirdCon(sock6)
-	}()
+	if err := checkTemplate(a.template, "{addr}"); err != nil {
+		return nil, err
+	}
+	if a.countTemplate != "" {
+		if err := checkTemplate(a.countTemplate, "{prefix}"); err != nil {
+			return nil, err
+		}
+	}
+	for _, ag := range agents {
+		ip := net.ParseIP(ag.IPAddress)
+		if ip == nil {
+			continue
+		}
+		if ag.BIRDQuery != "" {
+			if err := checkTemplate(ag.BIRDQuery, "{addr}"); err != nil {
+				return nil, fmt.Errorf("Invalid query of agent %s: %v", ag.Name, err)
+			}
+		}
+		if ag.BIRDCountQuery != "" {
+			if err := checkTemplate(ag.BIRDCountQuery, "{prefix}"); err != nil {
+				return nil, fmt.Errorf("Invalid count query of agent %s: %v", ag.Name, err)
+			}
+		}
+		a.agents[ip.String()] = agent{
+			name:          ag.Name,
+			template:      ag.BIRDQuery,
+			countTemplate: ag.BIRDCountQuery,
+			watchTemplate: ag.BIRDWatchQuery,
+		}
+	}
 
-	wg.Wait()
+	if acfg.BIRDVersion == 2 {
+		a.bird4 = newBirdCon(acfg.BIRDSocket)
+		a.bird6 = a.bird4
+	} else {
+		var wg sync.WaitGroup
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.bird4 = newBirdCon(acfg.BIRDSocket)
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.bird6 = newBirdCon(acfg.BIRD6Socket)
+		}()
+
+		wg.Wait()
+	}
 	go a.gateway()
+	if acfg.WatchInterval > 0 {
+		go a.watch(time.Duration(acfg.WatchInterval) * time.Second)
+	}
 
-	return a
+	return a, nil
+}
+
+// checkTemplate checks that query template `tmpl` contains placeholder `ph` of the queried address or prefix
+func checkTemplate(tmpl string, ph string) error {
+	if !strings.Contains(tmpl, ph) {
+		return fmt.Errorf("Query template %q lacks %s", tmpl, ph)
+	}
+	return nil
 }
 
 // getConn gets the net.Conn property of the BIRD connection
@@ -109,88 +207,86 @@ func (c *birdCon) getConn() *net.Conn {
 	return &c.con
 }
 
-// newQueryCache creates and initializes a new `QueryCache`
-func newQueryCache() *QueryCache {
-	return &QueryCache{cache: make(map[string]QueryResult)}
-}
-
 // reconnector receives a signal via channel that triggers a connection attempt to BIRD
 func (c *birdCon) reconnector() {
 	for {
 		// wait for signal of a closed connection
 		<-c.recon
 
-		// try to connect up to 5 times
-		for i := 0; i < 5; i++ {
+		c.lock.Lock()
+		if c.con != nil {
+			c.con.Close()
+			c.con = nil
+		}
+		c.lock.Unlock()
+
+		// try to connect until we succeed, backing off exponentially
+		backoff := minReconnectBackoff
+		for ; ; backoff *= 2 {
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+
 			tmpCon, err := net.Dial("unix", c.sock)
 			if err != nil {
 				glog.Warningf("Unable to connect to BIRD on %s: %v", c.sock, err)
+				time.Sleep(backoff)
 				continue
 			}
 
 			// Read welcome message we are not interested in
-			buf := make([]byte, 1024)
-			nbytes, err := tmpCon.Read(buf[:])
-			if err != nil || nbytes == 0 {
-				if err == nil {
-					tmpCon.Close()
-				}
+			reader := bufio.NewReader(tmpCon)
+			tmpCon.SetReadDeadline(time.Now().Add(replyTimeout))
+			if _, err := readReply(reader); err != nil {
+				tmpCon.Close()
 				glog.Warningf("Reading from BIRD failed: %v", err)
+				time.Sleep(backoff)
 				continue
 			}
 
 			c.lock.Lock()
 			c.con = tmpCon
+			c.reader = reader
 			c.lock.Unlock()
 			break
 		}
 	}
 }
 
-// Get tries to receive an entry from QueryCache `qc`
-func (qc *QueryCache) Get(addr []byte) *QueryResult {
-	qc.lock.RLock()
-	defer qc.lock.RUnlock()
-
-	res, ok := qc.cache[net.IP(addr).String()]
-	if !ok {
-		atomic.AddUint64(&stats.GlobalStats.BirdCacheMiss, 1)
-		return nil
-	}
-	atomic.AddUint64(&stats.GlobalStats.BirdCacheHits, 1)
-	return &res
-}
-
-// Set sets data for `addr` in QueryCache `qc` to `qres`
-func (qc *QueryCache) Set(addr []byte, qres *QueryResult) {
-	qc.lock.Lock()
-	defer qc.lock.Unlock()
-	qc.cache[net.IP(addr).String()] = *qres
-}
-
 // newBirdCon creates a birdCon to socket `s`
 func newBirdCon(s string) *birdCon {
 	b := &birdCon{
 		sock:  s,
-		recon: make(chan bool),
+		recon: make(chan bool, 1),
 	}
 	go b.reconnector()
-	b.recon <- true
+	b.reconnect()
 	return b
 }
 
+// reconnect signals the reconnector to (re)connect unless it is already signaled
+func (c *birdCon) reconnect() {
+	select {
+	case c.recon <- true:
+	default:
+	}
+}
+
 // Augment function provides the main interface to the external world to consume service of this module
 func (a *Annotator) Augment(fl *netflow.Flow) {
-	srcRes := a.cache.Get(fl.SrcAddr)
-	if srcRes == nil {
-		srcRes = a.query(net.IP(fl.Router), fl.SrcAddr)
-		a.cache.Set(fl.SrcAddr, srcRes)
+	a.augment(context.Background(), fl)
+}
+
+// augment adds prefixes and AS numbers to `fl`. It fails if BIRD does not reply before `ctx` is done.
+func (a *Annotator) augment(ctx context.Context, fl *netflow.Flow) error {
+	srcRes, err := a.lookup(ctx, fl.Router, fl.SrcAddr)
+	if err != nil {
+		return err
 	}
 
-	dstRes := a.cache.Get(fl.DstAddr)
-	if dstRes == nil {
-		dstRes = a.query(net.IP(fl.Router), fl.DstAddr)
-		a.cache.Set(fl.DstAddr, dstRes)
+	dstRes, err := a.lookup(ctx, fl.Router, fl.DstAddr)
+	if err != nil {
+		return err
 	}
 
 	fl.SrcPfx = &netflow.Pfx{
@@ -206,122 +302,266 @@ func (a *Annotator) Augment(fl *netflow.Flow) {
 	fl.SrcAs = srcRes.AS
 	fl.DstAs = dstRes.AS
 	fl.NextHopAs = dstRes.NHAS
+	fl.SrcAsPath = srcRes.ASPath
+	fl.DstAsPath = dstRes.ASPath
+	fl.SrcCommunities = srcRes.Communities
+	fl.DstCommunities = dstRes.Communities
+	return nil
+}
+
+// Annotate implements the annotation.Annotator interface
+func (a *Annotator) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	return a.augment(ctx, fl)
+}
+
+// lookup returns the result of address `addr` of a flow of agent `rtr` from the cache or from BIRD.
+// Results are cached by their prefix if BIRD has no more specific routes within it, otherwise
+// by the address.
+func (a *Annotator) lookup(ctx context.Context, rtr net.IP, addr net.IP) (*QueryResult, error) {
+	if res := a.cache.Get(rtr, addr); res != nil {
+		return res, nil
+	}
+
+	res, err := a.query(ctx, a.formatQuery(rtr, addr), addr.To4() == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pfx := hostPrefix(addr)
+	if res.Pfx.IP != nil && res.Pfx.Contains(addr) && a.leaf(ctx, rtr, &res.Pfx) {
+		pfx = &net.IPNet{IP: res.Pfx.IP, Mask: res.Pfx.Mask}
+	}
+	if pfx != nil {
+		a.cache.Set(rtr, pfx, res)
+	}
+	return res, nil
 }
 
-// query forms a query, sends it to the processing engine, reads the result and returns it
-func (a *Annotator) query(rtr net.IP, addr net.IP) *QueryResult {
+// leaf checks if BIRD has no routes of agent `rtr` more specific than `pfx`
+func (a *Annotator) leaf(ctx context.Context, rtr net.IP, pfx *net.IPNet) bool {
+	q := a.formatCountQuery(rtr, pfx)
+	if q == "" {
+		return false
+	}
+
+	res, err := a.query(ctx, q, pfx.IP.To4() == nil)
+	if err != nil {
+		if a.debug > 2 {
+			glog.Warningf("Unable to count routes within %s: %v", pfx, err)
+		}
+		return false
+	}
+	return res.networks == 1
+}
+
+// hostPrefix returns the host prefix of `addr`
+func hostPrefix(addr net.IP) *net.IPNet {
+	if ip := addr.To4(); ip != nil {
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}
+	}
+	if ip := addr.To16(); ip != nil {
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}
+	}
+	return nil
+}
+
+// query sends query `birdQuery` to the processing engine, reads the result and returns it
+func (a *Annotator) query(ctx context.Context, birdQuery string, ipv6 bool) (*QueryResult, error) {
 	q := Query{
-		birdQuery: fmt.Sprintf("show route all for %s protocol nf_%s\n", addr.String(), strings.Replace(rtr.String(), ".", "_", -1)),
-		retCh:     make(chan *QueryResult),
+		birdQuery: birdQuery + "\n",
+		ipv6:      ipv6,
+		retCh:     make(chan *QueryResult, 1),
+	}
+
+	select {
+	case a.queryC <- &q:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	a.queryC <- &q
-	return <-q.retCh
+
+	select {
+	case res := <-q.retCh:
+		if res == nil {
+			return nil, fmt.Errorf("Query %q to BIRD failed: %v", strings.TrimSpace(q.birdQuery), q.err)
+		}
+		return res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// formatQuery forms the query of address `addr` of a flow of agent `rtr` from the query template.
+// The placeholders {addr}, {router} (address of the agent with dots and colons replaced by
+// underscores), {agent} (name of the agent), {table} and {channel} (ipv4 or ipv6) are replaced.
+func (a *Annotator) formatQuery(rtr net.IP, addr net.IP) string {
+	tmpl := a.template
+	ag := a.agents[rtr.String()]
+	if ag.template != "" {
+		tmpl = ag.template
+	}
+
+	return a.format(tmpl, ag, rtr, addr.To4() == nil, "{addr}", addr.String())
+}
+
+// formatCountQuery forms the query counting the networks within `pfx` of agent `rtr` from the
+// count query template. It returns an empty string if there is no template matching the query
+// of the agent.
+func (a *Annotator) formatCountQuery(rtr net.IP, pfx *net.IPNet) string {
+	tmpl := a.countTemplate
+	ag := a.agents[rtr.String()]
+	if ag.template != "" || ag.countTemplate != "" {
+		tmpl = ag.countTemplate
+	}
+	if tmpl == "" {
+		return ""
+	}
+
+	return a.format(tmpl, ag, rtr, pfx.IP.To4() == nil, "{prefix}", pfx.String())
+}
+
+// formatWatchQuery forms the query counting the routes of agent `rtr` of the IPv4 or IPv6 table
+// from the watch query template. It returns an empty string if there is no template matching
+// the query of the agent.
+func (a *Annotator) formatWatchQuery(rtr net.IP, ipv6 bool) string {
+	tmpl := a.watchTemplate
+	ag := a.agents[rtr.String()]
+	if ag.template != "" || ag.watchTemplate != "" {
+		tmpl = ag.watchTemplate
+	}
+	if tmpl == "" {
+		return ""
+	}
+
+	return a.format(tmpl, ag, rtr, ipv6)
+}
+
+// format replaces the placeholders of template `tmpl` and the placeholders and values of `phs`
+func (a *Annotator) format(tmpl string, ag agent, rtr net.IP, ipv6 bool, phs ...string) string {
+	table, channel := a.table4, "ipv4"
+	if ipv6 {
+		table, channel = a.table6, "ipv6"
+	}
+
+	return strings.NewReplacer(append(phs,
+		"{router}", strings.NewReplacer(".", "_", ":", "_").Replace(rtr.String()),
+		"{agent}", ag.name,
+		"{table}", table,
+		"{channel}", channel,
+	)...).Replace(tmpl)
+}
+
+// watch checks the routes of agents with cached results every `interval`
+func (a *Annotator) watch(interval time.Duration) {
+	counts := make(map[string]string)
+	for range time.Tick(interval) {
+		counts = a.checkRoutes(counts)
+	}
+}
+
+// checkRoutes counts the routes of the agents with cached results and invalidates the results of
+// agents whose count differs from `counts`. Results of agents not in `counts` are invalidated as
+// well as they may have been cached before their routes changed. It returns the current counts.
+func (a *Annotator) checkRoutes(counts map[string]string) map[string]string {
+	current := make(map[string]string)
+	for _, rtr := range a.cache.Agents() {
+		count, err := a.countRoutes(rtr)
+		if err != nil {
+			if a.debug > 2 {
+				glog.Warningf("Unable to count routes of %s: %v", rtr, err)
+			}
+			if c, ok := counts[rtr.String()]; ok {
+				current[rtr.String()] = c
+			}
+			continue
+		}
+		if count == "" {
+			continue
+		}
+
+		current[rtr.String()] = count
+		if c, ok := counts[rtr.String()]; ok && c == count {
+			continue
+		}
+
+		n := a.cache.Invalidate(rtr)
+		if a.debug > 0 {
+			glog.Infof("Routes of %s changed. Invalidated %d cached results.", rtr, n)
+		}
+	}
+	return current
+}
+
+// countRoutes returns the route counts of the IPv4 and IPv6 tables of agent `rtr`. It returns
+// an empty string if the agent has no watch query.
+func (a *Annotator) countRoutes(rtr net.IP) (string, error) {
+	counts := make([]string, 0, 2)
+	for _, ipv6 := range []bool{false, true} {
+		q := a.formatWatchQuery(rtr, ipv6)
+		if q == "" {
+			return "", nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), replyTimeout)
+		res, err := a.query(ctx, q, ipv6)
+		cancel()
+		if err != nil {
+			return "", err
+		}
+		counts = append(counts, res.count)
+	}
+	return strings.Join(counts, "|"), nil
 }
 
 // gateway starts the main service routine
 func (a *Annotator) gateway() {
-	buf := make([]byte, 1024)
 	for {
-		var res QueryResult
 		query := <-a.queryC
 		if query == nil {
 			continue
 		}
-		data := []byte(query.birdQuery)
 
 		// Determine if we are being queried for an IPv4 or an IPv6 address
 		bird := a.bird4
-		if strings.Contains(query.birdQuery, ":") {
+		if query.ipv6 {
 			bird = a.bird6
 		}
 
-		// Skip annotation if we're not connected to bird yet
-		bird.lock.RLock()
-		if bird.con == nil {
-			glog.Warningf("skipped annotating flow: BIRD is not connected yet")
-			bird.lock.RUnlock()
-			query.retCh <- &res
-			continue
-		}
-
-		// Send query to BIRD
-		_, err := bird.con.Write(data)
+		res, err := bird.query(query.birdQuery)
 		if err != nil {
-			bird.lock.RUnlock()
-			glog.Errorf("Unable to write to BIRD: %v", err)
-			bird.recon <- true
+			query.err = err
+			query.retCh <- nil
 			continue
 		}
-		bird.lock.RUnlock()
-
-		// Read reply from BIRD
-		n, err := bird.con.Read(buf[:])
-		if err != nil {
-			bird.lock.RUnlock()
-			glog.Errorf("unable to read from BIRD: %v", err)
-			bird.recon <- true
-			continue
+		if res.AS == 0 && a.debug > 2 {
+			glog.Warningf("unable to find AS path for '%v'", query)
 		}
+		query.retCh <- res
+	}
+}
 
-		// Parse BIRDs output
-		output := string(buf[:n])
-		lines := strings.Split(output, "\n")
-		for i, line := range lines {
-			// Take the first line as that should contain the prefix
-			if i == 0 {
-				parts := strings.Split(line, " ")
-				if len(parts) == 0 {
-					glog.Warningf("unexpected empty output for query '%v'", query)
-					continue
-				}
-				pfx := parts[0]
-				parts = strings.Split(pfx, "-")
-				if len(parts) != 2 {
-					glog.Warningf("unexpected split results for query '%v'", query)
-					continue
-				}
-				pfx = parts[1]
-
-				_, tmpNet, err := net.ParseCIDR(pfx)
-				res.Pfx = *tmpNet
-				if err != nil {
-					glog.Warningf("unable to parse CIDR from BIRD: %v (query '%v')", err, query)
-					continue
-				}
-				continue
-			}
-
-			// Find line that contains the AS Path
-			if strings.Contains(line, "BGP.as_path: ") {
-				// Remove curly braces from BIRD AS path (ignores aggregators), e.g. BGP.as_path: 25291 3320 20940 { 16625 }
-				line = strings.Replace(line, "{ ", "", -1)
-				line = strings.Replace(line, " }", "", -1)
-
-				parts := strings.Split(line, "BGP.as_path: ")
-				pathParts := strings.Split(parts[1], " ")
-
-				if len(parts) < 2 || parts[1] == "" {
-					break
-				}
+// query sends query `q` and reads the reply. Errors of the connection trigger a reconnect.
+func (c *birdCon) query(q string) (*QueryResult, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 
-				AS, err := strconv.ParseUint(pathParts[len(pathParts)-1], 10, 32)
-				if err != nil {
-					glog.Warningf("unable to parse ASN")
-				}
+	// Skip annotation if we're not connected to bird yet
+	if c.con == nil {
+		return nil, fmt.Errorf("BIRD is not connected yet")
+	}
 
-				NHAS, err := strconv.ParseUint(pathParts[0], 10, 32)
-				if err != nil {
-					glog.Warningf("unable to parse next hop ASN")
-				}
+	c.con.SetDeadline(time.Now().Add(replyTimeout))
+	if _, err := c.con.Write([]byte(q)); err != nil {
+		c.reconnect()
+		return nil, err
+	}
 
-				res.AS = uint32(AS)
-				res.NHAS = uint32(NHAS)
-				break
-			}
+	res, err := readReply(c.reader)
+	if err != nil {
+		if _, ok := err.(*replyError); !ok {
+			c.reconnect()
 		}
-		if res.AS == 0 && a.debug > 2 {
-			glog.Warningf("unable to find AS path for '%v'", query)
-		}
-		query.retCh <- &res
+		return nil, err
 	}
+
+	return res, nil
 }
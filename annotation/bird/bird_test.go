@@ -0,0 +1,343 @@
+package bird
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// bird2Reply is the reply of BIRD 2 to "show route all for 198.51.100.1 table master4"
+const bird2Reply = "1007-Table master4:\n" +
+	"1007-198.51.100.0/24     unicast [nf_192_0_2_1 2020-01-01] * (100) [AS64500i]\n" +
+	" \tvia 192.0.2.254 on eth0\n" +
+	"1008-\tType: BGP univ\n" +
+	"1012-\tBGP.origin: IGP\n" +
+	" \tBGP.as_path: 64496 64499 { 64500 64501 }\n" +
+	" \tBGP.next_hop: 192.0.2.254\n" +
+	" \tBGP.local_pref: 100\n" +
+	" \tBGP.community: (64496,1) (64496,200)\n" +
+	" \tBGP.large_community: (64496, 1, 2)\n" +
+	"1007-                    unicast [nf_192_0_2_2 2020-01-01] (100) [AS64502i]\n" +
+	" \tvia 192.0.2.253 on eth0\n" +
+	"1008-\tType: BGP univ\n" +
+	"1012-\tBGP.origin: IGP\n" +
+	" \tBGP.as_path: 64497 64502\n" +
+	"0000 \n"
+
+// bird1Reply is the reply of BIRD 1 to "show route all for 2001:db8::1 protocol nf_192_0_2_1"
+const bird1Reply = "1007-2001:db8::/32 via 2001:db8:ffff::1 on eth0 [nf_192_0_2_1 12:00:00] * (100) [AS64500i]\n" +
+	"1008-\tType: BGP unicast univ\n" +
+	"1012-\tBGP.origin: IGP\n" +
+	" \tBGP.as_path: 64500\n" +
+	"0000 \n"
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		expected *QueryResult
+		wantErr  bool
+	}{
+		{
+			name:  "BIRD 2",
+			reply: bird2Reply,
+			expected: &QueryResult{
+				Pfx:         net.IPNet{IP: net.IP{198, 51, 100, 0}, Mask: net.CIDRMask(24, 32)},
+				AS:          64500,
+				NHAS:        64496,
+				ASPath:      []uint32{64496, 64499, 64500},
+				Communities: []string{"64496:1", "64496:200", "64496:1:2"},
+			},
+		},
+		{
+			name:  "BIRD 1",
+			reply: bird1Reply,
+			expected: &QueryResult{
+				Pfx:    net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)},
+				AS:     64500,
+				NHAS:   64500,
+				ASPath: []uint32{64500},
+			},
+		},
+		{
+			name:     "Network not found",
+			reply:    "8001 Network not found\n",
+			expected: &QueryResult{},
+		},
+		{
+			name:     "Route count",
+			reply:    "0014 3 of 4 routes for 2 networks in table master4\n",
+			expected: &QueryResult{networks: 2, count: "3 of 4 routes for 2 networks in table master4"},
+		},
+		{
+			name:    "Syntax error",
+			reply:   "9001 syntax error, unexpected CF_SYM_UNDEFINED\n",
+			wantErr: true,
+		},
+		{
+			name:    "Truncated",
+			reply:   bird1Reply[:60],
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		res, err := readReply(bufio.NewReader(strings.NewReader(test.reply)))
+		if test.wantErr {
+			assert.NotNil(t, err, test.name)
+			continue
+		}
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expected, res, test.name)
+	}
+}
+
+// serveBIRD answers queries on `l` with the replies of `replies` and records the queries
+func serveBIRD(l net.Listener, replies map[string]string, queries chan<- string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			conn.Write([]byte("0001 BIRD 2.0.7 ready.\n"))
+
+			r := bufio.NewReader(conn)
+			for {
+				q, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				q = strings.TrimSpace(q)
+				queries <- q
+
+				reply, ok := replies[q]
+				if !ok {
+					reply = "8001 Network not found\n"
+				}
+				conn.Write([]byte(reply))
+			}
+		}(conn)
+	}
+}
+
+// testBIRD serves `replies` on a BIRD socket in a temporary directory. It returns the socket, the
+// queries received and a function stopping the server.
+func testBIRD(t *testing.T, replies map[string]string) (string, chan string, func()) {
+	dir, err := ioutil.TempDir("", "bird")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(dir, "bird.ctl")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	queries := make(chan string, 16)
+	go serveBIRD(l, replies, queries)
+
+	return sock, queries, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// waitConnected waits for the connection of `a` to BIRD
+func waitConnected(a *Annotator) {
+	for i := 0; i < 100; i++ {
+		a.bird4.lock.RLock()
+		connected := a.bird4.con != nil
+		a.bird4.lock.RUnlock()
+		if connected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAnnotateBIRD2(t *testing.T) {
+	sock, queries, stop := testBIRD(t, map[string]string{
+		"show route all for 198.51.100.1 table master4 protocol nf_192_0_2_1":     bird2Reply,
+		"show route in 198.51.100.0/24 table master4 protocol nf_192_0_2_1 count": "0014 1 of 2 routes for 1 networks in table master4\n",
+		"show route all for 203.0.113.1 table master4 protocol nf_192_0_2_1": "1007-203.0.113.0/24 unicast [nf_192_0_2_1 2020-01-01] * (100) [AS64501i]\n" +
+			"1012-\tBGP.as_path: 64501\n" +
+			"0000 \n",
+		"show route in 203.0.113.0/24 table master4 protocol nf_192_0_2_1 count": "0014 2 of 2 routes for 2 networks in table master4\n",
+	})
+	defer stop()
+
+	a, err := NewAnnotator(config.Annotator{
+		BIRDSocket:     sock,
+		BIRDVersion:    2,
+		BIRDTable4:     "master4",
+		BIRDTable6:     "master6",
+		BIRDQuery:      "show route all for {addr} table {table} protocol nf_{router}",
+		BIRDCountQuery: "show route in {prefix} table {table} protocol nf_{router} count",
+		CacheSize:      16,
+		CacheTTL:       60,
+	}, []config.Agent{
+		{
+			Name:      "rtr02",
+			IPAddress: "192.0.2.2",
+			BIRDQuery: "show route all for {addr} import table {agent}.{channel}",
+		},
+	}, 0)
+	if err != nil {
+		t.Fatalf("Unable to create annotator: %v", err)
+	}
+
+	waitConnected(a)
+
+	fl := &netflow.Flow{
+		Router:  net.ParseIP("192.0.2.1"),
+		SrcAddr: net.ParseIP("198.51.100.1"),
+		DstAddr: net.ParseIP("2001:db8::1"),
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, "show route all for 198.51.100.1 table master4 protocol nf_192_0_2_1", <-queries)
+	assert.Equal(t, "show route in 198.51.100.0/24 table master4 protocol nf_192_0_2_1 count", <-queries)
+	assert.Equal(t, "show route all for 2001:db8::1 table master6 protocol nf_192_0_2_1", <-queries)
+
+	assert.Equal(t, uint32(64500), fl.SrcAs)
+	assert.Equal(t, []uint32{64496, 64499, 64500}, fl.SrcAsPath)
+	assert.Equal(t, []string{"64496:1", "64496:200", "64496:1:2"}, fl.SrcCommunities)
+	assert.Equal(t, "198.51.100.0/24", fl.SrcPfx.ToIPNet().String())
+	assert.Equal(t, uint32(0), fl.DstAs)
+
+	fl = &netflow.Flow{
+		Router:  net.ParseIP("192.0.2.2"),
+		SrcAddr: net.ParseIP("198.51.100.2"),
+		DstAddr: net.ParseIP("2001:db8::2"),
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, "show route all for 198.51.100.2 import table rtr02.ipv4", <-queries)
+	assert.Equal(t, "show route all for 2001:db8::2 import table rtr02.ipv6", <-queries)
+
+	// Agents overriding the query without count query get results cached by address
+	_, pfx, _ := net.ParseCIDR("198.51.100.0/24")
+	assert.Equal(t, "", a.formatCountQuery(net.ParseIP("192.0.2.2"), pfx))
+	assert.NotNil(t, a.cache.Get(net.ParseIP("192.0.2.2"), net.ParseIP("198.51.100.2")))
+
+	// Addresses within cached prefixes without more specific routes are not queried
+	fl = &netflow.Flow{
+		Router:  net.ParseIP("192.0.2.1"),
+		SrcAddr: net.ParseIP("198.51.100.200"),
+		DstAddr: net.ParseIP("2001:db8::1"),
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, uint32(64500), fl.SrcAs)
+	assert.Equal(t, 0, len(queries))
+
+	// Results of prefixes with more specific routes are cached by address
+	fl = &netflow.Flow{
+		Router:  net.ParseIP("192.0.2.1"),
+		SrcAddr: net.ParseIP("203.0.113.1"),
+		DstAddr: net.ParseIP("2001:db8::1"),
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, uint32(64501), fl.SrcAs)
+	assert.Equal(t, "show route all for 203.0.113.1 table master4 protocol nf_192_0_2_1", <-queries)
+	assert.Equal(t, "show route in 203.0.113.0/24 table master4 protocol nf_192_0_2_1 count", <-queries)
+	assert.NotNil(t, a.cache.Get(net.ParseIP("192.0.2.1"), net.ParseIP("203.0.113.1")))
+	assert.Nil(t, a.cache.Get(net.ParseIP("192.0.2.1"), net.ParseIP("203.0.113.2")))
+
+	// Failed queries are not cached
+	a.bird4.lock.Lock()
+	a.bird4.con.Close()
+	a.bird4.con = nil
+	a.bird4.lock.Unlock()
+	fl = &netflow.Flow{
+		Router:  net.ParseIP("192.0.2.1"),
+		SrcAddr: net.ParseIP("198.18.0.1"),
+		DstAddr: net.ParseIP("2001:db8::1"),
+	}
+	assert.NotNil(t, a.Annotate(context.Background(), fl))
+	assert.Nil(t, a.cache.Get(net.ParseIP("192.0.2.1"), net.ParseIP("198.18.0.1")))
+}
+
+func TestCheckRoutes(t *testing.T) {
+	sock, queries, stop := testBIRD(t, map[string]string{
+		"show route table master4 protocol nf_192_0_2_1 count": "0014 2 of 3 routes for 2 networks in table master4\n",
+		"show route table master6 protocol nf_192_0_2_1 count": "0014 1 of 1 routes for 1 networks in table master6\n",
+	})
+	defer stop()
+
+	a, err := NewAnnotator(config.Annotator{
+		BIRDSocket:     sock,
+		BIRDVersion:    2,
+		BIRDTable4:     "master4",
+		BIRDTable6:     "master6",
+		BIRDQuery:      "show route all for {addr} table {table} protocol nf_{router}",
+		BIRDWatchQuery: "show route table {table} protocol nf_{router} count",
+		CacheSize:      16,
+		CacheTTL:       60,
+	}, []config.Agent{
+		{
+			Name:      "rtr02",
+			IPAddress: "192.0.2.2",
+			BIRDQuery: "show route all for {addr} import table {agent}.{channel}",
+		},
+	}, 0)
+	if err != nil {
+		t.Fatalf("Unable to create annotator: %v", err)
+	}
+	waitConnected(a)
+
+	rtr1, rtr2 := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	addr := net.ParseIP("198.51.100.1")
+	count := "2 of 3 routes for 2 networks in table master4|1 of 1 routes for 1 networks in table master6"
+
+	// Results of agents with unknown counts are invalidated. Agents overriding the query
+	// without watch query are not watched.
+	set(a.cache, rtr1, "198.51.100.0/24", 64500)
+	set(a.cache, rtr2, "198.51.100.0/24", 64501)
+	counts := a.checkRoutes(map[string]string{})
+	assert.Equal(t, map[string]string{"192.0.2.1": count}, counts)
+	assert.Equal(t, "show route table master4 protocol nf_192_0_2_1 count", <-queries)
+	assert.Equal(t, "show route table master6 protocol nf_192_0_2_1 count", <-queries)
+	assert.Nil(t, a.cache.Get(rtr1, addr))
+	assert.NotNil(t, a.cache.Get(rtr2, addr))
+
+	// Unchanged counts keep the results
+	set(a.cache, rtr1, "198.51.100.0/24", 64500)
+	counts = a.checkRoutes(counts)
+	assert.Equal(t, map[string]string{"192.0.2.1": count}, counts)
+	assert.NotNil(t, a.cache.Get(rtr1, addr))
+
+	// Changed counts invalidate them
+	a.checkRoutes(map[string]string{"192.0.2.1": "1 of 2 routes for 1 networks in table master4|" +
+		"1 of 1 routes for 1 networks in table master6"})
+	assert.Nil(t, a.cache.Get(rtr1, addr))
+	assert.NotNil(t, a.cache.Get(rtr2, addr))
+}
+
+func TestNewAnnotatorInvalidTemplate(t *testing.T) {
+	_, err := NewAnnotator(config.Annotator{BIRDVersion: 2, BIRDQuery: "show route all"}, nil, 0)
+	assert.NotNil(t, err)
+
+	_, err = NewAnnotator(config.Annotator{BIRDVersion: 2, BIRDQuery: "show route all for {addr}"}, []config.Agent{
+		{Name: "rtr01", IPAddress: "192.0.2.1", BIRDQuery: "show route"},
+	}, 0)
+	assert.NotNil(t, err)
+
+	_, err = NewAnnotator(config.Annotator{BIRDVersion: 2, BIRDQuery: "show route all for {addr}", BIRDCountQuery: "show route count"}, nil, 0)
+	assert.NotNil(t, err)
+
+	_, err = NewAnnotator(config.Annotator{BIRDVersion: 3, BIRDQuery: "show route all for {addr}"}, nil, 0)
+	assert.NotNil(t, err)
+}
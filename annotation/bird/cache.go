@@ -0,0 +1,165 @@
+package bird
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/lpm"
+	"github.com/bio-routing/tflow2/stats"
+)
+
+// QueryCache caches QueryResults per agent by prefix. It holds at most `size` results and evicts
+// the least recently used results first. Results expire after `ttl` unless the results of their
+// agent are invalidated before.
+type QueryCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	// tables are the lpm.Tables of the *list.Element of entries per agent
+	tables map[string]*lpm.Table
+
+	// entries are the *list.Element of entries by agent and prefix
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+	lock    sync.Mutex
+}
+
+// cacheKey identifies a cached result
+type cacheKey struct {
+	rtr string
+	pfx string
+}
+
+// cacheEntry is a cached result
+type cacheEntry struct {
+	rtr     string
+	pfx     *net.IPNet
+	res     QueryResult
+	expires time.Time
+}
+
+// newQueryCache creates and initializes a new `QueryCache`
+func newQueryCache(size int, ttl time.Duration) *QueryCache {
+	return &QueryCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		tables:  make(map[string]*lpm.Table),
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the cached result of the most specific prefix containing `addr` for agent `rtr`
+func (qc *QueryCache) Get(rtr net.IP, addr net.IP) *QueryResult {
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+
+	if t, ok := qc.tables[rtr.String()]; ok {
+		if _, v, ok := t.Lookup(addr); ok {
+			el := v.(*list.Element)
+			e := el.Value.(*cacheEntry)
+			if qc.now().Before(e.expires) {
+				qc.lru.MoveToFront(el)
+				atomic.AddUint64(&stats.GlobalStats.BirdCacheHits, 1)
+				res := e.res
+				return &res
+			}
+			qc.remove(el)
+		}
+	}
+
+	atomic.AddUint64(&stats.GlobalStats.BirdCacheMiss, 1)
+	return nil
+}
+
+// Set caches `qres` for addresses within `pfx` of agent `rtr`. Callers must make sure no more
+// specific prefix within `pfx` exists, e.g. by using host prefixes.
+func (qc *QueryCache) Set(rtr net.IP, pfx *net.IPNet, qres *QueryResult) {
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+
+	key := cacheKey{rtr: rtr.String(), pfx: pfx.String()}
+	if el, ok := qc.entries[key]; ok {
+		qc.remove(el)
+	}
+
+	t, ok := qc.tables[key.rtr]
+	if !ok {
+		t = lpm.New()
+		qc.tables[key.rtr] = t
+	}
+
+	el := qc.lru.PushFront(&cacheEntry{
+		rtr:     key.rtr,
+		pfx:     pfx,
+		res:     *qres,
+		expires: qc.now().Add(qc.ttl),
+	})
+	t.Insert(pfx, el)
+	qc.entries[key] = el
+	atomic.AddUint64(&stats.GlobalStats.BirdCacheSize, 1)
+
+	for qc.lru.Len() > qc.size {
+		qc.remove(qc.lru.Back())
+		atomic.AddUint64(&stats.GlobalStats.BirdCacheEvicted, 1)
+	}
+}
+
+// Agents returns the agents with cached results
+func (qc *QueryCache) Agents() []net.IP {
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+
+	agents := make([]net.IP, 0, len(qc.tables))
+	for rtr := range qc.tables {
+		agents = append(agents, net.ParseIP(rtr))
+	}
+	return agents
+}
+
+// Invalidate removes the cached results of agent `rtr`. It returns the number of removed results.
+func (qc *QueryCache) Invalidate(rtr net.IP) int {
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+
+	key := rtr.String()
+	n := 0
+	for el := qc.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*cacheEntry).rtr == key {
+			qc.remove(el)
+			n++
+		}
+		el = next
+	}
+
+	atomic.AddUint64(&stats.GlobalStats.BirdCacheFlushed, uint64(n))
+	return n
+}
+
+// remove removes the entry of `el`
+func (qc *QueryCache) remove(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	qc.lru.Remove(el)
+	delete(qc.entries, cacheKey{rtr: e.rtr, pfx: e.pfx.String()})
+
+	t := qc.tables[e.rtr]
+	t.Delete(e.pfx)
+	if t.Len() == 0 {
+		delete(qc.tables, e.rtr)
+	}
+	atomic.AddUint64(&stats.GlobalStats.BirdCacheSize, ^uint64(0))
+}
+
+// Len returns the number of cached results
+func (qc *QueryCache) Len() int {
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+
+	return qc.lru.Len()
+}
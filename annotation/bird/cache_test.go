@@ -0,0 +1,110 @@
+package bird
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+// set caches a QueryResult of prefix `pfx` originated by `as` for agent `rtr`
+func set(qc *QueryCache, rtr net.IP, pfx string, as uint32) {
+	_, n, _ := net.ParseCIDR(pfx)
+	qc.Set(rtr, n, &QueryResult{Pfx: *n, AS: as})
+}
+
+func TestQueryCache(t *testing.T) {
+	rtr1, rtr2 := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	qc := newQueryCache(16, time.Minute)
+
+	set(qc, rtr1, "198.51.100.0/24", 64500)
+	set(qc, rtr1, "198.51.100.128/25", 64501)
+	set(qc, rtr1, "2001:db8::/32", 64502)
+	set(qc, rtr2, "198.51.100.0/24", 64503)
+
+	// Results without prefix are cached for the address only
+	qc.Set(rtr1, hostPrefix(net.ParseIP("203.0.113.1")), &QueryResult{})
+
+	tests := []struct {
+		rtr      net.IP
+		addr     string
+		expected uint32
+		hit      bool
+	}{
+		{rtr: rtr1, addr: "198.51.100.2", expected: 64500, hit: true},
+		{rtr: rtr1, addr: "198.51.100.200", expected: 64501, hit: true},
+		{rtr: rtr1, addr: "2001:db8:1::1", expected: 64502, hit: true},
+		{rtr: rtr2, addr: "198.51.100.200", expected: 64503, hit: true},
+		{rtr: rtr1, addr: "203.0.113.1", expected: 0, hit: true},
+		{rtr: rtr1, addr: "203.0.113.2"},
+		{rtr: rtr2, addr: "2001:db8::1"},
+	}
+
+	for _, test := range tests {
+		res := qc.Get(test.rtr, net.ParseIP(test.addr))
+		if !test.hit {
+			assert.Nilf(t, res, "%s via %s", test.addr, test.rtr)
+			continue
+		}
+		if assert.NotNilf(t, res, "%s via %s", test.addr, test.rtr) {
+			assert.Equalf(t, test.expected, res.AS, "%s via %s", test.addr, test.rtr)
+		}
+	}
+
+	// Replaced results
+	set(qc, rtr1, "198.51.100.0/24", 64504)
+	assert.Equal(t, uint32(64504), qc.Get(rtr1, net.ParseIP("198.51.100.2")).AS)
+	assert.Equal(t, 5, qc.Len())
+}
+
+func TestQueryCacheExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rtr := net.ParseIP("192.0.2.1")
+	qc := newQueryCache(16, time.Minute)
+	qc.now = func() time.Time { return now }
+
+	set(qc, rtr, "198.51.100.0/24", 64500)
+	now = now.Add(30 * time.Second)
+	set(qc, rtr, "198.51.0.0/16", 64501)
+
+	now = now.Add(40 * time.Second)
+	assert.Nil(t, qc.Get(rtr, net.ParseIP("198.51.100.1")), "expired result")
+	assert.Equal(t, 1, qc.Len())
+	assert.Equal(t, uint32(64501), qc.Get(rtr, net.ParseIP("198.51.100.1")).AS, "covering prefix")
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	rtr := net.ParseIP("192.0.2.1")
+	qc := newQueryCache(2, time.Minute)
+	evicted := stats.GlobalStats.BirdCacheEvicted
+
+	set(qc, rtr, "198.51.100.0/24", 64500)
+	set(qc, rtr, "203.0.113.0/24", 64501)
+	qc.Get(rtr, net.ParseIP("198.51.100.1"))
+	set(qc, rtr, "192.0.2.0/24", 64502)
+
+	assert.Equal(t, 2, qc.Len())
+	assert.NotNil(t, qc.Get(rtr, net.ParseIP("198.51.100.1")))
+	assert.Nil(t, qc.Get(rtr, net.ParseIP("203.0.113.1")), "least recently used result is evicted")
+	assert.NotNil(t, qc.Get(rtr, net.ParseIP("192.0.2.100")))
+	assert.Equal(t, evicted+1, stats.GlobalStats.BirdCacheEvicted)
+}
+
+func TestQueryCacheInvalidate(t *testing.T) {
+	rtr1, rtr2 := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	qc := newQueryCache(16, time.Minute)
+
+	set(qc, rtr1, "198.51.100.0/24", 64500)
+	set(qc, rtr1, "2001:db8::/32", 64501)
+	set(qc, rtr2, "198.51.100.0/24", 64502)
+	assert.Equal(t, 2, len(qc.Agents()))
+
+	assert.Equal(t, 2, qc.Invalidate(rtr1))
+	assert.Nil(t, qc.Get(rtr1, net.ParseIP("198.51.100.1")))
+	assert.Nil(t, qc.Get(rtr1, net.ParseIP("2001:db8::1")))
+	assert.NotNil(t, qc.Get(rtr2, net.ParseIP("198.51.100.1")))
+	assert.Equal(t, []net.IP{rtr2}, qc.Agents())
+	assert.Equal(t, 1, qc.Len())
+}
@@ -0,0 +1,174 @@
+package bird
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Reply codes of the BIRD control socket
+const (
+	codeRoute           = "1007"
+	codeRouteCount      = "0014"
+	codeNetworkNotFound = "8001"
+)
+
+// replyError is an error BIRD replied with, e.g. a syntax error of a query
+type replyError struct {
+	code string
+	msg  string
+}
+
+func (e *replyError) Error() string {
+	return fmt.Sprintf("BIRD replied %s %s", e.code, e.msg)
+}
+
+// readReply reads a reply from `r` and extracts the prefix, AS path and communities of the
+// first (preferred) route or the number of networks of a count query. Lines of a reply start with a four digit code followed by a dash,
+// or by a space in the last line. Lines starting with a space continue the previous code.
+func readReply(r *bufio.Reader) (*QueryResult, error) {
+	res := &QueryResult{}
+	code := ""
+	routes := 0
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		content := ""
+		switch {
+		case len(line) >= 5 && isCode(line[:4]) && (line[4] == '-' || line[4] == ' '):
+			code, content = line[:4], line[5:]
+			if line[4] == ' ' {
+				if code == codeRouteCount {
+					res.networks = parseCount(content)
+					res.count = content
+				}
+				return res, finalError(code, content)
+			}
+		case strings.HasPrefix(line, " "):
+			content = line[1:]
+		default:
+			return nil, fmt.Errorf("Unexpected line %q", line)
+		}
+
+		// Routes are listed with a prefix and the protocol in brackets. Further routes of the
+		// prefix are listed without prefix.
+		if code == codeRoute && strings.Contains(content, "[") {
+			routes++
+			if routes == 1 {
+				fields := strings.Fields(content)
+				if len(fields) > 0 {
+					if _, pfx, err := net.ParseCIDR(fields[0]); err == nil {
+						res.Pfx = *pfx
+					}
+				}
+			}
+			continue
+		}
+		if routes != 1 {
+			continue
+		}
+
+		content = strings.TrimSpace(content)
+		switch {
+		case strings.HasPrefix(content, "BGP.as_path:"):
+			res.ASPath = parseASPath(strings.TrimPrefix(content, "BGP.as_path:"))
+			if len(res.ASPath) > 0 {
+				res.NHAS = res.ASPath[0]
+				res.AS = res.ASPath[len(res.ASPath)-1]
+			}
+		case strings.HasPrefix(content, "BGP.community:"):
+			res.Communities = append(res.Communities, parseCommunities(strings.TrimPrefix(content, "BGP.community:"))...)
+		case strings.HasPrefix(content, "BGP.large_community:"):
+			res.Communities = append(res.Communities, parseCommunities(strings.TrimPrefix(content, "BGP.large_community:"))...)
+		}
+	}
+}
+
+// isCode checks if `s` is a reply code
+func isCode(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// finalError returns the error of the last line of a reply. Runtime (8xxx) and syntax (9xxx)
+// errors are returned as *replyError, except for networks not found.
+func finalError(code string, msg string) error {
+	if code == codeNetworkNotFound || (code[0] != '8' && code[0] != '9') {
+		return nil
+	}
+	return &replyError{code: code, msg: msg}
+}
+
+// parseCount parses the number of networks of a route count like "3 of 4 routes for 2 networks".
+// It returns -1 if the count can not be parsed.
+func parseCount(s string) int {
+	fields := strings.Fields(s)
+	for i := 1; i < len(fields); i++ {
+		if fields[i] != "networks" {
+			continue
+		}
+		n, err := strconv.Atoi(fields[i-1])
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+	return -1
+}
+
+// parseASPath parses an AS path like "64496 64500 { 64501 64502 }". Of AS sets only the first AS is kept.
+func parseASPath(s string) []uint32 {
+	var path []uint32
+	inSet, setDone := false, false
+	for _, f := range strings.Fields(s) {
+		switch f {
+		case "{":
+			inSet, setDone = true, false
+			continue
+		case "}":
+			inSet = false
+			continue
+		}
+		if inSet && setDone {
+			continue
+		}
+
+		as, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			continue
+		}
+		path = append(path, uint32(as))
+		setDone = inSet
+	}
+	return path
+}
+
+// parseCommunities parses communities like "(64496,1) (64496,2)" or large communities like
+// "(64496, 1, 2)" into the form a:b or a:b:c
+func parseCommunities(s string) []string {
+	var communities []string
+	for _, c := range strings.Split(s, ")") {
+		c = strings.TrimSpace(c)
+		if !strings.HasPrefix(c, "(") {
+			continue
+		}
+
+		parts := strings.Split(c[1:], ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		communities = append(communities, strings.Join(parts, ":"))
+	}
+	return communities
+}
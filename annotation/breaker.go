@@ -0,0 +1,89 @@
+package annotation
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker. It opens after a number of consecutive failures and lets
+// a single probe pass per probe interval until a probe succeeds.
+type breaker struct {
+	threshold     int
+	probeInterval time.Duration
+	now           func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	probing  bool
+	probeAt  time.Time
+}
+
+func newBreaker(threshold int, probeInterval time.Duration) *breaker {
+	return &breaker{
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		now:           time.Now,
+	}
+}
+
+// allow checks if a call may pass and if it is the probe of an open breaker
+func (b *breaker) allow() (allowed bool, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true, false
+	}
+
+	if b.probing || b.now().Before(b.probeAt) {
+		return false, false
+	}
+
+	b.probing = true
+	return true, true
+}
+
+// record records the result of a call that was allowed to pass, `probe` as given by allow.
+// It returns true if the breaker opened or closed because of it. While the breaker is open only
+// the result of the probe counts, calls allowed before it opened are ignored.
+func (b *breaker) record(err error, probe bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open && !probe {
+		return false
+	}
+
+	if err == nil {
+		b.failures = 0
+		b.probing = false
+		if b.open {
+			b.open = false
+			return true
+		}
+		return false
+	}
+
+	b.failures++
+	if b.open {
+		b.probing = false
+		b.probeAt = b.now().Add(b.probeInterval)
+		return false
+	}
+
+	if b.failures >= b.threshold {
+		b.open = true
+		b.probeAt = b.now().Add(b.probeInterval)
+		return true
+	}
+	return false
+}
+
+// isOpen checks if the breaker is open
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open
+}
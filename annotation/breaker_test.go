@@ -0,0 +1,62 @@
+package annotation
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(3, 10*time.Second)
+	now := time.Unix(1500000000, 0)
+	b.now = func() time.Time {
+		return now
+	}
+	fail := fmt.Errorf("failed")
+
+	// Failures below the threshold keep the breaker closed
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, []bool{true, false}, pair(b.allow()))
+		assert.False(t, b.record(fail, false))
+	}
+	assert.Equal(t, []bool{true, false}, pair(b.allow()))
+	assert.False(t, b.record(nil, false))
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, []bool{true, false}, pair(b.allow()))
+		assert.False(t, b.record(fail, false))
+	}
+
+	// A slow call allowed before the breaker opens
+	assert.Equal(t, []bool{true, false}, pair(b.allow()))
+
+	assert.Equal(t, []bool{true, false}, pair(b.allow()))
+	assert.True(t, b.record(fail, false))
+	assert.True(t, b.isOpen())
+	assert.Equal(t, []bool{false, false}, pair(b.allow()))
+
+	// A single probe passes per probe interval
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, []bool{true, true}, pair(b.allow()))
+	assert.Equal(t, []bool{false, false}, pair(b.allow()))
+
+	// The slow call failing does not let another probe pass
+	assert.False(t, b.record(fail, false))
+	assert.Equal(t, []bool{false, false}, pair(b.allow()))
+
+	assert.False(t, b.record(fail, true))
+	assert.Equal(t, []bool{false, false}, pair(b.allow()))
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, []bool{true, true}, pair(b.allow()))
+	assert.True(t, b.record(nil, true))
+	assert.False(t, b.isOpen())
+	assert.Equal(t, []bool{true, false}, pair(b.allow()))
+}
+
+// pair returns `a` and `b` as slice to compare both return values of a call
+func pair(a, b bool) []bool {
+	return []bool{a, b}
+}
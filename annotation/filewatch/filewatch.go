@@ -0,0 +1,107 @@
+// Package filewatch reloads files of annotators when they change
+package filewatch
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Watcher loads a set of files and reloads them when any of them changes. Files are considered
+// changed when their modification time or size differs from when they were loaded.
+type Watcher struct {
+	name  string
+	files []string
+	load  func(files []string) error
+
+	// stamps identify the versions of the files loaded
+	stamps map[string]stamp
+	lock   sync.Mutex
+}
+
+// stamp identifies a version of a file
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New creates a Watcher loading `files` with `load`. The files are reloaded when they change,
+// checked every `interval`. Failed reloads keep the previous version and are logged as reloads
+// of `name`.
+func New(name string, files []string, interval time.Duration, load func(files []string) error) (*Watcher, error) {
+	w := &Watcher{
+		name:   name,
+		files:  files,
+		load:   load,
+		stamps: make(map[string]stamp),
+	}
+
+	if err := w.Load(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go w.watch(interval)
+	}
+	return w, nil
+}
+
+// watch reloads the files when they changed
+func (w *Watcher) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !w.Changed() {
+			continue
+		}
+
+		if err := w.Load(); err != nil {
+			glog.Errorf("Unable to reload %s. Keeping previous version: %v", w.name, err)
+			continue
+		}
+		glog.Infof("Reloaded %s", w.name)
+	}
+}
+
+// Changed checks if any of the files changed since they were loaded
+func (w *Watcher) Changed() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, f := range w.files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+
+		if w.stamps[f] != (stamp{modTime: fi.ModTime(), size: fi.Size()}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load loads all files
+func (w *Watcher) Load() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	stamps := make(map[string]stamp)
+	for _, f := range w.files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to stat %s", f)
+		}
+		stamps[f] = stamp{modTime: fi.ModTime(), size: fi.Size()}
+	}
+
+	if err := w.load(w.files); err != nil {
+		return err
+	}
+	w.stamps = stamps
+	return nil
+}
@@ -0,0 +1,57 @@
+package filewatch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filewatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := filepath.Join(dir, "prefixes.csv")
+	ioutil.WriteFile(f, []byte("foo"), 0644)
+
+	var loaded string
+	w, err := New("prefixes", []string{f}, 0, func(files []string) error {
+		data, err := ioutil.ReadFile(files[0])
+		if err != nil {
+			return err
+		}
+		if string(data) == "broken" {
+			return fmt.Errorf("Broken file")
+		}
+		loaded = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unable to create watcher: %v", err)
+	}
+	assert.Equal(t, "foo", loaded)
+	assert.False(t, w.Changed())
+
+	// Failed loads keep the file changed
+	ioutil.WriteFile(f, []byte("broken"), 0644)
+	assert.True(t, w.Changed())
+	assert.NotNil(t, w.Load())
+	assert.True(t, w.Changed())
+	assert.Equal(t, "foo", loaded)
+
+	ioutil.WriteFile(f, []byte("foobar"), 0644)
+	assert.Nil(t, w.Load())
+	assert.False(t, w.Changed())
+	assert.Equal(t, "foobar", loaded)
+
+	_, err = New("prefixes", []string{filepath.Join(dir, "missing.csv")}, 0, func(files []string) error {
+		return nil
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,137 @@
+// Package geoip annotates flows with countries, cities and AS numbers from MaxMind DB files
+package geoip
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/annotation/filewatch"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Annotator adds the country and city of source and destination addresses to flows using
+// MaxMind DB files of the country, city or ASN editions. AS numbers of ASN editions are only
+// added to flows without AS numbers.
+type Annotator struct {
+	// files are reloaded when they change
+	files *filewatch.Watcher
+
+	// readers are the []*reader of the files
+	readers atomic.Value
+}
+
+// location is the information about an IP address of a database
+type location struct {
+	country string
+	city    string
+	as      uint32
+}
+
+// New creates an annotator using the MaxMind DB files `files`. Files replaced are
+// reloaded, checked every `reloadInterval`.
+func New(files []string, reloadInterval time.Duration) (*Annotator, error) {
+	a := &Annotator{}
+
+	w, err := filewatch.New("MaxMind databases", files, reloadInterval, a.load)
+	if err != nil {
+		return nil, err
+	}
+	a.files = w
+	return a, nil
+}
+
+// Annotate adds the locations of the source and destination addresses to `fl`
+func (a *Annotator) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	for _, r := range a.readers.Load().([]*reader) {
+		src, err := r.locate(fl.SrcAddr)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to look up %s", net.IP(fl.SrcAddr))
+		}
+		dst, err := r.locate(fl.DstAddr)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to look up %s", net.IP(fl.DstAddr))
+		}
+
+		if src.country != "" {
+			fl.SrcCountry = src.country
+		}
+		if src.city != "" {
+			fl.SrcCity = src.city
+		}
+		if fl.SrcAs == 0 {
+			fl.SrcAs = src.as
+		}
+
+		if dst.country != "" {
+			fl.DstCountry = dst.country
+		}
+		if dst.city != "" {
+			fl.DstCity = dst.city
+		}
+		if fl.DstAs == 0 {
+			fl.DstAs = dst.as
+		}
+	}
+	return nil
+}
+
+// locate looks up the location of `ip`
+func (r *reader) locate(ip net.IP) (location, error) {
+	var loc location
+	if ip == nil {
+		return loc, nil
+	}
+
+	off, ok, err := r.lookup(ip)
+	if err != nil || !ok {
+		return loc, err
+	}
+
+	country, err := r.data.find(off, "country", "iso_code")
+	if err != nil {
+		return loc, err
+	}
+	if country == nil {
+		if country, err = r.data.find(off, "registered_country", "iso_code"); err != nil {
+			return loc, err
+		}
+	}
+	loc.country, _ = country.(string)
+
+	city, err := r.data.find(off, "city", "names", "en")
+	if err != nil {
+		return loc, err
+	}
+	loc.city, _ = city.(string)
+
+	as, err := r.data.find(off, "autonomous_system_number")
+	if err != nil {
+		return loc, err
+	}
+	if as, ok := as.(uint64); ok {
+		loc.as = uint32(as)
+	}
+
+	return loc, nil
+}
+
+// load loads all files and replaces the readers
+func (a *Annotator) load(files []string) error {
+	readers := make([]*reader, 0, len(files))
+
+	for _, f := range files {
+		r, err := openReader(f)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read %s", f)
+		}
+		glog.Infof("Loaded MaxMind database %s (%s)", f, r.dbType)
+		readers = append(readers, r)
+	}
+
+	a.readers.Store(readers)
+	return nil
+}
@@ -0,0 +1,271 @@
+package geoip
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeCtrl encodes the control byte(s) of a value of type `typ` and size `size`
+func encodeCtrl(typ int, size int) []byte {
+	var b []byte
+	if typ > 7 {
+		b = []byte{0, byte(typ - 7)}
+	} else {
+		b = []byte{byte(typ << 5)}
+	}
+
+	switch {
+	case size < 29:
+		b[0] |= byte(size)
+	case size < 285:
+		b[0] |= 29
+		b = append(b, byte(size-29))
+	default:
+		b[0] |= 30
+		b = append(b, byte((size-285)>>8), byte(size-285))
+	}
+	return b
+}
+
+// encodeValue encodes `v` as value of a data section
+func encodeValue(v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(encodeCtrl(typeString, len(v)), v...)
+	case uint16:
+		return append(encodeCtrl(typeUint16, 2), byte(v>>8), byte(v))
+	case uint32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return append(encodeCtrl(typeUint32, 4), b...)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b := encodeCtrl(typeMap, len(v))
+		for _, k := range keys {
+			b = append(b, encodeValue(k)...)
+			b = append(b, encodeValue(v[k])...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+type testNode struct {
+	children [2]*testNode
+	id       int
+	leaf     bool
+	offset   int
+}
+
+// testDB builds an IPv6 MaxMind DB with records of `recordSize` bits. IPv4 prefixes are
+// stored in the IPv4 subtree.
+func testDB(recordSize int, records map[string]map[string]interface{}) []byte {
+	root := &testNode{}
+	var data []byte
+
+	pfxs := make([]string, 0, len(records))
+	for pfx := range records {
+		pfxs = append(pfxs, pfx)
+	}
+	sort.Strings(pfxs)
+
+	for _, pfx := range pfxs {
+		_, n, _ := net.ParseCIDR(pfx)
+		ones, _ := n.Mask.Size()
+		ip := n.IP.To16()
+		if n.IP.To4() != nil {
+			ip = make(net.IP, 16)
+			copy(ip[12:], n.IP.To4())
+			ones += 96
+		}
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &testNode{}
+			}
+			node = node.children[bit]
+		}
+		node.leaf = true
+		node.offset = len(data)
+		data = append(data, encodeValue(records[pfx])...)
+	}
+
+	// Number the inner nodes
+	nodes := []*testNode{root}
+	for i := 0; i < len(nodes); i++ {
+		nodes[i].id = i
+		for _, c := range nodes[i].children {
+			if c != nil && !c.leaf {
+				nodes = append(nodes, c)
+			}
+		}
+	}
+
+	var tree []byte
+	for _, n := range nodes {
+		var rec [2]uint32
+		for i, c := range n.children {
+			switch {
+			case c == nil:
+				rec[i] = uint32(len(nodes))
+			case c.leaf:
+				rec[i] = uint32(len(nodes) + dataSectionSeparator + c.offset)
+			default:
+				rec[i] = uint32(c.id)
+			}
+		}
+
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(rec[0]>>16), byte(rec[0]>>8), byte(rec[0]), byte(rec[1]>>16), byte(rec[1]>>8), byte(rec[1]))
+		case 28:
+			tree = append(tree, byte(rec[0]>>16), byte(rec[0]>>8), byte(rec[0]), byte(rec[0]>>20)&0xf0|byte(rec[1]>>24)&0x0f,
+				byte(rec[1]>>16), byte(rec[1]>>8), byte(rec[1]))
+		case 32:
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint32(b, rec[0])
+			binary.BigEndian.PutUint32(b[4:], rec[1])
+			tree = append(tree, b...)
+		}
+	}
+
+	db := append(tree, make([]byte, dataSectionSeparator)...)
+	db = append(db, data...)
+	db = append(db, metadataMarker...)
+	return append(db, encodeValue(map[string]interface{}{
+		"node_count":    uint32(len(nodes)),
+		"record_size":   uint16(recordSize),
+		"ip_version":    uint16(6),
+		"database_type": "Test",
+	})...)
+}
+
+var cityRecords = map[string]map[string]interface{}{
+	"192.0.2.0/24": {
+		"country": map[string]interface{}{"iso_code": "DE"},
+		"city":    map[string]interface{}{"names": map[string]interface{}{"de": "Frankfurt am Main", "en": "Frankfurt"}},
+	},
+	"198.51.100.0/24": {
+		"registered_country": map[string]interface{}{"iso_code": "NL"},
+	},
+	"2001:db8::/32": {
+		"country": map[string]interface{}{"iso_code": "US"},
+	},
+}
+
+func TestReader(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		r, err := newReader(testDB(recordSize, cityRecords))
+		if err != nil {
+			t.Fatalf("Unable to read database with record size %d: %v", recordSize, err)
+		}
+		assert.Equal(t, "Test", r.dbType)
+
+		tests := []struct {
+			ip       string
+			expected location
+		}{
+			{ip: "192.0.2.1", expected: location{country: "DE", city: "Frankfurt"}},
+			{ip: "198.51.100.1", expected: location{country: "NL"}},
+			{ip: "2001:db8::1", expected: location{country: "US"}},
+			{ip: "203.0.113.1"},
+			{ip: "2001:db9::1"},
+		}
+
+		for _, test := range tests {
+			loc, err := r.locate(net.ParseIP(test.ip))
+			assert.Nilf(t, err, "%s (%d)", test.ip, recordSize)
+			assert.Equalf(t, test.expected, loc, "%s (%d)", test.ip, recordSize)
+		}
+	}
+
+	_, err := newReader([]byte("not a database"))
+	assert.NotNil(t, err)
+}
+
+func TestDecoderPointer(t *testing.T) {
+	// {"a": "x"} followed by {"b": <pointer to offset 0>}
+	b := encodeValue(map[string]interface{}{"a": "x"})
+	b = append(b, encodeCtrl(typeMap, 1)...)
+	b = append(b, encodeValue("b")...)
+	b = append(b, 1<<5, 0)
+	d := decoder{buf: b}
+
+	v, err := d.find(5, "b", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "x", v)
+
+	v, _, err = d.decode(5)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"b": map[string]interface{}{"a": "x"}}, v)
+
+	next, err := d.skip(5)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(len(b)), next)
+}
+
+func TestAnnotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cityFile := filepath.Join(dir, "city.mmdb")
+	asnFile := filepath.Join(dir, "asn.mmdb")
+	ioutil.WriteFile(cityFile, testDB(24, cityRecords), 0644)
+	ioutil.WriteFile(asnFile, testDB(24, map[string]map[string]interface{}{
+		"192.0.2.0/24":    {"autonomous_system_number": uint32(64500)},
+		"198.51.100.0/24": {"autonomous_system_number": uint32(64501)},
+	}), 0644)
+
+	a, err := New([]string{cityFile, asnFile}, 0)
+	if err != nil {
+		t.Fatalf("Unable to create annotator: %v", err)
+	}
+
+	fl := &netflow.Flow{
+		SrcAddr: net.ParseIP("192.0.2.1"),
+		DstAddr: net.ParseIP("198.51.100.1"),
+		DstAs:   64496,
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, "DE", fl.SrcCountry)
+	assert.Equal(t, "Frankfurt", fl.SrcCity)
+	assert.Equal(t, uint32(64500), fl.SrcAs)
+	assert.Equal(t, "NL", fl.DstCountry)
+	assert.Equal(t, "", fl.DstCity)
+	assert.Equal(t, uint32(64496), fl.DstAs)
+
+	// Replaced databases are reloaded
+	tmp := filepath.Join(dir, "city.mmdb.tmp")
+	ioutil.WriteFile(tmp, testDB(28, map[string]map[string]interface{}{
+		"192.0.2.0/24": {"country": map[string]interface{}{"iso_code": "FR"}},
+	}), 0644)
+	os.Rename(tmp, cityFile)
+
+	assert.True(t, a.files.Changed())
+	assert.Nil(t, a.files.Load())
+	assert.False(t, a.files.Changed())
+
+	fl = &netflow.Flow{SrcAddr: net.ParseIP("192.0.2.1")}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, "FR", fl.SrcCountry)
+	assert.Equal(t, "", fl.SrcCity)
+}
@@ -0,0 +1,376 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+// metadataMarker precedes the metadata at the end of a MaxMind DB file
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Data section types of the MaxMind DB format
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// dataSectionSeparator is the number of zero bytes between the search tree and the data section
+const dataSectionSeparator = 16
+
+// reader looks up IP addresses in a MaxMind DB file
+type reader struct {
+	tree       []byte
+	data       decoder
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+
+	// dbType is the database type of the metadata, e.g. GeoLite2-City
+	dbType string
+}
+
+// openReader reads MaxMind DB file `f`
+func openReader(f string) (*reader, error) {
+	buf, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(buf)
+}
+
+// newReader creates a reader of MaxMind DB `buf`
+func newReader(buf []byte) (*reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("Metadata not found")
+	}
+
+	meta := decoder{buf: buf[i+len(metadataMarker):]}
+	v, _, err := meta.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid metadata: %v", err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Invalid metadata")
+	}
+
+	r := &reader{}
+	r.nodeCount, _ = metadataUint(m, "node_count")
+	r.recordSize, _ = metadataUint(m, "record_size")
+	r.ipVersion, _ = metadataUint(m, "ip_version")
+	r.dbType, _ = m["database_type"].(string)
+
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("Unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("Unsupported IP version %d", r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, fmt.Errorf("Search tree exceeds file size")
+	}
+	r.tree = buf[:treeSize]
+	r.data = decoder{buf: buf[treeSize+dataSectionSeparator : i]}
+
+	if r.ipVersion == 6 {
+		for j := 0; j < 96 && r.ipv4Start < r.nodeCount; j++ {
+			r.ipv4Start = r.readNode(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// metadataUint returns the unsigned integer `key` of metadata `m`
+func metadataUint(m map[string]interface{}, key string) (uint, bool) {
+	v, ok := m[key].(uint64)
+	return uint(v), ok
+}
+
+// lookup returns the offset of the record of `ip` in the data section
+func (r *reader) lookup(ip net.IP) (uint, bool, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if ip = ip.To16(); ip == nil || r.ipVersion == 4 {
+		return 0, false, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		node = r.readNode(node, uint(ip[i/8]>>(7-uint(i%8)))&1)
+	}
+
+	if node == r.nodeCount {
+		return 0, false, nil
+	}
+	if node < r.nodeCount {
+		return 0, false, fmt.Errorf("Invalid search tree")
+	}
+
+	offset := node - r.nodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data.buf)) {
+		return 0, false, fmt.Errorf("Invalid data pointer")
+	}
+	return offset, true, nil
+}
+
+// readNode returns the left (`bit` 0) or right (`bit` 1) record of node `node`
+func (r *reader) readNode(node uint, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.tree[node*8+bit*4:]))
+	}
+}
+
+// decoder decodes values of a data section
+type decoder struct {
+	buf []byte
+}
+
+// ctrl decodes the control byte(s) at `off` and returns the type and size of the value
+// and the offset of its payload. Pointers are returned with the offset they point to.
+func (d decoder) ctrl(off uint) (int, uint, uint, error) {
+	if off >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("Unexpected end of data")
+	}
+	c := d.buf[off]
+	off++
+
+	typ := int(c >> 5)
+	if typ == typePointer {
+		n := uint((c>>3)&0x3) + 1
+		if off+n > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("Unexpected end of data")
+		}
+		p := d.uint(off, n)
+		switch n {
+		case 1:
+			p |= uint(c&0x7) << 8
+		case 2:
+			p = (p | uint(c&0x7)<<16) + 2048
+		case 3:
+			p = (p | uint(c&0x7)<<24) + 526336
+		}
+		return typ, p, off + n, nil
+	}
+
+	if typ == typeExtended {
+		if off >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("Unexpected end of data")
+		}
+		typ = 7 + int(d.buf[off])
+		off++
+	}
+
+	size := uint(c & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if off+n > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("Unexpected end of data")
+		}
+		switch n {
+		case 1:
+			size = 29 + d.uint(off, n)
+		case 2:
+			size = 285 + d.uint(off, n)
+		case 3:
+			size = 65821 + d.uint(off, n)
+		}
+		off += n
+	}
+	return typ, size, off, nil
+}
+
+// uint decodes the `n` bytes long big endian unsigned integer at `off`
+func (d decoder) uint(off uint, n uint) uint {
+	v := uint(0)
+	for _, b := range d.buf[off : off+n] {
+		v = v<<8 | uint(b)
+	}
+	return v
+}
+
+// payload returns the `size` bytes at `off`
+func (d decoder) payload(off uint, size uint) ([]byte, error) {
+	if off+size > uint(len(d.buf)) {
+		return nil, fmt.Errorf("Unexpected end of data")
+	}
+	return d.buf[off : off+size], nil
+}
+
+// decode decodes the value at `off` and returns the offset of the next value
+func (d decoder) decode(off uint) (interface{}, uint, error) {
+	typ, size, off, err := d.ctrl(off)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typePointer:
+		v, _, err := d.decode(size)
+		return v, off, err
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var k, v interface{}
+			if k, off, err = d.decode(off); err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("Invalid map key")
+			}
+			if v, off, err = d.decode(off); err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var v interface{}
+			if v, off, err = d.decode(off); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, off, nil
+	case typeBool:
+		return size != 0, off, nil
+	}
+
+	b, err := d.payload(off, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	off += size
+
+	switch typ {
+	case typeString:
+		return string(b), off, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("Invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("Invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("Invalid integer size %d", size)
+		}
+		v := uint64(0)
+		for _, x := range b {
+			v = v<<8 | uint64(x)
+		}
+		return v, off, nil
+	case typeInt32:
+		v := uint32(0)
+		for _, x := range b {
+			v = v<<8 | uint32(x)
+		}
+		return int64(int32(v)), off, nil
+	case typeBytes, typeUint128:
+		return b, off, nil
+	}
+	return nil, 0, fmt.Errorf("Unknown type %d", typ)
+}
+
+// skip returns the offset of the value following the value at `off`
+func (d decoder) skip(off uint) (uint, error) {
+	typ, size, off, err := d.ctrl(off)
+	if err != nil {
+		return 0, err
+	}
+
+	switch typ {
+	case typePointer, typeBool:
+		return off, nil
+	case typeMap:
+		size *= 2
+		fallthrough
+	case typeArray:
+		for i := uint(0); i < size; i++ {
+			if off, err = d.skip(off); err != nil {
+				return 0, err
+			}
+		}
+		return off, nil
+	}
+	return off + size, nil
+}
+
+// find decodes the value at `path` of the map at `off`. It returns nil if the path does not exist.
+func (d decoder) find(off uint, path ...string) (interface{}, error) {
+	for _, key := range path {
+		typ, size, next, err := d.ctrl(off)
+		if err != nil {
+			return nil, err
+		}
+		if typ == typePointer {
+			if typ, size, next, err = d.ctrl(size); err != nil {
+				return nil, err
+			}
+		}
+		if typ != typeMap {
+			return nil, nil
+		}
+
+		off = next
+		found := false
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(off)
+			if err != nil {
+				return nil, err
+			}
+			if k == key {
+				off, found = next, true
+				break
+			}
+			if off, err = d.skip(next); err != nil {
+				return nil, err
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+
+	v, _, err := d.decode(off)
+	return v, err
+}
@@ -0,0 +1,258 @@
+package annotation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Backoff between attempts to open a stream to an annotator
+const (
+	minStreamBackoff = 100 * time.Millisecond
+	maxStreamBackoff = 30 * time.Second
+)
+
+// errReconnecting is returned while a new stream may not be opened yet
+var errReconnecting = fmt.Errorf("Stream is reconnecting")
+
+// grpcAnnotator passes flows to an external annotator implementing the annotator gRPC service.
+// Batches of flows are exchanged over a long lived stream. Unary calls are used if the
+// annotator does not support streaming.
+type grpcAnnotator struct {
+	name   string
+	client netflow.AnnotatorClient
+
+	// unary is set to 1 if batches are not to be streamed
+	unary uint32
+
+	// mu protects stream, nextID and the backoff
+	mu      sync.Mutex
+	stream  *batchStream
+	nextID  uint64
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// batchStream is a stream to an annotator and the batches waiting for their reply.
+// Batches are sent by a goroutine per stream as sending blocks while the annotator
+// is not reading.
+type batchStream struct {
+	stream  netflow.Annotator_AnnotateStreamClient
+	ctx     context.Context
+	cancel  context.CancelFunc
+	batches chan *netflow.FlowBatch
+	pending map[uint64]chan *netflow.FlowBatch
+}
+
+func newGRPCAnnotator(acfg config.Annotator, cfg *config.Config) (Annotator, error) {
+	glog.Infof("Connecting to annotator %s at %s", acfg.Name, acfg.Target)
+	conn, err := grpc.Dial(acfg.Target, grpc.WithInsecure(), grpc.WithBackoffMaxDelay(maxStreamBackoff))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to dial %s", acfg.Target)
+	}
+
+	a := &grpcAnnotator{
+		name:   acfg.Name,
+		client: netflow.NewAnnotatorClient(conn),
+	}
+	if acfg.Unary {
+		a.unary = 1
+	}
+	return a, nil
+}
+
+// Annotate sends `fl` to the external annotator and replaces it with the annotated flow
+func (a *grpcAnnotator) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	res, err := a.client.Annotate(ctx, fl)
+	if err != nil {
+		return err
+	}
+
+	*fl = *res
+	return nil
+}
+
+// AnnotateBatch sends `flows` to the external annotator as one batch and replaces them with the annotated flows.
+// Flows are sent by unary calls if streaming fails, unless `ctx` is done.
+func (a *grpcAnnotator) AnnotateBatch(ctx context.Context, flows []*netflow.Flow) error {
+	if atomic.LoadUint32(&a.unary) == 0 {
+		res, err := a.sendBatch(ctx, flows)
+		if err == nil {
+			for i := range flows {
+				*flows[i] = *res.Flows[i]
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if atomic.LoadUint32(&a.unary) == 0 && err != errReconnecting {
+			glog.Warningf("Unable to stream flows to annotator %s. Using unary calls: %v", a.name, err)
+		}
+	}
+
+	var lastErr error
+	for _, fl := range flows {
+		if err := a.Annotate(ctx, fl); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// sendBatch sends `flows` over the stream and waits for the reply. The stream is reset
+// if `ctx` is done before the reply was received.
+func (a *grpcAnnotator) sendBatch(ctx context.Context, flows []*netflow.Flow) (*netflow.FlowBatch, error) {
+	a.mu.Lock()
+	if a.stream == nil {
+		if time.Now().Before(a.retryAt) {
+			a.mu.Unlock()
+			return nil, errReconnecting
+		}
+		if err := a.openStream(); err != nil {
+			a.failed()
+			a.mu.Unlock()
+			return nil, err
+		}
+	}
+	bs := a.stream
+
+	a.nextID++
+	id := a.nextID
+	ch := make(chan *netflow.FlowBatch, 1)
+	bs.pending[id] = ch
+	a.mu.Unlock()
+
+	select {
+	case bs.batches <- &netflow.FlowBatch{Id: id, Flows: flows}:
+	case <-bs.ctx.Done():
+		return nil, fmt.Errorf("Stream closed")
+	case <-ctx.Done():
+		a.reset(bs)
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("Stream closed")
+		}
+		if len(res.Flows) != len(flows) {
+			return nil, fmt.Errorf("Received %d flows for a batch of %d flows", len(res.Flows), len(flows))
+		}
+		return res, nil
+	case <-ctx.Done():
+		a.reset(bs)
+		return nil, ctx.Err()
+	}
+}
+
+// openStream opens a new stream to the annotator. The caller must hold a.mu.
+func (a *grpcAnnotator) openStream() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := a.client.AnnotateStream(ctx)
+	if err != nil {
+		cancel()
+		return errors.Wrap(err, "Unable to open stream")
+	}
+
+	a.stream = &batchStream{
+		stream:  stream,
+		ctx:     ctx,
+		cancel:  cancel,
+		batches: make(chan *netflow.FlowBatch),
+		pending: make(map[uint64]chan *netflow.FlowBatch),
+	}
+	go a.send(a.stream)
+	go a.receive(a.stream)
+	return nil
+}
+
+// reset closes stream `bs` and delays opening the next stream unless it was replaced already
+func (a *grpcAnnotator) reset(bs *batchStream) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stream == bs {
+		a.failed()
+	}
+	a.closeStream(bs)
+}
+
+// closeStream closes stream `bs`. Batches waiting for their reply fail. The caller must hold a.mu.
+func (a *grpcAnnotator) closeStream(bs *batchStream) {
+	if a.stream == bs {
+		a.stream = nil
+	}
+	bs.cancel()
+
+	for id, ch := range bs.pending {
+		close(ch)
+		delete(bs.pending, id)
+	}
+}
+
+// failed delays opening the next stream. The delay doubles with every failure. The caller must hold a.mu.
+func (a *grpcAnnotator) failed() {
+	a.backoff *= 2
+	if a.backoff < minStreamBackoff {
+		a.backoff = minStreamBackoff
+	}
+	if a.backoff > maxStreamBackoff {
+		a.backoff = maxStreamBackoff
+	}
+	a.retryAt = time.Now().Add(a.backoff)
+}
+
+// send sends the batches passed to `bs` until the stream is closed
+func (a *grpcAnnotator) send(bs *batchStream) {
+	for {
+		select {
+		case b := <-bs.batches:
+			if err := bs.stream.Send(b); err != nil {
+				glog.Warningf("Unable to send batch to annotator %s: %v", a.name, err)
+				a.reset(bs)
+				return
+			}
+		case <-bs.ctx.Done():
+			return
+		}
+	}
+}
+
+// receive passes replies received on `bs` to the batches waiting for them
+func (a *grpcAnnotator) receive(bs *batchStream) {
+	for {
+		res, err := bs.stream.Recv()
+		if err != nil {
+			if status.Code(err) == codes.Unimplemented {
+				glog.Infof("Annotator %s does not support streaming. Using unary calls.", a.name)
+				atomic.StoreUint32(&a.unary, 1)
+			}
+
+			a.reset(bs)
+			return
+		}
+
+		a.mu.Lock()
+		a.backoff = 0
+		ch, ok := bs.pending[res.Id]
+		delete(bs.pending, res.Id)
+		a.mu.Unlock()
+
+		if ok {
+			ch <- res
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package annotation
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testAnnotatorServer sets the source AS of flows to 1 in unary calls and to 2 in streams.
+// Batches are replied after `delay`. Streams are not read at all if `stalled` is set.
+type testAnnotatorServer struct {
+	streaming bool
+	stalled   bool
+	delay     time.Duration
+	unary     uint64
+	batches   uint64
+}
+
+func (s *testAnnotatorServer) Annotate(ctx context.Context, fl *netflow.Flow) (*netflow.Flow, error) {
+	atomic.AddUint64(&s.unary, 1)
+	fl.SrcAs = 1
+	return fl, nil
+}
+
+func (s *testAnnotatorServer) AnnotateStream(stream netflow.Annotator_AnnotateStreamServer) error {
+	if !s.streaming {
+		return status.Error(codes.Unimplemented, "streaming not supported")
+	}
+	if s.stalled {
+		<-stream.Context().Done()
+		return nil
+	}
+
+	for {
+		b, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		atomic.AddUint64(&s.batches, 1)
+		time.Sleep(s.delay)
+		for _, fl := range b.Flows {
+			fl.SrcAs = 2
+		}
+		if err := stream.Send(b); err != nil {
+			return err
+		}
+	}
+}
+
+func testGRPCAnnotator(t *testing.T, srv *testAnnotatorServer) (*grpcAnnotator, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	s := grpc.NewServer()
+	netflow.RegisterAnnotatorServer(s, srv)
+	go s.Serve(lis)
+
+	a, err := newGRPCAnnotator(config.Annotator{Name: "test", Target: lis.Addr().String()}, &config.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create annotator: %v", err)
+	}
+	return a.(*grpcAnnotator), s.Stop
+}
+
+func testBatch(n int) []*netflow.Flow {
+	flows := make([]*netflow.Flow, n)
+	for i := range flows {
+		flows[i] = &netflow.Flow{SrcPort: uint32(i)}
+	}
+	return flows
+}
+
+func TestGRPCAnnotatorStream(t *testing.T) {
+	srv := &testAnnotatorServer{streaming: true}
+	a, stop := testGRPCAnnotator(t, srv)
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		flows := testBatch(10)
+		assert.Nil(t, a.AnnotateBatch(context.Background(), flows))
+		for i, fl := range flows {
+			assert.Equal(t, uint32(2), fl.SrcAs)
+			assert.Equal(t, uint32(i), fl.SrcPort)
+		}
+	}
+
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&srv.batches))
+	assert.Equal(t, uint64(0), atomic.LoadUint64(&srv.unary))
+}
+
+func TestGRPCAnnotatorUnaryFallback(t *testing.T) {
+	srv := &testAnnotatorServer{}
+	a, stop := testGRPCAnnotator(t, srv)
+	defer stop()
+
+	for i := 0; i < 2; i++ {
+		flows := testBatch(5)
+		assert.Nil(t, a.AnnotateBatch(context.Background(), flows))
+		for _, fl := range flows {
+			assert.Equal(t, uint32(1), fl.SrcAs)
+		}
+	}
+
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&a.unary))
+	assert.Equal(t, uint64(10), atomic.LoadUint64(&srv.unary))
+}
+
+func TestGRPCAnnotatorStreamTimeout(t *testing.T) {
+	srv := &testAnnotatorServer{streaming: true, delay: 200 * time.Millisecond}
+	a, stop := testGRPCAnnotator(t, srv)
+	defer stop()
+
+	// Expired batches are not retried by unary calls
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, a.AnnotateBatch(ctx, testBatch(5)))
+	assert.Equal(t, uint64(0), atomic.LoadUint64(&srv.unary))
+	assert.Equal(t, uint32(0), atomic.LoadUint32(&a.unary))
+}
+
+func TestGRPCAnnotatorStreamStalled(t *testing.T) {
+	srv := &testAnnotatorServer{streaming: true, stalled: true}
+	a, stop := testGRPCAnnotator(t, srv)
+	defer stop()
+
+	// Batches exceed the flow control window of the stream. Sending blocks until the
+	// batch expires, other batches fail meanwhile.
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			errs <- a.AnnotateBatch(ctx, testBatch(50000))
+		}()
+	}
+
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < cap(errs); i++ {
+		select {
+		case err := <-errs:
+			assert.NotNil(t, err)
+		case <-timeout:
+			t.Fatal("Batches did not time out")
+		}
+	}
+
+	// The stalled stream was reset
+	a.mu.Lock()
+	assert.Nil(t, a.stream)
+	a.mu.Unlock()
+}
@@ -0,0 +1,174 @@
+package mrt
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/lpm"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Annotator adds the prefix, origin AS, AS path, next hop AS and communities of the newest
+// RIB dump in a directory to flows. If the dump contains a route learned from the router
+// a flow was received from, that route is used. Otherwise the first route of the prefix is used.
+type Annotator struct {
+	dir string
+
+	// table is the *lpm.Table of []*Route of the dump loaded last
+	table atomic.Value
+
+	// loaded is the dump the table was loaded from, candidate is the newest dump seen.
+	// Both are only accessed by the watching goroutine.
+	loaded    dump
+	candidate dump
+}
+
+// dump identifies a version of a dump file
+type dump struct {
+	name    string
+	modTime time.Time
+	size    int64
+}
+
+// NewAnnotator creates an annotator using the newest RIB dump in directory `dir`. The directory is
+// checked for new dumps every `reloadInterval`. A new dump replaces the current one once it
+// did not change for one interval.
+func NewAnnotator(dir string, reloadInterval time.Duration) (*Annotator, error) {
+	a := &Annotator{
+		dir: dir,
+	}
+	a.table.Store(lpm.New())
+
+	d, err := a.newest()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.name == "" {
+		glog.Warningf("No RIB dump in %s", dir)
+	} else if err := a.load(d); err != nil {
+		return nil, err
+	}
+
+	if reloadInterval > 0 {
+		go a.watch(reloadInterval)
+	}
+	return a, nil
+}
+
+// Annotate adds BGP information to `fl`
+func (a *Annotator) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	t := a.table.Load().(*lpm.Table)
+	router := net.IP(fl.Router)
+
+	if pfx, r := lookup(t, fl.SrcAddr, router); r != nil {
+		fl.SrcPfx = &netflow.Pfx{IP: pfx.IP, Mask: pfx.Mask}
+		fl.SrcAs = r.OriginAS
+		fl.SrcAsPath = r.ASPath
+		fl.SrcCommunities = r.Communities
+	}
+
+	if pfx, r := lookup(t, fl.DstAddr, router); r != nil {
+		fl.DstPfx = &netflow.Pfx{IP: pfx.IP, Mask: pfx.Mask}
+		fl.DstAs = r.OriginAS
+		fl.DstAsPath = r.ASPath
+		fl.DstCommunities = r.Communities
+		fl.NextHopAs = r.NextHopAS
+	}
+
+	return nil
+}
+
+// lookup finds the route to `addr` preferring the route learned from `router`
+func lookup(t *lpm.Table, addr net.IP, router net.IP) (*net.IPNet, *Route) {
+	pfx, v, ok := t.Lookup(addr)
+	if !ok {
+		return nil, nil
+	}
+
+	routes := v.([]*Route)
+	if len(routes) == 0 {
+		return nil, nil
+	}
+
+	for _, r := range routes {
+		if r.Peer.Equal(router) {
+			return pfx, r
+		}
+	}
+	return pfx, routes[0]
+}
+
+// watch replaces the table when a new dump appears
+func (a *Annotator) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		d, err := a.newest()
+		if err != nil {
+			glog.Errorf("Unable to check for new RIB dumps: %v", err)
+			continue
+		}
+
+		if d.name == "" || d == a.loaded {
+			continue
+		}
+
+		// Wait for the dump to be completely written
+		if d != a.candidate {
+			a.candidate = d
+			continue
+		}
+
+		if err := a.load(d); err != nil {
+			glog.Errorf("Unable to load RIB dump. Keeping previous routes: %v", err)
+		}
+	}
+}
+
+// load replaces the table with dump `d`
+func (a *Annotator) load(d dump) error {
+	a.loaded = d
+
+	start := time.Now()
+	t, err := ReadFile(filepath.Join(a.dir, d.name))
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read %s", d.name)
+	}
+
+	a.table.Store(t)
+	glog.Infof("Loaded %d prefixes from RIB dump %s in %v", t.Len(), d.name, time.Since(start))
+	return nil
+}
+
+// newest finds the most recently modified dump in the directory
+func (a *Annotator) newest() (dump, error) {
+	files, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return dump{}, errors.Wrapf(err, "Unable to read directory %s", a.dir)
+	}
+
+	var d dump
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+
+		if d.name == "" || fi.ModTime().After(d.modTime) {
+			d = dump{
+				name:    fi.Name(),
+				modTime: fi.ModTime(),
+				size:    fi.Size(),
+			}
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,254 @@
+// Package mrt annotates flows with BGP information from MRT TABLE_DUMP_V2 RIB dumps (RFC 6396)
+package mrt
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bio-routing/tflow2/annotation/bgp"
+	"github.com/bio-routing/tflow2/lpm"
+	"github.com/pkg/errors"
+)
+
+// MRT types and TABLE_DUMP_V2 subtypes
+const (
+	typeTableDumpV2 = 13
+
+	subtypePeerIndexTable        = 1
+	subtypeRIBIPv4Unicast        = 2
+	subtypeRIBIPv6Unicast        = 4
+	subtypeRIBIPv4UnicastAddPath = 8
+	subtypeRIBIPv6UnicastAddPath = 10
+
+	mrtHeaderLen = 12
+	maxRecordLen = 16 * 1024 * 1024
+)
+
+// Peer types of the PEER_INDEX_TABLE
+const (
+	peerTypeIPv6 = 0x01
+	peerTypeAS4  = 0x02
+)
+
+// Route is a path to a prefix as seen by a peer. Routes with identical attributes share a Path.
+type Route struct {
+	// Peer is the address of the peer the route was learned from
+	Peer net.IP
+
+	*bgp.Path
+}
+
+// ReadFile reads the RIB dump in file `f` into a table of []*Route. Files ending
+// in .gz or .bz2 are decompressed.
+func ReadFile(f string) (*lpm.Table, error) {
+	fh, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var r io.Reader = bufio.NewReader(fh)
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".gz":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to decompress")
+		}
+		defer gr.Close()
+		r = gr
+	case ".bz2":
+		r = bzip2.NewReader(r)
+	}
+
+	return Read(r)
+}
+
+// Read reads a RIB dump from `r` into a table of []*Route
+func Read(r io.Reader) (*lpm.Table, error) {
+	d := &decoder{
+		table: lpm.New(),
+		paths: make(map[string]*bgp.Path),
+	}
+
+	hdr := make([]byte, mrtHeaderLen)
+	buf := make([]byte, 0)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if err == io.EOF {
+				return d.table, nil
+			}
+			return nil, errors.Wrap(err, "Unable to read MRT header")
+		}
+
+		typ := binary.BigEndian.Uint16(hdr[4:6])
+		subtype := binary.BigEndian.Uint16(hdr[6:8])
+		length := binary.BigEndian.Uint32(hdr[8:12])
+		if length > maxRecordLen {
+			return nil, fmt.Errorf("MRT record of %d bytes exceeds maximum length", length)
+		}
+
+		if cap(buf) < int(length) {
+			buf = make([]byte, length)
+		}
+		buf = buf[:length]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, errors.Wrap(err, "Unable to read MRT record")
+		}
+
+		if typ != typeTableDumpV2 {
+			continue
+		}
+
+		var err error
+		switch subtype {
+		case subtypePeerIndexTable:
+			err = d.decodePeerIndexTable(buf)
+		case subtypeRIBIPv4Unicast:
+			err = d.decodeRIB(buf, net.IPv4len, false)
+		case subtypeRIBIPv6Unicast:
+			err = d.decodeRIB(buf, net.IPv6len, false)
+		case subtypeRIBIPv4UnicastAddPath:
+			err = d.decodeRIB(buf, net.IPv4len, true)
+		case subtypeRIBIPv6UnicastAddPath:
+			err = d.decodeRIB(buf, net.IPv6len, true)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decoder holds the state of reading a RIB dump
+type decoder struct {
+	table *lpm.Table
+
+	// peers are the addresses of the peers of the PEER_INDEX_TABLE
+	peers []net.IP
+
+	// paths interns paths by their encoded attributes
+	paths map[string]*bgp.Path
+}
+
+// decodePeerIndexTable decodes a PEER_INDEX_TABLE record
+func (d *decoder) decodePeerIndexTable(b []byte) error {
+	if len(b) < 6 {
+		return fmt.Errorf("Short PEER_INDEX_TABLE")
+	}
+	viewNameLen := int(binary.BigEndian.Uint16(b[4:6]))
+	b = b[6:]
+	if len(b) < viewNameLen+2 {
+		return fmt.Errorf("Short PEER_INDEX_TABLE")
+	}
+	b = b[viewNameLen:]
+
+	count := int(binary.BigEndian.Uint16(b[0:2]))
+	b = b[2:]
+
+	d.peers = make([]net.IP, 0, count)
+	for i := 0; i < count; i++ {
+		if len(b) < 5 {
+			return fmt.Errorf("Short PEER_INDEX_TABLE entry %d", i)
+		}
+		peerType := b[0]
+		b = b[5:]
+
+		ipLen := net.IPv4len
+		if peerType&peerTypeIPv6 != 0 {
+			ipLen = net.IPv6len
+		}
+		asLen := 2
+		if peerType&peerTypeAS4 != 0 {
+			asLen = 4
+		}
+		if len(b) < ipLen+asLen {
+			return fmt.Errorf("Short PEER_INDEX_TABLE entry %d", i)
+		}
+
+		d.peers = append(d.peers, net.IP(append([]byte{}, b[:ipLen]...)))
+		b = b[ipLen+asLen:]
+	}
+	return nil
+}
+
+// decodeRIB decodes a RIB_IPV4_UNICAST or RIB_IPV6_UNICAST record and its ADD-PATH variant (RFC 8050)
+func (d *decoder) decodeRIB(b []byte, afLen int, addPath bool) error {
+	if len(b) < 5 {
+		return fmt.Errorf("Short RIB record")
+	}
+	pfxLen := int(b[4])
+	if pfxLen > afLen*8 {
+		return fmt.Errorf("Invalid prefix length %d", pfxLen)
+	}
+	b = b[5:]
+
+	n := (pfxLen + 7) / 8
+	if len(b) < n+2 {
+		return fmt.Errorf("Short RIB record")
+	}
+	ip := make(net.IP, afLen)
+	copy(ip, b[:n])
+	pfx := &net.IPNet{
+		IP:   ip,
+		Mask: net.CIDRMask(pfxLen, afLen*8),
+	}
+	pfx.IP = pfx.IP.Mask(pfx.Mask)
+	b = b[n:]
+
+	count := int(binary.BigEndian.Uint16(b[0:2]))
+	b = b[2:]
+
+	routes := make([]*Route, 0, count)
+	for i := 0; i < count; i++ {
+		hdrLen := 8
+		if addPath {
+			hdrLen += 4
+		}
+		if len(b) < hdrLen {
+			return fmt.Errorf("Short RIB entry for %s", pfx)
+		}
+		peerIndex := int(binary.BigEndian.Uint16(b[0:2]))
+		attrLen := int(binary.BigEndian.Uint16(b[hdrLen-2 : hdrLen]))
+		b = b[hdrLen:]
+		if len(b) < attrLen {
+			return fmt.Errorf("Short RIB entry for %s", pfx)
+		}
+		if peerIndex >= len(d.peers) {
+			return fmt.Errorf("Unknown peer index %d for %s", peerIndex, pfx)
+		}
+
+		path, err := d.path(b[:attrLen])
+		if err != nil {
+			return errors.Wrapf(err, "Invalid attributes for %s", pfx)
+		}
+		routes = append(routes, &Route{
+			Peer: d.peers[peerIndex],
+			Path: path,
+		})
+		b = b[attrLen:]
+	}
+
+	d.table.Insert(pfx, routes)
+	return nil
+}
+
+// path returns the path of the encoded attributes `b`
+func (d *decoder) path(b []byte) (*bgp.Path, error) {
+	if p, ok := d.paths[string(b)]; ok {
+		return p, nil
+	}
+
+	p, err := bgp.DecodePath(b, true)
+	if err != nil {
+		return nil, err
+	}
+	d.paths[string(b)] = p
+	return p, nil
+}
@@ -0,0 +1,181 @@
+package mrt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// record encodes an MRT record
+func record(typ uint16, subtype uint16, body []byte) []byte {
+	b := make([]byte, mrtHeaderLen)
+	binary.BigEndian.PutUint16(b[4:], typ)
+	binary.BigEndian.PutUint16(b[6:], subtype)
+	binary.BigEndian.PutUint32(b[8:], uint32(len(body)))
+	return append(b, body...)
+}
+
+// peerIndexTable encodes a PEER_INDEX_TABLE with IPv4 peers using 4 byte AS numbers
+func peerIndexTable(peers ...string) []byte {
+	b := []byte{192, 0, 2, 254, 0, 4, 't', 'e', 's', 't', 0, byte(len(peers))}
+	for i, p := range peers {
+		b = append(b, peerTypeAS4, 0, 0, 0, byte(i))
+		b = append(b, net.ParseIP(p).To4()...)
+		b = append(b, 0, 0, 0xfb, 0xf4)
+	}
+	return b
+}
+
+// attributes encodes an AS_PATH of one AS_SEQUENCE and standard communities
+func attributes(asPath []uint32, communities [][2]uint16) []byte {
+	// AS_SEQUENCE
+	path := []byte{2, byte(len(asPath))}
+	for _, as := range asPath {
+		path = append(path, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(path[len(path)-4:], as)
+	}
+
+	// AS_PATH, transitive
+	b := []byte{0x40, 2, byte(len(path))}
+	b = append(b, path...)
+
+	if len(communities) > 0 {
+		// COMMUNITIES, optional transitive with extended length
+		b = append(b, 0xd0, 8, 0, byte(4*len(communities)))
+		for _, c := range communities {
+			b = append(b, byte(c[0]>>8), byte(c[0]), byte(c[1]>>8), byte(c[1]))
+		}
+	}
+	return b
+}
+
+// rib encodes a RIB_IPV4_UNICAST record with one entry per peer index in `attrs`
+func rib(pfx string, attrs map[uint16][]byte) []byte {
+	_, n, _ := net.ParseCIDR(pfx)
+	ones, _ := n.Mask.Size()
+
+	b := []byte{0, 0, 0, 0, byte(ones)}
+	b = append(b, n.IP.To4()[:(ones+7)/8]...)
+	b = append(b, 0, byte(len(attrs)))
+	for i := uint16(0); i < 16; i++ {
+		a, ok := attrs[i]
+		if !ok {
+			continue
+		}
+		b = append(b, byte(i>>8), byte(i), 0, 0, 0, 0, byte(len(a)>>8), byte(len(a)))
+		b = append(b, a...)
+	}
+	return b
+}
+
+func testDump() []byte {
+	var b []byte
+	b = append(b, record(typeTableDumpV2, subtypePeerIndexTable, peerIndexTable("10.0.0.1", "10.0.0.2"))...)
+	b = append(b, record(typeTableDumpV2, subtypeRIBIPv4Unicast, rib("192.0.2.0/24", map[uint16][]byte{
+		0: attributes([]uint32{64496, 64500}, [][2]uint16{{64496, 100}}),
+		1: attributes([]uint32{64497, 64498, 64500}, nil),
+	}))...)
+	b = append(b, record(typeTableDumpV2, subtypeRIBIPv4Unicast, rib("198.51.100.0/22", map[uint16][]byte{
+		1: attributes([]uint32{64497, 64501}, [][2]uint16{{64497, 1}, {64497, 2}}),
+	}))...)
+	// Records of other types are skipped
+	b = append(b, record(16, 4, []byte{1, 2, 3})...)
+	return b
+}
+
+func TestRead(t *testing.T) {
+	tbl, err := Read(bytes.NewReader(testDump()))
+	if err != nil {
+		t.Fatalf("Unable to read dump: %v", err)
+	}
+	assert.Equal(t, 2, tbl.Len())
+
+	pfx, v, ok := tbl.Lookup(net.ParseIP("192.0.2.1"))
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.0/24", pfx.String())
+
+	routes := v.([]*Route)
+	assert.Equal(t, 2, len(routes))
+	assert.Equal(t, "10.0.0.1", routes[0].Peer.String())
+	assert.Equal(t, []uint32{64496, 64500}, routes[0].ASPath)
+	assert.Equal(t, uint32(64500), routes[0].OriginAS)
+	assert.Equal(t, uint32(64496), routes[0].NextHopAS)
+	assert.Equal(t, []string{"64496:100"}, routes[0].Communities)
+	assert.Equal(t, uint32(64497), routes[1].NextHopAS)
+
+	_, err = Read(bytes.NewReader(testDump()[:60]))
+	assert.NotNil(t, err)
+}
+
+func TestAnnotator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mrt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, err := NewAnnotator(dir, 0)
+	if err != nil {
+		t.Fatalf("Unable to create annotator: %v", err)
+	}
+
+	fl := &netflow.Flow{
+		Router:  net.ParseIP("10.0.0.2"),
+		SrcAddr: net.ParseIP("198.51.101.1"),
+		DstAddr: net.ParseIP("192.0.2.1"),
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, uint32(0), fl.DstAs)
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(testDump())
+	w.Close()
+	ioutil.WriteFile(filepath.Join(dir, "rib.20171201.0000.gz"), buf.Bytes(), 0644)
+
+	d, err := a.newest()
+	assert.Nil(t, err)
+	assert.Equal(t, "rib.20171201.0000.gz", d.name)
+	assert.Nil(t, a.load(d))
+
+	// Routes learned from the router are preferred
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, uint32(64500), fl.DstAs)
+	assert.Equal(t, []uint32{64497, 64498, 64500}, fl.DstAsPath)
+	assert.Equal(t, uint32(64497), fl.NextHopAs)
+	assert.Nil(t, fl.DstCommunities)
+	assert.Equal(t, uint32(64501), fl.SrcAs)
+	assert.Equal(t, []string{"64497:1", "64497:2"}, fl.SrcCommunities)
+	assert.Equal(t, net.IP{198, 51, 100, 0}, net.IP(fl.SrcPfx.IP))
+
+	fl = &netflow.Flow{
+		Router:  net.ParseIP("10.0.0.3"),
+		DstAddr: net.ParseIP("192.0.2.1"),
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, uint32(64496), fl.NextHopAs)
+	assert.Equal(t, []string{"64496:100"}, fl.DstCommunities)
+
+	// A broken dump keeps the previous routes
+	f := filepath.Join(dir, "rib.20171201.0200")
+	ioutil.WriteFile(f, testDump()[:60], 0644)
+	os.Chtimes(f, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	d, err = a.newest()
+	assert.Nil(t, err)
+	assert.Equal(t, "rib.20171201.0200", d.name)
+	assert.NotNil(t, a.load(d))
+
+	fl = &netflow.Flow{DstAddr: net.ParseIP("192.0.2.1")}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, uint32(64500), fl.DstAs)
+}
@@ -0,0 +1,163 @@
+// Package static annotates flows with prefix information loaded from local CSV and JSON files
+package static
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/annotation/filewatch"
+	"github.com/bio-routing/tflow2/lpm"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/pkg/errors"
+)
+
+// Entry is the information about a prefix
+type Entry struct {
+	Prefix   string `json:"prefix"`
+	OriginAS uint32 `json:"origin_as"`
+	Customer string `json:"customer"`
+	Site     string `json:"site"`
+}
+
+// Annotator adds the origin AS, prefix, customer and site of source and destination addresses to flows
+type Annotator struct {
+	// files are reloaded when they change
+	files *filewatch.Watcher
+
+	// table is the *lpm.Table of *Entry loaded from files
+	table atomic.Value
+}
+
+// New creates an annotator using the prefixes in `files`. Files ending in .json contain
+// a list of entries, others are CSV files with the columns prefix, origin AS, customer and site.
+// The files are reloaded when they change, checked every `reloadInterval`.
+func New(files []string, reloadInterval time.Duration) (*Annotator, error) {
+	a := &Annotator{}
+
+	w, err := filewatch.New("prefix files", files, reloadInterval, a.load)
+	if err != nil {
+		return nil, err
+	}
+	a.files = w
+	return a, nil
+}
+
+// Annotate adds prefix information to `fl`
+func (a *Annotator) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	t := a.table.Load().(*lpm.Table)
+
+	if pfx, v, ok := t.Lookup(fl.SrcAddr); ok {
+		e := v.(*Entry)
+		fl.SrcPfx = &netflow.Pfx{IP: pfx.IP, Mask: pfx.Mask}
+		if e.OriginAS != 0 {
+			fl.SrcAs = e.OriginAS
+		}
+		fl.SrcCustomer = e.Customer
+		fl.SrcSite = e.Site
+	}
+
+	if pfx, v, ok := t.Lookup(fl.DstAddr); ok {
+		e := v.(*Entry)
+		fl.DstPfx = &netflow.Pfx{IP: pfx.IP, Mask: pfx.Mask}
+		if e.OriginAS != 0 {
+			fl.DstAs = e.OriginAS
+		}
+		fl.DstCustomer = e.Customer
+		fl.DstSite = e.Site
+	}
+
+	return nil
+}
+
+// load loads all files and replaces the table
+func (a *Annotator) load(files []string) error {
+	t := lpm.New()
+
+	for _, f := range files {
+		entries, err := readFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read %s", f)
+		}
+
+		for _, e := range entries {
+			_, pfx, err := net.ParseCIDR(e.Prefix)
+			if err != nil {
+				return errors.Wrapf(err, "Invalid prefix in %s", f)
+			}
+			t.Insert(pfx, e)
+		}
+	}
+
+	a.table.Store(t)
+	return nil
+}
+
+// readFile reads the entries of file `f`
+func readFile(f string) ([]*Entry, error) {
+	fh, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	if strings.ToLower(filepath.Ext(f)) == ".json" {
+		entries := make([]*Entry, 0)
+		if err := json.NewDecoder(fh).Decode(&entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+
+	return readCSV(fh)
+}
+
+// readCSV reads entries with the columns prefix, origin AS, customer and site from `r`.
+// All columns but the prefix are optional. A header line and lines starting with # are ignored.
+func readCSV(r io.Reader) ([]*Entry, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	entries := make([]*Entry, 0)
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && rec[0] == "prefix" {
+			continue
+		}
+
+		e := &Entry{
+			Prefix: rec[0],
+		}
+		if len(rec) > 1 && rec[1] != "" {
+			as, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(rec[1]), "AS"), 10, 32)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid origin AS in line %d", line)
+			}
+			e.OriginAS = uint32(as)
+		}
+		if len(rec) > 2 {
+			e.Customer = rec[2]
+		}
+		if len(rec) > 3 {
+			e.Site = rec[3]
+		}
+		entries = append(entries, e)
+	}
+}
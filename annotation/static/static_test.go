@@ -0,0 +1,77 @@
+package static
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	csvFile := filepath.Join(dir, "customers.csv")
+	jsonFile := filepath.Join(dir, "customers.json")
+	ioutil.WriteFile(csvFile, []byte("prefix,origin_as,customer,site\n# comment\n192.0.2.0/24,AS64500,acme,fra01\n192.0.2.128/25,64501,acme-web,\n"), 0644)
+	ioutil.WriteFile(jsonFile, []byte(`[{"prefix": "2001:db8::/32", "origin_as": 64502, "customer": "example", "site": "ams01"}]`), 0644)
+
+	a, err := New([]string{csvFile, jsonFile}, 0)
+	if err != nil {
+		t.Fatalf("Unable to create annotator: %v", err)
+	}
+
+	fl := &netflow.Flow{
+		SrcAddr: net.ParseIP("192.0.2.200"),
+		DstAddr: net.ParseIP("2001:db8::1"),
+		SrcAs:   1,
+		DstAs:   2,
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+
+	assert.Equal(t, uint32(64501), fl.SrcAs)
+	assert.Equal(t, "acme-web", fl.SrcCustomer)
+	assert.Equal(t, "", fl.SrcSite)
+	assert.Equal(t, net.IP{192, 0, 2, 128}, net.IP(fl.SrcPfx.IP))
+	assert.Equal(t, net.IP(net.CIDRMask(25, 32)), net.IP(fl.SrcPfx.Mask))
+
+	assert.Equal(t, uint32(64502), fl.DstAs)
+	assert.Equal(t, "example", fl.DstCustomer)
+	assert.Equal(t, "ams01", fl.DstSite)
+
+	// Flows outside of the prefixes are not modified
+	fl = &netflow.Flow{
+		SrcAddr: net.ParseIP("198.51.100.1"),
+		DstAddr: net.ParseIP("192.0.2.1"),
+		SrcAs:   1,
+	}
+	assert.Nil(t, a.Annotate(context.Background(), fl))
+	assert.Equal(t, uint32(1), fl.SrcAs)
+	assert.Nil(t, fl.SrcPfx)
+	assert.Equal(t, uint32(64500), fl.DstAs)
+	assert.Equal(t, "fra01", fl.DstSite)
+
+	// A broken file keeps the previous prefixes
+	ioutil.WriteFile(csvFile, []byte("not a prefix\n"), 0644)
+	assert.True(t, a.files.Changed())
+	assert.NotNil(t, a.files.Load())
+	fl = &netflow.Flow{DstAddr: net.ParseIP("192.0.2.1")}
+	a.Annotate(context.Background(), fl)
+	assert.Equal(t, "acme", fl.DstCustomer)
+
+	ioutil.WriteFile(csvFile, []byte("192.0.2.0/24,64503,other\n"), 0644)
+	assert.Nil(t, a.files.Load())
+	assert.False(t, a.files.Changed())
+	fl = &netflow.Flow{DstAddr: net.ParseIP("192.0.2.1")}
+	a.Annotate(context.Background(), fl)
+	assert.Equal(t, "other", fl.DstCustomer)
+	assert.Equal(t, uint32(64503), fl.DstAs)
+}
@@ -0,0 +1,121 @@
+// Package tag annotates flows with the tag groups their source and destination belong to
+package tag
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/lpm"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/pkg/errors"
+)
+
+// Annotator tags the source and destination of flows with the groups of their addresses,
+// AS numbers or interfaces. Prefixes take precedence over AS numbers and AS numbers over
+// interfaces. Of overlapping prefixes of different groups the most specific one is used.
+type Annotator struct {
+	// prefixes is the lpm.Table of group names
+	prefixes *lpm.Table
+
+	asns       map[uint32]string
+	interfaces map[intf]string
+}
+
+// intf identifies an interface of an agent
+type intf struct {
+	agent string
+	id    uint32
+}
+
+// New creates an annotator tagging flows with `groups`. Agents of interfaces are given by
+// name of one of `agents` or by IP address.
+func New(groups []config.TagGroup, agents []config.Agent) (*Annotator, error) {
+	a := &Annotator{
+		prefixes:   lpm.New(),
+		asns:       make(map[uint32]string),
+		interfaces: make(map[intf]string),
+	}
+
+	agentIPs := make(map[string]string)
+	for _, agent := range agents {
+		agentIPs[agent.Name] = agent.IPAddress
+	}
+
+	names := make(map[string]struct{})
+	prefixes := make(map[string]string)
+	for _, g := range groups {
+		if g.Name == "" {
+			return nil, fmt.Errorf("Tag group without name")
+		}
+		if _, ok := names[g.Name]; ok {
+			return nil, fmt.Errorf("Duplicate tag group: %s", g.Name)
+		}
+		names[g.Name] = struct{}{}
+
+		for _, p := range g.Prefixes {
+			_, pfx, err := net.ParseCIDR(p)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid prefix %s of tag group %s", p, g.Name)
+			}
+			if other, ok := prefixes[pfx.String()]; ok {
+				return nil, fmt.Errorf("Prefix %s in tag groups %s and %s", pfx, other, g.Name)
+			}
+			prefixes[pfx.String()] = g.Name
+			a.prefixes.Insert(pfx, g.Name)
+		}
+
+		for _, as := range g.ASNs {
+			if other, ok := a.asns[as]; ok {
+				return nil, fmt.Errorf("AS%d in tag groups %s and %s", as, other, g.Name)
+			}
+			a.asns[as] = g.Name
+		}
+
+		for _, i := range g.Interfaces {
+			addr := i.Agent
+			if ip, ok := agentIPs[addr]; ok {
+				addr = ip
+			}
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("Unknown agent %s of tag group %s", i.Agent, g.Name)
+			}
+
+			for _, id := range i.IDs {
+				key := intf{agent: ip.String(), id: id}
+				if other, ok := a.interfaces[key]; ok {
+					return nil, fmt.Errorf("Interface %d of %s in tag groups %s and %s", id, i.Agent, other, g.Name)
+				}
+				a.interfaces[key] = g.Name
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// Annotate sets the tag groups of the source and destination of `fl`. The source is tagged by
+// the input interface, the destination by the output interface.
+func (a *Annotator) Annotate(ctx context.Context, fl *netflow.Flow) error {
+	agent := net.IP(fl.Router).String()
+	fl.SrcTag = a.group(fl.SrcAddr, fl.SrcAs, intf{agent: agent, id: fl.IntIn})
+	fl.DstTag = a.group(fl.DstAddr, fl.DstAs, intf{agent: agent, id: fl.IntOut})
+	return nil
+}
+
+// group returns the group of address `addr`, AS `as` or interface `i`
+func (a *Annotator) group(addr net.IP, as uint32, i intf) string {
+	if addr != nil {
+		if _, g, ok := a.prefixes.Lookup(addr); ok {
+			return g.(string)
+		}
+	}
+
+	if g, ok := a.asns[as]; ok {
+		return g
+	}
+
+	return a.interfaces[i]
+}
@@ -0,0 +1,143 @@
+package tag
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotate(t *testing.T) {
+	a, err := New([]config.TagGroup{
+		{
+			Name:     "customer-a",
+			Prefixes: []string{"198.51.100.0/24", "2001:db8:100::/48"},
+			Interfaces: []config.TagInterface{
+				{Agent: "rtr01", IDs: []uint32{42}},
+			},
+		},
+		{
+			Name:     "customer-b",
+			Prefixes: []string{"198.51.100.128/25"},
+			ASNs:     []uint32{64500},
+		},
+		{
+			Name: "transit",
+			Interfaces: []config.TagInterface{
+				{Agent: "192.0.2.2", IDs: []uint32{1}},
+			},
+		},
+	}, []config.Agent{
+		{Name: "rtr01", IPAddress: "192.0.2.1"},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create annotator: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		flow     *netflow.Flow
+		expected [2]string
+	}{
+		{
+			name: "Prefixes",
+			flow: &netflow.Flow{
+				Router:  net.ParseIP("192.0.2.1"),
+				SrcAddr: net.ParseIP("198.51.100.1"),
+				DstAddr: net.ParseIP("198.51.100.129"),
+			},
+			expected: [2]string{"customer-a", "customer-b"},
+		},
+		{
+			name: "IPv6 prefix",
+			flow: &netflow.Flow{
+				Router:  net.ParseIP("192.0.2.1"),
+				SrcAddr: net.ParseIP("2001:db8:100::1"),
+				DstAddr: net.ParseIP("2001:db8:200::1"),
+			},
+			expected: [2]string{"customer-a", ""},
+		},
+		{
+			name: "AS numbers",
+			flow: &netflow.Flow{
+				Router:  net.ParseIP("192.0.2.1"),
+				SrcAddr: net.ParseIP("203.0.113.1"),
+				DstAddr: net.ParseIP("198.51.100.1"),
+				SrcAs:   64500,
+				DstAs:   64500,
+			},
+			expected: [2]string{"customer-b", "customer-a"},
+		},
+		{
+			name: "Interfaces",
+			flow: &netflow.Flow{
+				Router:  net.ParseIP("192.0.2.1"),
+				SrcAddr: net.ParseIP("203.0.113.1"),
+				DstAddr: net.ParseIP("203.0.113.2"),
+				IntIn:   42,
+				IntOut:  42,
+			},
+			expected: [2]string{"customer-a", "customer-a"},
+		},
+		{
+			name: "Interfaces of other agent",
+			flow: &netflow.Flow{
+				Router:  net.ParseIP("192.0.2.2"),
+				SrcAddr: net.ParseIP("203.0.113.1"),
+				DstAddr: net.ParseIP("203.0.113.2"),
+				IntIn:   1,
+				IntOut:  42,
+			},
+			expected: [2]string{"transit", ""},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Nil(t, a.Annotate(context.Background(), test.flow), test.name)
+		assert.Equal(t, test.expected, [2]string{test.flow.SrcTag, test.flow.DstTag}, test.name)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []config.TagGroup
+	}{
+		{
+			name:   "Duplicate group",
+			groups: []config.TagGroup{{Name: "a"}, {Name: "a"}},
+		},
+		{
+			name:   "Invalid prefix",
+			groups: []config.TagGroup{{Name: "a", Prefixes: []string{"198.51.100.0"}}},
+		},
+		{
+			name: "Prefix in two groups",
+			groups: []config.TagGroup{
+				{Name: "a", Prefixes: []string{"198.51.100.0/24"}},
+				{Name: "b", Prefixes: []string{"198.51.100.1/24"}},
+			},
+		},
+		{
+			name: "AS in two groups",
+			groups: []config.TagGroup{
+				{Name: "a", ASNs: []uint32{64500}},
+				{Name: "b", ASNs: []uint32{64500}},
+			},
+		},
+		{
+			name: "Unknown agent",
+			groups: []config.TagGroup{
+				{Name: "a", Interfaces: []config.TagInterface{{Agent: "rtr02", IDs: []uint32{1}}}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := New(test.groups, nil)
+		assert.NotNil(t, err, test.name)
+	}
+}
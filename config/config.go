@@ -18,21 +18,328 @@ type Config struct {
 	Anonymize            bool   `yaml:"anonymize"`
 	CacheTime            *int64 `yaml:"cache_time"`
 
-	NetflowV9       *Server     `yaml:"netflow_v9"`
-	IPFIX           *Server     `yaml:"ipfix"`
-	Sflow           *Server     `yaml:"sflow"`
-	Frontend        *Server     `yaml:"frontend"`
-	BGPAugmentation *BGPAugment `yaml:"bgp_augmentation"`
-	Agents          []Agent     `yaml:"agents"`
-	Annotators      []Annotator `yaml:"annotators"`
+	NetflowV9        *Server           `yaml:"netflow_v9"`
+	IPFIX            *Server           `yaml:"ipfix"`
+	Sflow            *Server           `yaml:"sflow"`
+	Frontend         *Server           `yaml:"frontend"`
+	Ingest           *Ingest           `yaml:"ingest"`
+	BGPAugmentation  *BGPAugment       `yaml:"bgp_augmentation"`
+	Agents           []Agent           `yaml:"agents"`
+	Annotators       []Annotator       `yaml:"annotators"`
+	TagGroups        []TagGroup        `yaml:"tag_groups"`
+	Annotation       *Annotation       `yaml:"annotation"`
+	Replication      []Replication     `yaml:"replication"`
+	Export           *Export           `yaml:"export"`
+	AutoRegistration *AutoRegistration `yaml:"auto_registration"`
+	RateLimit        *RateLimit        `yaml:"rate_limit"`
+	Pipeline         *Pipeline         `yaml:"pipeline"`
+	Rules            []Rule            `yaml:"rules"`
+	LoadShedding     *LoadShedding     `yaml:"load_shedding"`
+	ReverseDNS       *ReverseDNS       `yaml:"reverse_dns"`
 
 	AgentsNameByIP map[string]string
 }
 
 // Annotator represents annotator configuration
 type Annotator struct {
-	Name   string
+	Name string
+
+	// Type selects a built-in annotator: grpc (default), bird, static, mrt, bgp, geoip or tag
+	Type string `yaml:"type"`
+
+	// Target is the address of a grpc annotator
 	Target string
+
+	// Unary disables the streaming of batches to a grpc annotator
+	Unary bool `yaml:"unary"`
+
+	// Timeout is the number of milliseconds a call of the annotator may take
+	Timeout int `yaml:"timeout"`
+
+	// FailureThreshold is the number of consecutive failed calls after which the annotator is bypassed
+	FailureThreshold int `yaml:"failure_threshold"`
+
+	// ProbeInterval is the number of milliseconds between probes of a bypassed annotator
+	ProbeInterval int `yaml:"probe_interval"`
+
+	// BIRDSocket and BIRD6Socket are the control sockets of a bird annotator. BIRD 2 is queried on BIRDSocket only.
+	BIRDSocket  string `yaml:"bird_socket"`
+	BIRD6Socket string `yaml:"bird6_socket"`
+
+	// BIRDVersion is the major version of BIRD queried by a bird annotator (1 or 2)
+	BIRDVersion int `yaml:"bird_version"`
+
+	// BIRDTable4 and BIRDTable6 are the tables a bird annotator queries for IPv4 and IPv6 addresses
+	BIRDTable4 string `yaml:"bird_table4"`
+	BIRDTable6 string `yaml:"bird_table6"`
+
+	// BIRDQuery is the query template of a bird annotator. {addr}, {router}, {agent}, {table}
+	// and {channel} are replaced by the address, the agents address with underscores, the
+	// agents name, the table and the channel (ipv4 or ipv6) of the address.
+	BIRDQuery string `yaml:"bird_query"`
+
+	// BIRDCountQuery is the template of the query counting the networks within {prefix} a bird
+	// annotator issues before caching a result by its prefix. The placeholders of BIRDQuery are
+	// replaced as well. Without it results are cached per address.
+	BIRDCountQuery string `yaml:"bird_count_query"`
+
+	// BIRDWatchQuery is the template of the query counting the routes of an agent a bird annotator
+	// issues every WatchInterval seconds. Cached results of the agent are invalidated when the
+	// count changes. The placeholders of BIRDQuery except {addr} are replaced.
+	BIRDWatchQuery string `yaml:"bird_watch_query"`
+
+	// WatchInterval is the number of seconds between the watch queries of a bird annotator
+	WatchInterval int `yaml:"watch_interval"`
+
+	// CacheSize is the maximum number of results a bird annotator caches
+	CacheSize int `yaml:"cache_size"`
+
+	// CacheTTL is the number of seconds a bird annotator caches results
+	CacheTTL int `yaml:"cache_ttl"`
+
+	// Files are the CSV or JSON prefix files of a static annotator or the MaxMind DB files of a geoip annotator
+	Files []string `yaml:"files"`
+
+	// Directory is watched for MRT TABLE_DUMP_V2 RIB dumps by a mrt annotator
+	Directory string `yaml:"directory"`
+
+	// ReloadInterval is the number of milliseconds between checks of the files or directory for changes
+	ReloadInterval int `yaml:"reload_interval"`
+
+	// Listen is the address a bgp annotator accepts sessions from agents on
+	Listen string `yaml:"listen"`
+
+	// LocalAS and RouterID identify a bgp annotator to its peers
+	LocalAS  uint32 `yaml:"local_as"`
+	RouterID string `yaml:"router_id"`
+
+	// HoldTime is the hold time in seconds a bgp annotator proposes to its peers
+	HoldTime int `yaml:"hold_time"`
+}
+
+// TagGroup represents a named group of prefixes, AS numbers and interfaces, e.g. a customer.
+// The source and destination of flows are tagged with the group they belong to.
+type TagGroup struct {
+	Name     string   `yaml:"name"`
+	Prefixes []string `yaml:"prefixes"`
+	ASNs     []uint32 `yaml:"asns"`
+
+	// Interfaces connecting the group. Flows received on them are sourced by the group, flows sent
+	// out of them are destined to the group.
+	Interfaces []TagInterface `yaml:"interfaces"`
+}
+
+// TagInterface represents interfaces of an agent
+type TagInterface struct {
+	// Agent is the name or IP address of the agent
+	Agent string   `yaml:"agent"`
+	IDs   []uint32 `yaml:"ids"`
+}
+
+// Annotation represents the configuration of the annotation workers
+type Annotation struct {
+	// BatchSize is the maximum number of flows annotated at once
+	BatchSize int `yaml:"batch_size"`
+
+	// FlushInterval is the number of milliseconds a worker waits for a batch to fill up
+	FlushInterval int `yaml:"flush_interval"`
+}
+
+// Replication represents a downstream collector received datagrams are replicated to
+type Replication struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+
+	// Protocols limits replication to datagrams of the given collectors (netflow_v9, ipfix, sflow)
+	Protocols []string `yaml:"protocols"`
+
+	// Agents limits replication to datagrams from the given agents (names or IP addresses)
+	Agents []string `yaml:"agents"`
+
+	// QueueSize is the number of datagrams buffered for the target before they are dropped
+	QueueSize int `yaml:"queue_size"`
+
+	// PreserveSource sends datagrams with the address and port of their agent as source using
+	// a raw socket (Linux only, requires CAP_NET_RAW). Otherwise all datagrams are sent from
+	// tflow2s address, so NetFlow v9 and IPFIX collectors see a single exporter.
+	PreserveSource bool `yaml:"preserve_source"`
+}
+
+// Pipeline represents the configuration of the queues between the stages of the flow pipeline
+type Pipeline struct {
+	// QueueSize is the number of flows buffered by each queue. It defaults to the -channelbuffer flag.
+	QueueSize int `yaml:"queue_size"`
+
+	// Policy for flows put into a full queue: "block" waits for the next stage, "drop" drops them
+	Policy string `yaml:"policy"`
+
+	// Stages overrides QueueSize and Policy per stage (netflow_v9, ipfix, sflow, ingest, rules, export, database)
+	Stages map[string]Queue `yaml:"stages"`
+}
+
+// Queue represents the configuration of the queue of a pipeline stage
+type Queue struct {
+	QueueSize int    `yaml:"queue_size"`
+	Policy    string `yaml:"policy"`
+}
+
+// Queue returns the queue configuration of stage `stage`
+func (p *Pipeline) Queue(stage string) Queue {
+	if p == nil {
+		return Queue{}
+	}
+
+	q := Queue{
+		QueueSize: p.QueueSize,
+		Policy:    p.Policy,
+	}
+
+	if s, ok := p.Stages[stage]; ok {
+		if s.QueueSize != 0 {
+			q.QueueSize = s.QueueSize
+		}
+		if s.Policy != "" {
+			q.Policy = s.Policy
+		}
+	}
+
+	return q
+}
+
+// Rule represents a rule filtering or rewriting annotated flows before they are stored
+type Rule struct {
+	Name  string    `yaml:"name"`
+	Match RuleMatch `yaml:"match"`
+
+	// Action is one of drop, keep, set or tag. Drop and keep end the evaluation of rules.
+	Action string `yaml:"action"`
+
+	// Set maps names of flow fields to the values assigned by action set
+	Set map[string]string `yaml:"set"`
+
+	// Tag is set as source and/or destination tag of matching flows by action tag,
+	// replacing tags of tag groups
+	Tag string `yaml:"tag"`
+
+	// TagSide selects the tag set by action tag: src, dst or both (default)
+	TagSide string `yaml:"tag_side"`
+}
+
+// RuleMatch represents the conditions of a rule. A flow matches if it meets all given conditions
+// and any of the values given per condition.
+type RuleMatch struct {
+	// Agents are names or IP addresses of agents
+	Agents      []string `yaml:"agents"`
+	SrcPrefixes []string `yaml:"src_prefixes"`
+	DstPrefixes []string `yaml:"dst_prefixes"`
+	Protocols   []uint32 `yaml:"protocols"`
+	SrcPorts    []uint32 `yaml:"src_ports"`
+	DstPorts    []uint32 `yaml:"dst_ports"`
+	IntIn       []uint32 `yaml:"int_in"`
+	IntOut      []uint32 `yaml:"int_out"`
+
+	// Interfaces match the input or output interface
+	Interfaces []uint32 `yaml:"interfaces"`
+}
+
+// RateLimit represents the configuration of per agent flow rate limiting
+type RateLimit struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Rate is the number of flows per second accepted from each agent. 0 means unlimited.
+	Rate float64 `yaml:"rate"`
+
+	// Burst is the number of flows an agent may send at once. It is at least one second worth of flows.
+	Burst float64 `yaml:"burst"`
+
+	// Policy for flows exceeding the limit: "drop" or "downsample" (samplerate of accepted flows is raised accordingly)
+	Policy string `yaml:"policy"`
+}
+
+// LoadShedding represents the configuration of adaptive sampling of flows when the pipeline is overloaded
+type LoadShedding struct {
+	Enabled bool `yaml:"enabled"`
+
+	// HighWatermark is the fill level (0-1) of the fullest pipeline queue above which the sampling ratio is doubled
+	HighWatermark float64 `yaml:"high_watermark"`
+
+	// LowWatermark is the fill level (0-1) of the fullest pipeline queue below which the sampling ratio is halved
+	LowWatermark float64 `yaml:"low_watermark"`
+
+	// MaxRatio is the highest sampling ratio (1:N)
+	MaxRatio uint64 `yaml:"max_ratio"`
+
+	// Interval is the number of milliseconds between checks of the queues
+	Interval int `yaml:"interval"`
+}
+
+// ReverseDNS represents the configuration of the resolution of addresses in query results to names
+type ReverseDNS struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Resolver is the address of the DNS server queried. The system resolver is used if empty.
+	Resolver string `yaml:"resolver"`
+
+	// CacheSize is the maximum number of names cached
+	CacheSize int `yaml:"cache_size"`
+
+	// TTL is the number of seconds names are cached
+	TTL int `yaml:"ttl"`
+
+	// NegativeTTL is the number of seconds addresses without name are cached
+	NegativeTTL int `yaml:"negative_ttl"`
+
+	// Timeout is the number of milliseconds a lookup may take
+	Timeout int `yaml:"timeout"`
+
+	// Workers is the number of concurrent lookups
+	Workers int `yaml:"workers"`
+
+	// QueueSize is the number of addresses waiting for lookup. Further addresses are queued by later queries.
+	QueueSize int `yaml:"queue_size"`
+}
+
+// AutoRegistration represents the configuration of the automatic registration of unknown agents
+type AutoRegistration struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Prefixes restricts registration to agents within these CIDRs. Any agent is registered if empty.
+	Prefixes []string `yaml:"prefixes"`
+
+	// MaxAgents is the maximum number of agents registered automatically. Further agents are refused.
+	MaxAgents int `yaml:"max_agents"`
+
+	// ReverseLookup names agents after the PTR record of their address
+	ReverseLookup bool `yaml:"reverse_lookup"`
+
+	// NameTemplate names agents without PTR record. {ip} is replaced by the agents address.
+	NameTemplate string `yaml:"name_template"`
+
+	SNMPCommunity string `yaml:"snmp_community"`
+	SampleRate    uint64 `yaml:"sample_rate"`
+}
+
+// Export represents the configuration of the IPFIX export of aggregated flows
+type Export struct {
+	Enabled bool   `yaml:"enabled"`
+	Target  string `yaml:"target"`
+
+	// DomainID is the observation domain ID of exported messages
+	DomainID uint32 `yaml:"domain_id"`
+
+	// Keys are the fields flows are aggregated by per aggregation period
+	// (Router, SrcAddr, DstAddr, Protocol, IntIn, IntOut, NextHop, SrcAsn, DstAsn,
+	// NextHopAsn, SrcPfx, DstPfx, SrcPort, DstPort)
+	Keys []string `yaml:"keys"`
+
+	// TemplateRefresh is the interval in seconds templates are resent in
+	TemplateRefresh int64 `yaml:"template_refresh"`
+
+	// MaxMessageSize is the maximum size of an IPFIX message in bytes
+	MaxMessageSize int `yaml:"max_message_size"`
+
+	// QueueSize is the number of annotated flows buffered before they are dropped
+	QueueSize int `yaml:"queue_size"`
 }
 
 // BGPAugment represents BGP augmentation configuration
@@ -46,6 +353,42 @@ type BGPAugment struct {
 type Server struct {
 	Enabled *bool  `yaml:"enabled"`
 	Listen  string `yaml:"listen"`
+
+	// ListenAddresses overrides Listen with multiple addresses to listen on
+	ListenAddresses []string `yaml:"listen_addresses"`
+
+	// ReusePort opens one SO_REUSEPORT socket per reader and listen address
+	ReusePort bool `yaml:"reuse_port"`
+
+	// ReceiveBuffer is the socket receive buffer size in bytes. 0 keeps the system default.
+	ReceiveBuffer int `yaml:"receive_buffer"`
+}
+
+// Addresses returns the addresses a server listens on
+func (s *Server) Addresses() []string {
+	if len(s.ListenAddresses) > 0 {
+		return s.ListenAddresses
+	}
+	return []string{s.Listen}
+}
+
+// Ingest represents the configuration of the gRPC flow ingest service
+type Ingest struct {
+	Server    `yaml:",inline"`
+	Producers []Producer `yaml:"producers"`
+
+	// TLSCert and TLSKey are the PEM files of the certificate and key of the service
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+
+	// Insecure allows producers to authenticate without TLS, sending their tokens in clear text
+	Insecure bool `yaml:"insecure"`
+}
+
+// Producer represents a client allowed to ingest flows via gRPC
+type Producer struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
 }
 
 // Agent represents an agent config
@@ -54,6 +397,36 @@ type Agent struct {
 	IPAddress     string `yaml:"ip_address"`
 	SNMPCommunity string `yaml:"snmp_community"`
 	SampleRate    uint64 `yaml:"sample_rate"`
+
+	// RateLimit overrides the number of flows per second accepted from the agent
+	RateLimit float64 `yaml:"rate_limit"`
+
+	// SourceID matches NetFlow v9 packets by their source ID instead of their source address
+	SourceID *uint32 `yaml:"source_id"`
+
+	// ObservationDomainID matches IPFIX messages by their observation domain ID instead of their source address
+	ObservationDomainID *uint32 `yaml:"observation_domain_id"`
+
+	// SflowAgentAddress matches sFlow datagrams by their agent address instead of their source address
+	SflowAgentAddress string `yaml:"sflow_agent_address"`
+
+	// BGPAddress is the address BGP sessions of the agent originate from if it differs from IPAddress
+	BGPAddress string `yaml:"bgp_address"`
+
+	// BIRDQuery overrides the query template of bird annotators for flows of the agent
+	BIRDQuery string `yaml:"bird_query"`
+
+	// BIRDCountQuery overrides the count query template of bird annotators for flows of the
+	// agent. Agents overriding BIRDQuery only get results cached by prefix with it.
+	BIRDCountQuery string `yaml:"bird_count_query"`
+
+	// BIRDWatchQuery overrides the watch query template of bird annotators for the agent. Cached
+	// results of agents overriding BIRDQuery are only invalidated on route changes with it.
+	BIRDWatchQuery string `yaml:"bird_watch_query"`
+
+	// SourceAddress additionally restricts matching by SourceID, ObservationDomainID or
+	// SflowAgentAddress to packets from this address
+	SourceAddress string `yaml:"source_address"`
 }
 
 var (
@@ -63,6 +436,29 @@ var (
 	dfltCompressionLevel     = 6
 	dfltDataDir              = "data"
 	dfltCacheTime            = int64(1800)
+	dfltReplicationQueueSize = 1024
+
+	dfltAutoRegistrationNameTemplate = "{ip}"
+	dfltAutoRegistrationMaxAgents    = 1000
+	dfltRateLimitPolicy              = "drop"
+	dfltPipelinePolicy               = "block"
+
+	dfltLoadSheddingHighWatermark = 0.8
+	dfltLoadSheddingLowWatermark  = 0.5
+	dfltLoadSheddingMaxRatio      = uint64(64)
+	dfltLoadSheddingInterval      = 500
+
+	dfltReverseDNSCacheSize   = 65536
+	dfltReverseDNSTTL         = 3600
+	dfltReverseDNSNegativeTTL = 300
+	dfltReverseDNSTimeout     = 2000
+	dfltReverseDNSWorkers     = 8
+	dfltReverseDNSQueueSize   = 1024
+
+	dfltExportKeys            = []string{"Router", "SrcAddr", "DstAddr", "Protocol", "SrcPort", "DstPort"}
+	dfltExportTemplateRefresh = int64(600)
+	dfltExportMaxMessageSize  = 1400
+	dfltExportQueueSize       = 65536
 
 	dfltNetflowV9Listen = ":2055"
 	dfltNetflowV9       = Server{
@@ -90,9 +486,41 @@ var (
 		Listen:  dfltFrontendListen,
 	}
 
-	dfltBIRDSocket      = "/var/run/bird/bird.ctl"
-	dfltBIRD6Socket     = "/var/run/bird/bird6.ctl"
-	dfltBGPAugmentation = BGPAugment{
+	dfltIngestListen = ":4445"
+	dfltIngest       = Ingest{
+		Server: Server{
+			Enabled: boolPtr(false),
+			Listen:  dfltIngestListen,
+		},
+	}
+
+	dfltAnnotatorType             = "grpc"
+	dfltAnnotatorTimeout          = 1000
+	dfltAnnotatorFailureThreshold = 5
+	dfltAnnotatorProbeInterval    = 10000
+	dfltAnnotatorReloadInterval   = 10000
+	dfltAnnotatorBGPListen        = ":179"
+	dfltAnnotatorBGPHoldTime      = 90
+
+	dfltAnnotationBatchSize     = 64
+	dfltAnnotationFlushInterval = 10
+
+	dfltBIRDVersion       = 1
+	dfltBIRDCacheSize     = 100000
+	dfltBIRDCacheTTL      = 300
+	dfltBIRDQuery         = "show route all for {addr} protocol nf_{router}"
+	dfltBIRD2Query        = "show route all for {addr} table {table} protocol nf_{router}"
+	dfltBIRDCountQuery    = "show route where net ~ [ {prefix}+ ] protocol nf_{router} count"
+	dfltBIRD2CountQuery   = "show route in {prefix} table {table} protocol nf_{router} count"
+	dfltBIRDWatchQuery    = "show route protocol nf_{router} count"
+	dfltBIRD2WatchQuery   = "show route table {table} protocol nf_{router} count"
+	dfltBIRDWatchInterval = 10
+	dfltBIRDTable         = "master"
+	dfltBIRD2Table4       = "master4"
+	dfltBIRD2Table6       = "master6"
+	dfltBIRDSocket        = "/var/run/bird/bird.ctl"
+	dfltBIRD6Socket       = "/var/run/bird/bird6.ctl"
+	dfltBGPAugmentation   = BGPAugment{
 		BIRDSocket:  dfltBIRDSocket,
 		BIRD6Socket: dfltBIRD6Socket,
 	}
@@ -113,6 +541,30 @@ func New(filename string) (*Config, error) {
 
 	cfg.defaults()
 
+	if cfg.RateLimit.Policy != "drop" && cfg.RateLimit.Policy != "downsample" {
+		return nil, fmt.Errorf("Unknown rate limit policy: %s", cfg.RateLimit.Policy)
+	}
+
+	for stage, q := range cfg.Pipeline.Stages {
+		if q.Policy != "" && q.Policy != "block" && q.Policy != "drop" {
+			return nil, fmt.Errorf("Unknown queue policy of stage %s: %s", stage, q.Policy)
+		}
+	}
+	if cfg.Pipeline.Policy != "block" && cfg.Pipeline.Policy != "drop" {
+		return nil, fmt.Errorf("Unknown queue policy: %s", cfg.Pipeline.Policy)
+	}
+
+	if (cfg.Ingest.TLSCert == "") != (cfg.Ingest.TLSKey == "") {
+		return nil, fmt.Errorf("Ingest requires both tls_cert and tls_key")
+	}
+	if *cfg.Ingest.Enabled && len(cfg.Ingest.Producers) > 0 && cfg.Ingest.TLSCert == "" && !cfg.Ingest.Insecure {
+		return nil, fmt.Errorf("Ingest producer tokens require tls_cert and tls_key unless insecure is set")
+	}
+
+	if cfg.LoadShedding.Enabled && cfg.LoadShedding.LowWatermark >= cfg.LoadShedding.HighWatermark {
+		return nil, fmt.Errorf("Low watermark of load shedding must be below high watermark")
+	}
+
 	cfg.AgentsNameByIP = make(map[string]string)
 	for _, agent := range cfg.Agents {
 		if _, ok := cfg.AgentsNameByIP[agent.IPAddress]; ok {
@@ -181,6 +633,16 @@ func (cfg *Config) defaults() {
 		cfg.Frontend.Enabled = dfltServerEnabled
 	}
 
+	if cfg.Ingest == nil {
+		cfg.Ingest = ingestPtr(dfltIngest)
+	}
+	if cfg.Ingest.Listen == "" {
+		cfg.Ingest.Listen = dfltIngestListen
+	}
+	if cfg.Ingest.Enabled == nil {
+		cfg.Ingest.Enabled = boolPtr(false)
+	}
+
 	if cfg.BGPAugmentation == nil {
 		cfg.BGPAugmentation = &dfltBGPAugmentation
 	}
@@ -191,6 +653,111 @@ func (cfg *Config) defaults() {
 		cfg.BGPAugmentation.BIRD6Socket = dfltBIRD6Socket
 	}
 
+	cfg.annotatorDefaults()
+
+	if cfg.Annotation == nil {
+		cfg.Annotation = &Annotation{}
+	}
+	if cfg.Annotation.BatchSize == 0 {
+		cfg.Annotation.BatchSize = dfltAnnotationBatchSize
+	}
+	if cfg.Annotation.FlushInterval == 0 {
+		cfg.Annotation.FlushInterval = dfltAnnotationFlushInterval
+	}
+
+	for key, repl := range cfg.Replication {
+		if repl.Name == "" {
+			cfg.Replication[key].Name = repl.Address
+		}
+		if repl.QueueSize == 0 {
+			cfg.Replication[key].QueueSize = dfltReplicationQueueSize
+		}
+	}
+
+	if cfg.Export == nil {
+		cfg.Export = &Export{}
+	}
+	if len(cfg.Export.Keys) == 0 {
+		cfg.Export.Keys = dfltExportKeys
+	}
+	if cfg.Export.TemplateRefresh == 0 {
+		cfg.Export.TemplateRefresh = dfltExportTemplateRefresh
+	}
+	if cfg.Export.MaxMessageSize == 0 {
+		cfg.Export.MaxMessageSize = dfltExportMaxMessageSize
+	}
+	if cfg.Export.QueueSize == 0 {
+		cfg.Export.QueueSize = dfltExportQueueSize
+	}
+
+	if cfg.Pipeline == nil {
+		cfg.Pipeline = &Pipeline{}
+	}
+	if cfg.Pipeline.Policy == "" {
+		cfg.Pipeline.Policy = dfltPipelinePolicy
+	}
+
+	if cfg.LoadShedding == nil {
+		cfg.LoadShedding = &LoadShedding{}
+	}
+	if cfg.LoadShedding.HighWatermark == 0 {
+		cfg.LoadShedding.HighWatermark = dfltLoadSheddingHighWatermark
+	}
+	if cfg.LoadShedding.LowWatermark == 0 {
+		cfg.LoadShedding.LowWatermark = dfltLoadSheddingLowWatermark
+	}
+	if cfg.LoadShedding.MaxRatio == 0 {
+		cfg.LoadShedding.MaxRatio = dfltLoadSheddingMaxRatio
+	}
+	if cfg.LoadShedding.Interval == 0 {
+		cfg.LoadShedding.Interval = dfltLoadSheddingInterval
+	}
+
+	if cfg.RateLimit == nil {
+		cfg.RateLimit = &RateLimit{}
+	}
+	if cfg.RateLimit.Policy == "" {
+		cfg.RateLimit.Policy = dfltRateLimitPolicy
+	}
+
+	if cfg.ReverseDNS == nil {
+		cfg.ReverseDNS = &ReverseDNS{}
+	}
+	if cfg.ReverseDNS.CacheSize == 0 {
+		cfg.ReverseDNS.CacheSize = dfltReverseDNSCacheSize
+	}
+	if cfg.ReverseDNS.TTL == 0 {
+		cfg.ReverseDNS.TTL = dfltReverseDNSTTL
+	}
+	if cfg.ReverseDNS.NegativeTTL == 0 {
+		cfg.ReverseDNS.NegativeTTL = dfltReverseDNSNegativeTTL
+	}
+	if cfg.ReverseDNS.Timeout == 0 {
+		cfg.ReverseDNS.Timeout = dfltReverseDNSTimeout
+	}
+	if cfg.ReverseDNS.Workers == 0 {
+		cfg.ReverseDNS.Workers = dfltReverseDNSWorkers
+	}
+	if cfg.ReverseDNS.QueueSize == 0 {
+		cfg.ReverseDNS.QueueSize = dfltReverseDNSQueueSize
+	}
+
+	if cfg.AutoRegistration == nil {
+		cfg.AutoRegistration = &AutoRegistration{}
+	}
+	if cfg.AutoRegistration.MaxAgents == 0 {
+		cfg.AutoRegistration.MaxAgents = dfltAutoRegistrationMaxAgents
+	}
+	if cfg.AutoRegistration.NameTemplate == "" {
+		cfg.AutoRegistration.NameTemplate = dfltAutoRegistrationNameTemplate
+	}
+	if cfg.AutoRegistration.SNMPCommunity == "" {
+		cfg.AutoRegistration.SNMPCommunity = cfg.DefaultSNMPCommunity
+	}
+	if cfg.AutoRegistration.SampleRate == 0 {
+		cfg.AutoRegistration.SampleRate = dfltSampleRate
+	}
+
 	if cfg.Agents != nil {
 		for key, agent := range cfg.Agents {
 			if agent.SNMPCommunity == "" {
@@ -203,6 +770,130 @@ func (cfg *Config) defaults() {
 	}
 }
 
+// annotatorDefaults sets the defaults of annotators. With bgp_augmentation enabled a bird annotator
+// is appended unless one is configured explicitly. With tag groups a tag annotator is appended likewise.
+func (cfg *Config) annotatorDefaults() {
+	bird := false
+	tag := false
+	for i := range cfg.Annotators {
+		a := &cfg.Annotators[i]
+		if a.Type == "" {
+			a.Type = dfltAnnotatorType
+		}
+		if a.Timeout == 0 {
+			a.Timeout = dfltAnnotatorTimeout
+		}
+		if a.FailureThreshold == 0 {
+			a.FailureThreshold = dfltAnnotatorFailureThreshold
+		}
+		if a.ProbeInterval == 0 {
+			a.ProbeInterval = dfltAnnotatorProbeInterval
+		}
+		if a.ReloadInterval == 0 {
+			a.ReloadInterval = dfltAnnotatorReloadInterval
+		}
+		if a.Type == "bgp" {
+			if a.Listen == "" {
+				a.Listen = dfltAnnotatorBGPListen
+			}
+			if a.HoldTime == 0 {
+				a.HoldTime = dfltAnnotatorBGPHoldTime
+			}
+		}
+		if a.Type == "tag" {
+			tag = true
+		}
+		if a.Type != "bird" {
+			continue
+		}
+
+		bird = true
+		if a.BIRDSocket == "" {
+			a.BIRDSocket = cfg.BGPAugmentation.BIRDSocket
+		}
+		if a.BIRD6Socket == "" {
+			a.BIRD6Socket = cfg.BGPAugmentation.BIRD6Socket
+		}
+		a.birdDefaults()
+	}
+
+	if cfg.BGPAugmentation.Enabled && !bird {
+		a := Annotator{
+			Name:             "bird",
+			Type:             "bird",
+			BIRDSocket:       cfg.BGPAugmentation.BIRDSocket,
+			BIRD6Socket:      cfg.BGPAugmentation.BIRD6Socket,
+			Timeout:          dfltAnnotatorTimeout,
+			FailureThreshold: dfltAnnotatorFailureThreshold,
+			ProbeInterval:    dfltAnnotatorProbeInterval,
+		}
+		a.birdDefaults()
+		cfg.Annotators = append(cfg.Annotators, a)
+	}
+
+	if len(cfg.TagGroups) > 0 && !tag {
+		cfg.Annotators = append(cfg.Annotators, Annotator{
+			Name:             "tag",
+			Type:             "tag",
+			Timeout:          dfltAnnotatorTimeout,
+			FailureThreshold: dfltAnnotatorFailureThreshold,
+			ProbeInterval:    dfltAnnotatorProbeInterval,
+		})
+	}
+}
+
+// birdDefaults sets the defaults of a bird annotator depending on the version of BIRD. The
+// default count and watch queries match the default query only.
+func (a *Annotator) birdDefaults() {
+	if a.BIRDVersion == 0 {
+		a.BIRDVersion = dfltBIRDVersion
+	}
+	if a.CacheSize == 0 {
+		a.CacheSize = dfltBIRDCacheSize
+	}
+	if a.CacheTTL == 0 {
+		a.CacheTTL = dfltBIRDCacheTTL
+	}
+	if a.WatchInterval == 0 {
+		a.WatchInterval = dfltBIRDWatchInterval
+	}
+
+	if a.BIRDVersion == 2 {
+		if a.BIRDQuery == "" {
+			a.BIRDQuery = dfltBIRD2Query
+			if a.BIRDCountQuery == "" {
+				a.BIRDCountQuery = dfltBIRD2CountQuery
+			}
+			if a.BIRDWatchQuery == "" {
+				a.BIRDWatchQuery = dfltBIRD2WatchQuery
+			}
+		}
+		if a.BIRDTable4 == "" {
+			a.BIRDTable4 = dfltBIRD2Table4
+		}
+		if a.BIRDTable6 == "" {
+			a.BIRDTable6 = dfltBIRD2Table6
+		}
+		return
+	}
+
+	if a.BIRDQuery == "" {
+		a.BIRDQuery = dfltBIRDQuery
+		if a.BIRDCountQuery == "" {
+			a.BIRDCountQuery = dfltBIRDCountQuery
+		}
+		if a.BIRDWatchQuery == "" {
+			a.BIRDWatchQuery = dfltBIRDWatchQuery
+		}
+	}
+	if a.BIRDTable4 == "" {
+		a.BIRDTable4 = dfltBIRDTable
+	}
+	if a.BIRDTable6 == "" {
+		a.BIRDTable6 = dfltBIRDTable
+	}
+}
+
 func uint64Ptr(x uint64) *uint64 {
 	return &x
 }
@@ -211,6 +902,10 @@ func srvPtr(srv Server) *Server {
 	return &srv
 }
 
+func ingestPtr(ingest Ingest) *Ingest {
+	return &ingest
+}
+
 func boolPtr(v bool) *bool {
 	return &v
 }
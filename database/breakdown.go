@@ -36,6 +36,21 @@ type BreakdownFlags struct {
 	DstPort    bool
 	IntInName  bool
 	IntOutName bool
+
+	PostNatSrcAddr bool
+	PostNatDstAddr bool
+	PostNatSrcPort bool
+	PostNatDstPort bool
+	NatEvent       bool
+	FirewallEvent  bool
+
+	SrcCountry bool
+	DstCountry bool
+	SrcCity    bool
+	DstCity    bool
+
+	SrcTag bool
+	DstTag bool
 }
 
 var breakdownLabels = map[int]string{
@@ -55,6 +70,21 @@ var breakdownLabels = map[int]string{
 	FieldDstPort:    "DstPort",
 	FieldIntInName:  "IntInName",
 	FieldIntOutName: "IntOutName",
+
+	FieldPostNatSrcAddr: "PostNatSrcAddr",
+	FieldPostNatDstAddr: "PostNatDstAddr",
+	FieldPostNatSrcPort: "PostNatSrcPort",
+	FieldPostNatDstPort: "PostNatDstPort",
+	FieldNatEvent:       "NatEvent",
+	FieldFirewallEvent:  "FirewallEvent",
+
+	FieldSrcCountry: "SrcCountry",
+	FieldDstCountry: "DstCountry",
+	FieldSrcCity:    "SrcCity",
+	FieldDstCity:    "DstCity",
+
+	FieldSrcTag: "SrcTag",
+	FieldDstTag: "DstTag",
 }
 
 // GetBreakdownLabels returns a sorted list of known breakdown labels
@@ -76,6 +106,18 @@ func GetBreakdownLabels() []string {
 		breakdownLabels[FieldDstPort],
 		breakdownLabels[FieldIntInName],
 		breakdownLabels[FieldIntOutName],
+		breakdownLabels[FieldPostNatSrcAddr],
+		breakdownLabels[FieldPostNatDstAddr],
+		breakdownLabels[FieldPostNatSrcPort],
+		breakdownLabels[FieldPostNatDstPort],
+		breakdownLabels[FieldNatEvent],
+		breakdownLabels[FieldFirewallEvent],
+		breakdownLabels[FieldSrcCountry],
+		breakdownLabels[FieldDstCountry],
+		breakdownLabels[FieldSrcCity],
+		breakdownLabels[FieldDstCity],
+		breakdownLabels[FieldSrcTag],
+		breakdownLabels[FieldDstTag],
 	}
 }
 
@@ -131,6 +173,30 @@ func (bf *BreakdownFlags) Set(keys []string) error {
 			bf.IntInName = true
 		case breakdownLabels[FieldIntOutName]:
 			bf.IntOutName = true
+		case breakdownLabels[FieldPostNatSrcAddr]:
+			bf.PostNatSrcAddr = true
+		case breakdownLabels[FieldPostNatDstAddr]:
+			bf.PostNatDstAddr = true
+		case breakdownLabels[FieldPostNatSrcPort]:
+			bf.PostNatSrcPort = true
+		case breakdownLabels[FieldPostNatDstPort]:
+			bf.PostNatDstPort = true
+		case breakdownLabels[FieldNatEvent]:
+			bf.NatEvent = true
+		case breakdownLabels[FieldFirewallEvent]:
+			bf.FirewallEvent = true
+		case breakdownLabels[FieldSrcCountry]:
+			bf.SrcCountry = true
+		case breakdownLabels[FieldDstCountry]:
+			bf.DstCountry = true
+		case breakdownLabels[FieldSrcCity]:
+			bf.SrcCity = true
+		case breakdownLabels[FieldDstCity]:
+			bf.DstCity = true
+		case breakdownLabels[FieldSrcTag]:
+			bf.SrcTag = true
+		case breakdownLabels[FieldDstTag]:
+			bf.DstTag = true
 
 		default:
 			return fmt.Errorf("invalid breakdown key: %s", key)
@@ -190,6 +256,42 @@ func (bf *BreakdownFlags) Count() (count int) {
 	if bf.IntOutName {
 		count++
 	}
+	if bf.PostNatSrcAddr {
+		count++
+	}
+	if bf.PostNatDstAddr {
+		count++
+	}
+	if bf.PostNatSrcPort {
+		count++
+	}
+	if bf.PostNatDstPort {
+		count++
+	}
+	if bf.NatEvent {
+		count++
+	}
+	if bf.FirewallEvent {
+		count++
+	}
+	if bf.SrcCountry {
+		count++
+	}
+	if bf.DstCountry {
+		count++
+	}
+	if bf.SrcCity {
+		count++
+	}
+	if bf.DstCity {
+		count++
+	}
+	if bf.SrcTag {
+		count++
+	}
+	if bf.DstTag {
+		count++
+	}
 
 	return
 }
@@ -284,6 +386,42 @@ func breakdown(node *avltree.TreeNode, vals ...interface{}) {
 		if bd.DstPort {
 			key[FieldDstPort] = fmt.Sprintf("%d", fl.DstPort)
 		}
+		if bd.PostNatSrcAddr {
+			key[FieldPostNatSrcAddr] = net.IP(fl.PostNatSrcAddr).String()
+		}
+		if bd.PostNatDstAddr {
+			key[FieldPostNatDstAddr] = net.IP(fl.PostNatDstAddr).String()
+		}
+		if bd.PostNatSrcPort {
+			key[FieldPostNatSrcPort] = fmt.Sprintf("%d", fl.PostNatSrcPort)
+		}
+		if bd.PostNatDstPort {
+			key[FieldPostNatDstPort] = fmt.Sprintf("%d", fl.PostNatDstPort)
+		}
+		if bd.NatEvent {
+			key[FieldNatEvent] = fmt.Sprintf("%d", fl.NatEvent)
+		}
+		if bd.FirewallEvent {
+			key[FieldFirewallEvent] = fmt.Sprintf("%d", fl.FirewallEvent)
+		}
+		if bd.SrcCountry {
+			key[FieldSrcCountry] = locationKey(fl.SrcCountry)
+		}
+		if bd.DstCountry {
+			key[FieldDstCountry] = locationKey(fl.DstCountry)
+		}
+		if bd.SrcCity {
+			key[FieldSrcCity] = locationKey(fl.SrcCity)
+		}
+		if bd.DstCity {
+			key[FieldDstCity] = locationKey(fl.DstCity)
+		}
+		if bd.SrcTag {
+			key[FieldSrcTag] = tagKey(fl.SrcTag)
+		}
+		if bd.DstTag {
+			key[FieldDstTag] = tagKey(fl.DstTag)
+		}
 
 		// Build sum for key
 		buckets[key] += fl.Size * fl.Samplerate
@@ -294,3 +432,19 @@ func breakdown(node *avltree.TreeNode, vals ...interface{}) {
 		sums.Lock.Unlock()
 	}
 }
+
+// locationKey returns the breakdown key of country or city `loc`
+func locationKey(loc string) string {
+	if loc == "" {
+		return "unknown"
+	}
+	return loc
+}
+
+// tagKey returns the breakdown key of tag group `tag`
+func tagKey(tag string) string {
+	if tag == "" {
+		return "untagged"
+	}
+	return tag
+}
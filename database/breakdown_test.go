@@ -23,7 +23,7 @@ func TestBreakdownKeyString(t *testing.T) {
 	for i := range breakdownLabels {
 		key[i] = strconv.Itoa(i)
 	}
-	assert.Equal("Family:2,SrcAddr:3,DstAddr:4,Protocol:5,IntIn:6,IntOut:7,NextHop:8,SrcAsn:9,DstAsn:10,NextHopAsn:11,SrcPfx:12,DstPfx:13,SrcPort:14,DstPort:15,IntInName:16,IntOutName:17", key.Join("%s:%s"))
+	assert.Equal("Family:2,SrcAddr:3,DstAddr:4,Protocol:5,IntIn:6,IntOut:7,NextHop:8,SrcAsn:9,DstAsn:10,NextHopAsn:11,SrcPfx:12,DstPfx:13,SrcPort:14,DstPort:15,IntInName:16,IntOutName:17,PostNatSrcAddr:18,PostNatDstAddr:19,PostNatSrcPort:20,PostNatDstPort:21,NatEvent:22,FirewallEvent:23,SrcCountry:24,DstCountry:25,SrcCity:26,DstCity:27,SrcTag:28,DstTag:29", key.Join("%s:%s"))
 }
 
 func TestBreakdownFlags(t *testing.T) {
@@ -22,6 +22,7 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/bio-routing/tflow2/agents"
 	"github.com/bio-routing/tflow2/iana"
 	"github.com/bio-routing/tflow2/intfmapper"
 
@@ -49,26 +50,26 @@ type FlowDatabase struct {
 	anonymize      bool
 	Input          chan *netflow.Flow
 	intfMapper     intfmapper.IntfMapperInterface
-	agentsNameByIP map[string]string
+	registry       *agents.Registry
 	iana           *iana.IANA
 }
 
 const anyIndex = uint8(0)
 
 // New creates a new FlowDatabase and returns a pointer to it
-func New(aggregation int64, maxAge int64, numAddWorker int, debug int, compLevel int, storage string, anonymize bool, intfMapper intfmapper.IntfMapperInterface, agentsNameByIP map[string]string, iana *iana.IANA) *FlowDatabase {
+func New(aggregation int64, maxAge int64, numAddWorker int, debug int, compLevel int, storage string, anonymize bool, intfMapper intfmapper.IntfMapperInterface, registry *agents.Registry, iana *iana.IANA, input chan *netflow.Flow) *FlowDatabase {
 	flowDB := &FlowDatabase{
 		maxAge:         maxAge,
 		aggregation:    aggregation,
 		compLevel:      compLevel,
-		Input:          make(chan *netflow.Flow),
+		Input:          input,
 		lastDump:       time.Now().Unix(),
 		storage:        storage,
 		debug:          debug,
 		flows:          make(FlowsByTimeRtr),
 		anonymize:      anonymize,
 		intfMapper:     intfMapper,
-		agentsNameByIP: agentsNameByIP,
+		registry:       registry,
 		iana:           iana,
 	}
 
@@ -132,6 +133,18 @@ func (fdb *FlowDatabase) getTimeGroup(fl *netflow.Flow, rtr string) *TimeGroup {
 			DstPfx:            newMapTree(),
 			SrcPort:           newMapTree(),
 			DstPort:           newMapTree(),
+			PostNatSrcAddr:    newMapTree(),
+			PostNatDstAddr:    newMapTree(),
+			PostNatSrcPort:    newMapTree(),
+			PostNatDstPort:    newMapTree(),
+			NatEvent:          newMapTree(),
+			FirewallEvent:     newMapTree(),
+			SrcCountry:        newMapTree(),
+			DstCountry:        newMapTree(),
+			SrcCity:           newMapTree(),
+			DstCity:           newMapTree(),
+			SrcTag:            newMapTree(),
+			DstTag:            newMapTree(),
 			InterfaceIDByName: fdb.intfMapper.GetInterfaceIDByName(rtr),
 		}
 		flows[rtr] = timeGroup
@@ -145,12 +158,12 @@ func (fdb *FlowDatabase) Add(fl *netflow.Flow) {
 	// build indices for map access
 	rtrip := net.IP(fl.Router)
 
-	if _, ok := fdb.agentsNameByIP[rtrip.String()]; !ok {
+	rtrName, ok := fdb.registry.Name(rtrip)
+	if !ok {
 		glog.Warningf("Unknown flow source: %s", rtrip.String())
 		return
 	}
 
-	rtrName := fdb.agentsNameByIP[rtrip.String()]
 	timeGroup := fdb.getTimeGroup(fl, rtrName)
 
 	fdb.lock.RLock()
@@ -161,6 +174,8 @@ func (fdb *FlowDatabase) Add(fl *netflow.Flow) {
 	}
 
 	// Insert into indices
+	timeGroup.lock.Lock()
+	defer timeGroup.lock.Unlock()
 	timeGroup.Any.Insert(anyIndex, fl)
 	timeGroup.SrcAddr.Insert(net.IP(fl.SrcAddr), fl)
 	timeGroup.DstAddr.Insert(net.IP(fl.DstAddr), fl)
@@ -175,6 +190,18 @@ func (fdb *FlowDatabase) Add(fl *netflow.Flow) {
 	timeGroup.DstPfx.Insert(fl.DstPfx.String(), fl)
 	timeGroup.SrcPort.Insert(fl.SrcPort, fl)
 	timeGroup.DstPort.Insert(fl.DstPort, fl)
+	timeGroup.PostNatSrcAddr.Insert(net.IP(fl.PostNatSrcAddr), fl)
+	timeGroup.PostNatDstAddr.Insert(net.IP(fl.PostNatDstAddr), fl)
+	timeGroup.PostNatSrcPort.Insert(uint16(fl.PostNatSrcPort), fl)
+	timeGroup.PostNatDstPort.Insert(uint16(fl.PostNatDstPort), fl)
+	timeGroup.NatEvent.Insert(byte(fl.NatEvent), fl)
+	timeGroup.FirewallEvent.Insert(byte(fl.FirewallEvent), fl)
+	timeGroup.SrcCountry.Insert(fl.SrcCountry, fl)
+	timeGroup.DstCountry.Insert(fl.DstCountry, fl)
+	timeGroup.SrcCity.Insert(fl.SrcCity, fl)
+	timeGroup.DstCity.Insert(fl.DstCity, fl)
+	timeGroup.SrcTag.Insert(fl.SrcTag, fl)
+	timeGroup.DstTag.Insert(fl.DstTag, fl)
 }
 
 // CurrentTimeslot returns the beginning of the current timeslot
@@ -221,6 +248,27 @@ func (fdb *FlowDatabase) Dumper() {
 	}
 }
 
+// DumpAll dumps all flows in `fdb` to hard drive regardless of their age. It returns when all files have been written.
+func (fdb *FlowDatabase) DumpAll() {
+	type slot struct {
+		ts     int64
+		router string
+	}
+
+	fdb.lock.RLock()
+	slots := make([]slot, 0)
+	for ts := range fdb.flows {
+		for router := range fdb.flows[ts] {
+			slots = append(slots, slot{ts: ts, router: router})
+		}
+	}
+	fdb.lock.RUnlock()
+
+	for _, s := range slots {
+		fdb.dumpToDisk(s.ts, s.router)
+	}
+}
+
 func (fdb *FlowDatabase) dumpToDisk(ts int64, router string) {
 	if fdb.storage == "" {
 		return
@@ -228,9 +276,12 @@ func (fdb *FlowDatabase) dumpToDisk(ts int64, router string) {
 
 	fdb.lock.RLock()
 	tg := fdb.flows[ts][router]
-	tree := fdb.flows[ts][router].Any.Get(anyIndex)
 	fdb.lock.RUnlock()
 
+	tg.lock.RLock()
+	defer tg.lock.RUnlock()
+	tree := tg.Any.Get(anyIndex)
+
 	// Create flow proto buffer
 	flows := &netflow.Flows{}
 
@@ -58,6 +58,18 @@ const (
 	FieldDstPort
 	FieldIntInName
 	FieldIntOutName
+	FieldPostNatSrcAddr
+	FieldPostNatDstAddr
+	FieldPostNatSrcPort
+	FieldPostNatDstPort
+	FieldNatEvent
+	FieldFirewallEvent
+	FieldSrcCountry
+	FieldDstCountry
+	FieldSrcCity
+	FieldDstCity
+	FieldSrcTag
+	FieldDstTag
 	FieldMax
 )
 
@@ -80,6 +92,21 @@ var fieldNames = map[string]int{
 	"DstPort":    FieldDstPort,
 	"IntInName":  FieldIntInName,
 	"IntOutName": FieldIntOutName,
+
+	"PostNatSrcAddr": FieldPostNatSrcAddr,
+	"PostNatDstAddr": FieldPostNatDstAddr,
+	"PostNatSrcPort": FieldPostNatSrcPort,
+	"PostNatDstPort": FieldPostNatDstPort,
+	"NatEvent":       FieldNatEvent,
+	"FirewallEvent":  FieldFirewallEvent,
+
+	"SrcCountry": FieldSrcCountry,
+	"DstCountry": FieldDstCountry,
+	"SrcCity":    FieldSrcCity,
+	"DstCity":    FieldDstCity,
+
+	"SrcTag": FieldSrcTag,
+	"DstTag": FieldDstTag,
 }
 
 type void struct{}
@@ -278,6 +305,66 @@ func validateFlow(fl *netflow.Flow, query Query, interfaceIDByName intfmapper.In
 				return false
 			}
 			continue
+		case FieldPostNatSrcAddr:
+			if !net.IP(fl.PostNatSrcAddr).Equal(net.IP(c.Operand)) {
+				return false
+			}
+			continue
+		case FieldPostNatDstAddr:
+			if !net.IP(fl.PostNatDstAddr).Equal(net.IP(c.Operand)) {
+				return false
+			}
+			continue
+		case FieldPostNatSrcPort:
+			if fl.PostNatSrcPort != uint32(convert.Uint16b(c.Operand)) {
+				return false
+			}
+			continue
+		case FieldPostNatDstPort:
+			if fl.PostNatDstPort != uint32(convert.Uint16b(c.Operand)) {
+				return false
+			}
+			continue
+		case FieldNatEvent:
+			if fl.NatEvent != uint32(c.Operand[0]) {
+				return false
+			}
+			continue
+		case FieldFirewallEvent:
+			if fl.FirewallEvent != uint32(c.Operand[0]) {
+				return false
+			}
+			continue
+		case FieldSrcCountry:
+			if fl.SrcCountry != string(c.Operand) {
+				return false
+			}
+			continue
+		case FieldDstCountry:
+			if fl.DstCountry != string(c.Operand) {
+				return false
+			}
+			continue
+		case FieldSrcCity:
+			if fl.SrcCity != string(c.Operand) {
+				return false
+			}
+			continue
+		case FieldDstCity:
+			if fl.DstCity != string(c.Operand) {
+				return false
+			}
+			continue
+		case FieldSrcTag:
+			if fl.SrcTag != string(c.Operand) {
+				return false
+			}
+			continue
+		case FieldDstTag:
+			if fl.DstTag != string(c.Operand) {
+				return false
+			}
+			continue
 		}
 	}
 	return true
@@ -8,6 +8,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/bio-routing/tflow2/agents"
+	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/convert"
 	"github.com/bio-routing/tflow2/iana"
 	"github.com/bio-routing/tflow2/intfmapper"
@@ -33,6 +35,16 @@ func (m *intfMapper) GetInterfaceNameByID(agent string) intfmapper.InterfaceName
 	}
 }
 
+func testRegistry() *agents.Registry {
+	r, _ := agents.New([]config.Agent{
+		{
+			Name:      "test01.pop01",
+			IPAddress: net.IP([]byte{1, 2, 3, 4}).String(),
+		},
+	}, nil)
+	return r
+}
+
 func TestQuery(t *testing.T) {
 	minute := int64(60)
 	hour := int64(3600)
@@ -466,9 +478,7 @@ func TestQuery(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		fdb := New(minute, hour, 1, 0, 6, "", false, &intfMapper{}, map[string]string{
-			net.IP([]byte{1, 2, 3, 4}).String(): "test01.pop01",
-		}, iana.New())
+		fdb := New(minute, hour, 1, 0, 6, "", false, &intfMapper{}, testRegistry(), iana.New(), make(chan *netflow.Flow))
 
 		for _, flow := range test.flows {
 			fdb.Input <- flow
@@ -485,6 +495,298 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestQueryPostNat(t *testing.T) {
+	minute := int64(60)
+	hour := int64(3600)
+	ts1 := int64(3600)
+
+	flows := []*netflow.Flow{
+		&netflow.Flow{
+			Router:         []byte{1, 2, 3, 4},
+			Family:         4,
+			SrcAddr:        []byte{10, 0, 0, 1},
+			DstAddr:        []byte{30, 0, 0, 1},
+			Protocol:       6,
+			SrcPort:        12345,
+			DstPort:        443,
+			Size:           1000,
+			PostNatSrcAddr: []byte{192, 0, 2, 1},
+			PostNatSrcPort: 40001,
+			NatEvent:       1,
+			Samplerate:     1,
+			Timestamp:      ts1,
+		},
+		&netflow.Flow{
+			Router:         []byte{1, 2, 3, 4},
+			Family:         4,
+			SrcAddr:        []byte{10, 0, 0, 2},
+			DstAddr:        []byte{30, 0, 0, 1},
+			Protocol:       6,
+			SrcPort:        23456,
+			DstPort:        443,
+			Size:           2000,
+			PostNatSrcAddr: []byte{192, 0, 2, 1},
+			PostNatSrcPort: 40002,
+			NatEvent:       1,
+			Samplerate:     1,
+			Timestamp:      ts1,
+		},
+	}
+
+	query := &Query{
+		Cond: []Condition{
+			{
+				Field:    FieldAgent,
+				Operator: OpEqual,
+				Operand:  []byte("test01.pop01"),
+			},
+			{
+				Field:    FieldTimestamp,
+				Operator: OpEqual,
+				Operand:  convert.Uint64Byte(uint64(ts1)),
+			},
+			{
+				Field:    FieldPostNatSrcAddr,
+				Operator: OpEqual,
+				Operand:  convert.IPByteSlice("192.0.2.1"),
+			},
+			{
+				Field:    FieldPostNatSrcPort,
+				Operator: OpEqual,
+				Operand:  convert.Uint16Byte(uint16(40002)),
+			},
+		},
+		Breakdown: BreakdownFlags{
+			SrcAddr: true,
+			SrcPort: true,
+		},
+	}
+
+	fdb := New(minute, hour, 1, 0, 6, "", false, &intfMapper{}, testRegistry(), iana.New(), make(chan *netflow.Flow))
+
+	for _, flow := range flows {
+		fdb.Input <- flow
+	}
+
+	time.Sleep(time.Second)
+
+	result, err := fdb.RunQuery(query)
+	if err != nil {
+		t.Errorf("Unexpected error on RunQuery: %v", err)
+	}
+
+	assert.Equal(t, map[int64]BreakdownMap{
+		ts1: BreakdownMap{
+			BreakdownKey{
+				FieldSrcAddr: "10.0.0.2",
+				FieldSrcPort: "23456",
+			}: 2000,
+		},
+	}, result.Data)
+}
+
+func TestQueryCountry(t *testing.T) {
+	minute := int64(60)
+	hour := int64(3600)
+	ts1 := int64(3600)
+
+	flows := []*netflow.Flow{
+		&netflow.Flow{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 1},
+			DstAddr:    []byte{30, 0, 0, 1},
+			Size:       1000,
+			SrcCountry: "DE",
+			DstCountry: "US",
+			DstCity:    "Chicago",
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+		&netflow.Flow{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 2},
+			DstAddr:    []byte{30, 0, 0, 2},
+			Size:       2000,
+			SrcCountry: "DE",
+			DstCountry: "US",
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+		&netflow.Flow{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 3},
+			DstAddr:    []byte{30, 0, 0, 3},
+			Size:       4000,
+			SrcCountry: "NL",
+			DstCountry: "US",
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+	}
+
+	query := &Query{
+		Cond: []Condition{
+			{
+				Field:    FieldAgent,
+				Operator: OpEqual,
+				Operand:  []byte("test01.pop01"),
+			},
+			{
+				Field:    FieldTimestamp,
+				Operator: OpEqual,
+				Operand:  convert.Uint64Byte(uint64(ts1)),
+			},
+			{
+				Field:    FieldSrcCountry,
+				Operator: OpEqual,
+				Operand:  []byte("DE"),
+			},
+		},
+		Breakdown: BreakdownFlags{
+			DstCountry: true,
+			DstCity:    true,
+		},
+	}
+
+	fdb := New(minute, hour, 1, 0, 6, "", false, &intfMapper{}, testRegistry(), iana.New(), make(chan *netflow.Flow))
+
+	for _, flow := range flows {
+		fdb.Input <- flow
+	}
+
+	time.Sleep(time.Second)
+
+	result, err := fdb.RunQuery(query)
+	if err != nil {
+		t.Errorf("Unexpected error on RunQuery: %v", err)
+	}
+
+	assert.Equal(t, map[int64]BreakdownMap{
+		ts1: BreakdownMap{
+			BreakdownKey{
+				FieldDstCountry: "US",
+				FieldDstCity:    "Chicago",
+			}: 1000,
+			BreakdownKey{
+				FieldDstCountry: "US",
+				FieldDstCity:    "unknown",
+			}: 2000,
+		},
+	}, result.Data)
+}
+
+func TestQueryTag(t *testing.T) {
+	minute := int64(60)
+	hour := int64(3600)
+	ts1 := int64(3600)
+
+	flows := []*netflow.Flow{
+		&netflow.Flow{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 1},
+			DstAddr:    []byte{30, 0, 0, 1},
+			Size:       1000,
+			DstTag:     "customer-a",
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+		&netflow.Flow{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 2},
+			DstAddr:    []byte{30, 0, 0, 2},
+			Size:       2000,
+			DstTag:     "customer-a",
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+		&netflow.Flow{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{30, 0, 0, 3},
+			DstAddr:    []byte{40, 0, 0, 3},
+			Size:       4000,
+			SrcTag:     "customer-a",
+			DstTag:     "customer-b",
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+		&netflow.Flow{
+			Router:     []byte{1, 2, 3, 4},
+			Family:     4,
+			SrcAddr:    []byte{10, 0, 0, 4},
+			DstAddr:    []byte{50, 0, 0, 4},
+			Size:       500,
+			Samplerate: 1,
+			Timestamp:  ts1,
+		},
+	}
+
+	query := &Query{
+		Cond: []Condition{
+			{
+				Field:    FieldAgent,
+				Operator: OpEqual,
+				Operand:  []byte("test01.pop01"),
+			},
+			{
+				Field:    FieldTimestamp,
+				Operator: OpEqual,
+				Operand:  convert.Uint64Byte(uint64(ts1)),
+			},
+		},
+		Breakdown: BreakdownFlags{
+			DstTag: true,
+		},
+		TopN: 2,
+	}
+
+	fdb := New(minute, hour, 1, 0, 6, "", false, &intfMapper{}, testRegistry(), iana.New(), make(chan *netflow.Flow))
+
+	for _, flow := range flows {
+		fdb.Input <- flow
+	}
+
+	time.Sleep(time.Second)
+
+	result, err := fdb.RunQuery(query)
+	if err != nil {
+		t.Errorf("Unexpected error on RunQuery: %v", err)
+	}
+
+	assert.Equal(t, map[BreakdownKey]void{
+		BreakdownKey{FieldDstTag: "customer-b"}: void{},
+		BreakdownKey{FieldDstTag: "customer-a"}: void{},
+	}, result.TopKeys)
+	assert.Equal(t, map[int64]BreakdownMap{
+		ts1: BreakdownMap{
+			BreakdownKey{FieldDstTag: "customer-a"}: 3000,
+			BreakdownKey{FieldDstTag: "customer-b"}: 4000,
+			BreakdownKey{FieldDstTag: "untagged"}:   500,
+		},
+	}, result.Data)
+
+	query.Cond = append(query.Cond, Condition{
+		Field:    FieldSrcTag,
+		Operator: OpEqual,
+		Operand:  []byte("customer-a"),
+	})
+	result, err = fdb.RunQuery(query)
+	if err != nil {
+		t.Errorf("Unexpected error on RunQuery: %v", err)
+	}
+
+	assert.Equal(t, map[int64]BreakdownMap{
+		ts1: BreakdownMap{
+			BreakdownKey{FieldDstTag: "customer-b"}: 4000,
+		},
+	}, result.Data)
+}
+
 func dumpRes(res Result) {
 	for ts := range res.Data {
 		for k, v := range res.Data[ts] {
@@ -57,3 +57,26 @@ func (res *Result) WriteCSV(writer io.Writer) {
 		w.Write(append(line, fmt.Sprintf("%d", rest)))
 	}
 }
+
+// RenameKeys replaces the top keys by the keys `rename` returns for them. Keys must
+// be renamed to keys that are not in the result yet.
+func (res *Result) RenameKeys(rename func(BreakdownKey) BreakdownKey) {
+	renamed := make(map[BreakdownKey]BreakdownKey)
+	for k := range res.TopKeys {
+		if n := rename(k); n != k {
+			renamed[k] = n
+		}
+	}
+
+	for old, k := range renamed {
+		res.TopKeys[k] = res.TopKeys[old]
+		delete(res.TopKeys, old)
+
+		for _, buckets := range res.Data {
+			if v, ok := buckets[old]; ok {
+				buckets[k] = v
+				delete(buckets, old)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"net"
+	"sync"
 
 	"github.com/golang/glog"
 	"github.com/bio-routing/tflow2/avltree"
@@ -27,10 +28,28 @@ type TimeGroup struct {
 	DstPfx            *mapTree
 	SrcPort           *mapTree
 	DstPort           *mapTree
+	PostNatSrcAddr    *mapTree
+	PostNatDstAddr    *mapTree
+	PostNatSrcPort    *mapTree
+	PostNatDstPort    *mapTree
+	NatEvent          *mapTree
+	FirewallEvent     *mapTree
+	SrcCountry        *mapTree
+	DstCountry        *mapTree
+	SrcCity           *mapTree
+	DstCity           *mapTree
+	SrcTag            *mapTree
+	DstTag            *mapTree
 	InterfaceIDByName intfmapper.InterfaceIDByName
+
+	// lock protects the indices against queries while flows are added
+	lock sync.RWMutex
 }
 
 func (tg *TimeGroup) filterAndBreakdown(resSum *concurrentResSum, q *Query, iana *iana.IANA, intfMap intfmapper.InterfaceNameByID) BreakdownMap {
+	tg.lock.RLock()
+	defer tg.lock.RUnlock()
+
 	// candidates keeps a list of all trees that fulfill the queries criteria
 	candidates := make([]*avltree.Tree, 0)
 	for _, c := range q.Cond {
@@ -71,6 +90,30 @@ func (tg *TimeGroup) filterAndBreakdown(resSum *concurrentResSum, q *Query, iana
 		case FieldIntOutName:
 			intID := tg.InterfaceIDByName[string(c.Operand)]
 			candidates = append(candidates, tg.IntOut.Get(intID))
+		case FieldPostNatSrcAddr:
+			candidates = append(candidates, tg.PostNatSrcAddr.Get(net.IP(c.Operand)))
+		case FieldPostNatDstAddr:
+			candidates = append(candidates, tg.PostNatDstAddr.Get(net.IP(c.Operand)))
+		case FieldPostNatSrcPort:
+			candidates = append(candidates, tg.PostNatSrcPort.Get(convert.Uint16b(c.Operand)))
+		case FieldPostNatDstPort:
+			candidates = append(candidates, tg.PostNatDstPort.Get(convert.Uint16b(c.Operand)))
+		case FieldNatEvent:
+			candidates = append(candidates, tg.NatEvent.Get(c.Operand[0]))
+		case FieldFirewallEvent:
+			candidates = append(candidates, tg.FirewallEvent.Get(c.Operand[0]))
+		case FieldSrcCountry:
+			candidates = append(candidates, tg.SrcCountry.Get(c.Operand))
+		case FieldDstCountry:
+			candidates = append(candidates, tg.DstCountry.Get(c.Operand))
+		case FieldSrcCity:
+			candidates = append(candidates, tg.SrcCity.Get(c.Operand))
+		case FieldDstCity:
+			candidates = append(candidates, tg.DstCity.Get(c.Operand))
+		case FieldSrcTag:
+			candidates = append(candidates, tg.SrcTag.Get(c.Operand))
+		case FieldDstTag:
+			candidates = append(candidates, tg.DstTag.Get(c.Operand))
 		}
 	}
 
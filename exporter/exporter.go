@@ -0,0 +1,270 @@
+// Package exporter aggregates annotated flows and exports them as IPFIX to another collector
+package exporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// counterFields are appended to the key fields of every exported record
+var counterFields = []ipfix.FieldSpecifier{
+	{Type: ipfix.FlowStartSeconds, Length: 4},
+	{Type: ipfix.FlowEndSeconds, Length: 4},
+	{Type: ipfix.InBytes, Length: 8},
+	{Type: ipfix.InPkts, Length: 8},
+	{Type: ipfix.Flows, Length: 8},
+}
+
+// Exporter aggregates annotated flows per aggregation period and exports the records as IPFIX
+type Exporter struct {
+	input     chan *netflow.Flow
+	keys      []keyFunc
+	period    int64
+	conn      net.Conn
+	encoder   *ipfix.Encoder
+	templates map[string]uint16
+	slots     map[int64]map[string]*aggregate
+	debug     int
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// aggregate is a record of a time slot
+type aggregate struct {
+	template uint16
+	key      []byte
+	bytes    uint64
+	packets  uint64
+	flows    uint64
+}
+
+// New creates a new Exporter and starts aggregating flows
+func New(cfg *config.Config) (*Exporter, error) {
+	e, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	go e.run()
+	return e, nil
+}
+
+func newExporter(cfg *config.Config) (*Exporter, error) {
+	keys, err := getKeyFuncs(cfg.Export.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", cfg.Export.Target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to connect to export target %s", cfg.Export.Target)
+	}
+
+	return &Exporter{
+		input:     make(chan *netflow.Flow, cfg.Export.QueueSize),
+		keys:      keys,
+		period:    cfg.AggregationPeriod,
+		conn:      conn,
+		encoder:   ipfix.NewEncoder(cfg.Export.DomainID, cfg.Export.MaxMessageSize, cfg.Export.TemplateRefresh),
+		templates: make(map[string]uint16),
+		slots:     make(map[int64]map[string]*aggregate),
+		debug:     cfg.Debug,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Tee passes flows from `in` on to `next` and hands them to the exporter
+func (e *Exporter) Tee(in *queue.Queue, next *queue.Queue) {
+	go func() {
+		for fl := range in.C {
+			e.Offer(fl)
+			next.Put(fl)
+		}
+	}()
+}
+
+// Offer passes `fl` on for export. The flow is dropped if the exporter can not keep up.
+func (e *Exporter) Offer(fl *netflow.Flow) {
+	select {
+	case e.input <- fl:
+	default:
+		atomic.AddUint64(&stats.GlobalStats.ExportDrops, 1)
+	}
+}
+
+// Close exports all pending records and stops the exporter
+func (e *Exporter) Close() {
+	close(e.stop)
+	<-e.done
+	e.conn.Close()
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(time.Duration(e.period) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case fl := <-e.input:
+			e.add(fl)
+		case <-ticker.C:
+			e.flush(time.Now().Unix())
+		case <-e.stop:
+			for {
+				select {
+				case fl := <-e.input:
+					e.add(fl)
+				default:
+					e.flush(math.MaxInt64)
+					return
+				}
+			}
+		}
+	}
+}
+
+// add aggregates `fl` into the record of its time slot and key
+func (e *Exporter) add(fl *netflow.Flow) {
+	vals := make([]value, 0, len(e.keys))
+	for _, k := range e.keys {
+		vals = append(vals, k(fl)...)
+	}
+
+	shape := make([]byte, 0, 3*len(vals))
+	key := make([]byte, 0)
+	for _, v := range vals {
+		shape = append(shape, byte(v.ie>>8), byte(v.ie), byte(len(v.data)))
+		key = append(key, v.data...)
+	}
+
+	tmplID, err := e.template(string(shape), vals)
+	if err != nil {
+		glog.Errorf("Unable to create export template: %v", err)
+		return
+	}
+
+	slot, ok := e.slots[fl.Timestamp]
+	if !ok {
+		slot = make(map[string]*aggregate)
+		e.slots[fl.Timestamp] = slot
+	}
+
+	a, ok := slot[string(shape)+string(key)]
+	if !ok {
+		a = &aggregate{
+			template: tmplID,
+			key:      key,
+		}
+		slot[string(shape)+string(key)] = a
+	}
+
+	rate := fl.Samplerate
+	if rate == 0 {
+		rate = 1
+	}
+	a.bytes += fl.Size * rate
+	a.packets += uint64(fl.Packets) * rate
+	a.flows++
+}
+
+// template returns the ID of the template for records of `shape`. The template is created if it does not exist yet.
+func (e *Exporter) template(shape string, vals []value) (uint16, error) {
+	if id, ok := e.templates[shape]; ok {
+		return id, nil
+	}
+
+	if len(e.templates) > math.MaxUint16-ipfix.SetIDTemplateMax-1 {
+		return 0, fmt.Errorf("Out of template IDs")
+	}
+
+	t := &ipfix.ExportTemplate{
+		ID:     uint16(ipfix.SetIDTemplateMax + 1 + len(e.templates)),
+		Fields: make([]ipfix.FieldSpecifier, 0, len(vals)+len(counterFields)),
+	}
+	for _, v := range vals {
+		t.Fields = append(t.Fields, ipfix.FieldSpecifier{Type: v.ie, Length: uint16(len(v.data))})
+	}
+	t.Fields = append(t.Fields, counterFields...)
+
+	if err := e.encoder.AddTemplate(t); err != nil {
+		return 0, err
+	}
+
+	e.templates[shape] = t.ID
+	return t.ID, nil
+}
+
+// flush exports the records of all time slots that ended at least one aggregation period before `now`
+func (e *Exporter) flush(now int64) {
+	timestamps := make([]int64, 0, len(e.slots))
+	for ts := range e.slots {
+		if ts+2*e.period <= now {
+			timestamps = append(timestamps, ts)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	for _, ts := range timestamps {
+		e.export(ts, e.slots[ts])
+		delete(e.slots, ts)
+	}
+}
+
+// export sends the records of time slot `ts`
+func (e *Exporter) export(ts int64, slot map[string]*aggregate) {
+	records := make(map[uint16][][]byte)
+	for _, a := range slot {
+		rec := make([]byte, len(a.key)+32)
+		copy(rec, a.key)
+		c := rec[len(a.key):]
+		binary.BigEndian.PutUint32(c[0:4], uint32(ts))
+		binary.BigEndian.PutUint32(c[4:8], uint32(ts+e.period-1))
+		binary.BigEndian.PutUint64(c[8:16], a.bytes)
+		binary.BigEndian.PutUint64(c[16:24], a.packets)
+		binary.BigEndian.PutUint64(c[24:32], a.flows)
+		records[a.template] = append(records[a.template], rec)
+	}
+
+	ids := make([]int, 0, len(records))
+	for id := range records {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	now := time.Now().Unix()
+	for _, id := range ids {
+		msgs, err := e.encoder.Encode(now, uint16(id), records[uint16(id)])
+		if err != nil {
+			glog.Errorf("Unable to encode IPFIX records: %v", err)
+			continue
+		}
+
+		for _, msg := range msgs {
+			if _, err := e.conn.Write(msg); err != nil {
+				atomic.AddUint64(&stats.GlobalStats.ExportErrors, 1)
+				if e.debug > 0 {
+					glog.Warningf("Unable to send IPFIX message: %v", err)
+				}
+				continue
+			}
+			atomic.AddUint64(&stats.GlobalStats.ExportMessages, 1)
+		}
+		atomic.AddUint64(&stats.GlobalStats.ExportRecords, uint64(len(records[uint16(id)])))
+	}
+}
@@ -0,0 +1,143 @@
+package exporter
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig(target string, keys []string) *config.Config {
+	return &config.Config{
+		AggregationPeriod: 60,
+		Export: &config.Export{
+			Enabled:         true,
+			Target:          target,
+			DomainID:        7,
+			Keys:            keys,
+			TemplateRefresh: 600,
+			MaxMessageSize:  1400,
+			QueueSize:       16,
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer conn.Close()
+
+	e, err := New(testConfig(conn.LocalAddr().String(), []string{"Router", "SrcAddr", "Protocol"}))
+	if err != nil {
+		t.Fatalf("Unable to create exporter: %v", err)
+	}
+
+	e.Offer(&netflow.Flow{
+		Router:     []byte{192, 0, 2, 1},
+		Family:     4,
+		SrcAddr:    []byte{10, 0, 0, 1},
+		Protocol:   6,
+		Size:       1000,
+		Packets:    2,
+		Samplerate: 10,
+		Timestamp:  600,
+	})
+	e.Offer(&netflow.Flow{
+		Router:     []byte{192, 0, 2, 1},
+		Family:     4,
+		SrcAddr:    []byte{10, 0, 0, 1},
+		Protocol:   6,
+		Size:       500,
+		Packets:    1,
+		Samplerate: 10,
+		Timestamp:  600,
+	})
+	e.Offer(&netflow.Flow{
+		Router:    []byte{192, 0, 2, 1},
+		Family:    6,
+		SrcAddr:   net.ParseIP("2001:db8::1"),
+		Protocol:  17,
+		Size:      100,
+		Packets:   1,
+		Timestamp: 600,
+	})
+	e.Close()
+
+	templates := make(map[uint16]*ipfix.TemplateRecords)
+	records := make(map[uint16][]ipfix.FlowDataRecord)
+	buf := make([]byte, 1500)
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Unable to read IPFIX message: %v", err)
+		}
+
+		packet, err := ipfix.Decode(buf[:n], net.IP{127, 0, 0, 1})
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(7), packet.Header.DomainID)
+
+		for _, tmpl := range packet.Templates {
+			templates[tmpl.Header.TemplateID] = tmpl
+		}
+		for _, set := range packet.FlowSets {
+			tmpl := templates[set.Header.SetID]
+			if !assert.NotNil(t, tmpl) {
+				return
+			}
+			records[set.Header.SetID] = append(records[set.Header.SetID], tmpl.DecodeFlowSet(*set)...)
+		}
+	}
+
+	// IPv4 and IPv6 source addresses result in different templates
+	assert.Equal(t, 2, len(templates))
+	assert.Equal(t, uint16(ipfix.ExporterIPv4Addr), templates[256].Records[0].Type)
+	assert.Equal(t, uint16(ipfix.IPv4SrcAddr), templates[256].Records[1].Type)
+	assert.Equal(t, uint16(ipfix.IPv6SrcAddr), templates[257].Records[1].Type)
+
+	assert.Equal(t, 1, len(records[256]))
+	v4 := records[256][0].Values
+	assert.Equal(t, net.IP{10, 0, 0, 1}, net.IP(convert.Reverse(v4[1])))
+	assert.Equal(t, uint64(6), convert.Uint64(v4[2]))
+	assert.Equal(t, uint64(600), convert.Uint64(v4[3]))
+	assert.Equal(t, uint64(659), convert.Uint64(v4[4]))
+	assert.Equal(t, uint64(15000), convert.Uint64(v4[5]))
+	assert.Equal(t, uint64(30), convert.Uint64(v4[6]))
+	assert.Equal(t, uint64(2), convert.Uint64(v4[7]))
+
+	assert.Equal(t, 1, len(records[257]))
+	v6 := records[257][0].Values
+	assert.Equal(t, net.ParseIP("2001:db8::1"), net.IP(convert.Reverse(v6[1])))
+	assert.Equal(t, uint64(100), convert.Uint64(v6[5]))
+	assert.Equal(t, uint64(1), convert.Uint64(v6[7]))
+}
+
+func TestFlush(t *testing.T) {
+	e, err := newExporter(testConfig("127.0.0.1:4739", []string{"DstPort"}))
+	if err != nil {
+		t.Fatalf("Unable to create exporter: %v", err)
+	}
+	defer e.conn.Close()
+
+	e.add(&netflow.Flow{DstPort: 443, Timestamp: 60})
+	e.add(&netflow.Flow{DstPort: 443, Timestamp: 120})
+
+	// Time slots are kept for one more aggregation period after they ended
+	e.flush(179)
+	assert.Equal(t, 2, len(e.slots))
+	e.flush(180)
+	assert.Equal(t, 1, len(e.slots))
+	assert.NotNil(t, e.slots[120])
+}
+
+func TestUnknownKey(t *testing.T) {
+	_, err := New(testConfig("127.0.0.1:4739", []string{"SrcAddr", "Foo"}))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/bio-routing/tflow2/ipfix"
+	"github.com/bio-routing/tflow2/netflow"
+)
+
+// value is an encoded Information Element of an exported record
+type value struct {
+	ie   uint16
+	data []byte
+}
+
+// keyFunc encodes an aggregation key of flow `fl`
+type keyFunc func(fl *netflow.Flow) []value
+
+// keyFuncs maps the names of supported aggregation keys to their encoders
+var keyFuncs = map[string]keyFunc{
+	"Router": func(fl *netflow.Flow) []value {
+		return []value{addrValue(ipfix.ExporterIPv4Addr, ipfix.ExporterIPv6Addr, fl.Router, 4)}
+	},
+	"SrcAddr": func(fl *netflow.Flow) []value {
+		return []value{addrValue(ipfix.IPv4SrcAddr, ipfix.IPv6SrcAddr, fl.SrcAddr, fl.Family)}
+	},
+	"DstAddr": func(fl *netflow.Flow) []value {
+		return []value{addrValue(ipfix.IPv4DstAddr, ipfix.IPv6DstAddr, fl.DstAddr, fl.Family)}
+	},
+	"NextHop": func(fl *netflow.Flow) []value {
+		return []value{addrValue(ipfix.IPv4NextHop, ipfix.IPv6NextHop, fl.NextHop, fl.Family)}
+	},
+	"Protocol": func(fl *netflow.Flow) []value {
+		return []value{{ie: ipfix.Protocol, data: []byte{uint8(fl.Protocol)}}}
+	},
+	"IntIn": func(fl *netflow.Flow) []value {
+		return []value{uint32Value(ipfix.InputSnmp, fl.IntIn)}
+	},
+	"IntOut": func(fl *netflow.Flow) []value {
+		return []value{uint32Value(ipfix.OutputSnmp, fl.IntOut)}
+	},
+	"SrcAsn": func(fl *netflow.Flow) []value {
+		return []value{uint32Value(ipfix.SrcAs, fl.SrcAs)}
+	},
+	"DstAsn": func(fl *netflow.Flow) []value {
+		return []value{uint32Value(ipfix.DstAs, fl.DstAs)}
+	},
+	"NextHopAsn": func(fl *netflow.Flow) []value {
+		return []value{uint32Value(ipfix.BgpNextAdjacentAsNumber, fl.NextHopAs)}
+	},
+	"SrcPfx": func(fl *netflow.Flow) []value {
+		return pfxValues(ipfix.IPv4SrcPrefix, ipfix.SrcMask, ipfix.IPv6SrcPrefix, ipfix.IPv6SrcMask, fl.SrcPfx, fl.Family)
+	},
+	"DstPfx": func(fl *netflow.Flow) []value {
+		return pfxValues(ipfix.IPv4DstPrefix, ipfix.DstMask, ipfix.IPv6DstPrefix, ipfix.IPv6DstMask, fl.DstPfx, fl.Family)
+	},
+	"SrcPort": func(fl *netflow.Flow) []value {
+		return []value{uint16Value(ipfix.L4SrcPort, fl.SrcPort)}
+	},
+	"DstPort": func(fl *netflow.Flow) []value {
+		return []value{uint16Value(ipfix.L4DstPort, fl.DstPort)}
+	},
+}
+
+// getKeyFuncs returns the encoders of aggregation keys `keys`
+func getKeyFuncs(keys []string) ([]keyFunc, error) {
+	funcs := make([]keyFunc, 0, len(keys))
+	for _, k := range keys {
+		f, ok := keyFuncs[k]
+		if !ok {
+			return nil, fmt.Errorf("Unknown export key: %s", k)
+		}
+		funcs = append(funcs, f)
+	}
+	return funcs, nil
+}
+
+// addrValue encodes `addr` as IPv4 or IPv6 address. Empty addresses are encoded
+// as unspecified address of address family `family`.
+func addrValue(ie4 uint16, ie6 uint16, addr []byte, family uint32) value {
+	if len(addr) == 0 {
+		if family == 6 {
+			return value{ie: ie6, data: make([]byte, net.IPv6len)}
+		}
+		return value{ie: ie4, data: make([]byte, net.IPv4len)}
+	}
+
+	if addr4 := net.IP(addr).To4(); addr4 != nil {
+		return value{ie: ie4, data: addr4}
+	}
+	return value{ie: ie6, data: net.IP(addr).To16()}
+}
+
+// pfxValues encodes prefix `pfx` as address and prefix length
+func pfxValues(ie4 uint16, mask4 uint16, ie6 uint16, mask6 uint16, pfx *netflow.Pfx, family uint32) []value {
+	var addr []byte
+	ones := 0
+	if pfx != nil {
+		addr = pfx.IP
+		ones, _ = net.IPMask(pfx.Mask).Size()
+	}
+
+	v := addrValue(ie4, ie6, addr, family)
+	maskIE := mask4
+	if v.ie == ie6 {
+		maskIE = mask6
+	}
+	return []value{v, {ie: maskIE, data: []byte{uint8(ones)}}}
+}
+
+func uint16Value(ie uint16, v uint32) value {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, uint16(v))
+	return value{ie: ie, data: data}
+}
+
+func uint32Value(ie uint16, v uint32) value {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, v)
+	return value{ie: ie, data: data}
+}
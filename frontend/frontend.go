@@ -21,10 +21,12 @@ import (
 	"strings"
 
 	"github.com/golang/glog"
+	"github.com/bio-routing/tflow2/agents"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/database"
 	"github.com/bio-routing/tflow2/iana"
 	"github.com/bio-routing/tflow2/intfmapper"
+	"github.com/bio-routing/tflow2/rdns"
 	"github.com/bio-routing/tflow2/stats"
 )
 
@@ -35,17 +37,23 @@ type Frontend struct {
 	flowDB     *database.FlowDatabase
 	intfMapper *intfmapper.Mapper
 	iana       *iana.IANA
+	registry   *agents.Registry
 	config     *config.Config
+	rdns       *rdns.Resolver
 }
 
 // New creates a new `Frontend`
-func New(fdb *database.FlowDatabase, intfMapper *intfmapper.Mapper, iana *iana.IANA, config *config.Config) *Frontend {
+func New(fdb *database.FlowDatabase, intfMapper *intfmapper.Mapper, iana *iana.IANA, registry *agents.Registry, config *config.Config) *Frontend {
 	fe := &Frontend{
 		flowDB:     fdb,
 		intfMapper: intfMapper,
 		iana:       iana,
+		registry:   registry,
 		config:     config,
 	}
+	if config.ReverseDNS.Enabled {
+		fe.rdns = rdns.New(config.ReverseDNS)
+	}
 	fe.populateIndexHTML()
 	http.HandleFunc("/", fe.httpHandler)
 	go http.ListenAndServe(fe.config.Frontend.Listen, nil)
@@ -76,7 +84,7 @@ func (fe *Frontend) agentsHandler(w http.ResponseWriter, r *http.Request) {
 		Agents: make([]routerJSON, 0),
 	}
 
-	for _, agent := range fe.config.Agents {
+	for _, agent := range fe.registry.Agents() {
 		a := routerJSON{
 			Name:       agent.Name,
 			Interfaces: make([]string, 0),
@@ -176,6 +184,24 @@ func (fe *Frontend) queryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if fe.rdns != nil {
+		result.RenameKeys(fe.resolveAddrs)
+	}
+
 	w.Header().Set("Content-Type", "text/csv")
 	result.WriteCSV(w)
 }
+
+// resolveAddrs appends the names of the source and destination address to breakdown key `key`.
+// Addresses not resolved yet are left as they are.
+func (fe *Frontend) resolveAddrs(key database.BreakdownKey) database.BreakdownKey {
+	for _, f := range []int{database.FieldSrcAddr, database.FieldDstAddr} {
+		if key[f] == "" {
+			continue
+		}
+		if name, ok := fe.rdns.Name(key[f]); ok {
+			key[f] = fmt.Sprintf("%s (%s)", key[f], name)
+		}
+	}
+	return key
+}
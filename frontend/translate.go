@@ -41,16 +41,25 @@ func (fe *Frontend) translateCondition(field, value string) (*database.Condition
 			operand = convert.Uint8Byte(protocolsByName[value])
 		}
 
-	case database.FieldSrcPort, database.FieldDstPort, database.FieldIntIn, database.FieldIntOut:
+	case database.FieldSrcPort, database.FieldDstPort, database.FieldIntIn, database.FieldIntOut,
+		database.FieldPostNatSrcPort, database.FieldPostNatDstPort:
 		op, err := strconv.Atoi(value)
 		if err != nil {
 			return nil, err
 		}
 		operand = convert.Uint16Byte(uint16(op))
 
-	case database.FieldSrcAddr, database.FieldDstAddr, database.FieldNextHop:
+	case database.FieldSrcAddr, database.FieldDstAddr, database.FieldNextHop,
+		database.FieldPostNatSrcAddr, database.FieldPostNatDstAddr:
 		operand = convert.IPByteSlice(value)
 
+	case database.FieldNatEvent, database.FieldFirewallEvent:
+		op, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		operand = convert.Uint8Byte(uint8(op))
+
 	case database.FieldSrcAs, database.FieldDstAs, database.FieldNextHopAs:
 		op, err := strconv.Atoi(value)
 		if err != nil {
@@ -65,7 +74,11 @@ func (fe *Frontend) translateCondition(field, value string) (*database.Condition
 		}
 		operand = []byte(pfx.String())
 
-	case database.FieldIntInName, database.FieldIntOutName, database.FieldAgent:
+	case database.FieldSrcCountry, database.FieldDstCountry:
+		operand = []byte(strings.ToUpper(value))
+
+	case database.FieldIntInName, database.FieldIntOutName, database.FieldAgent,
+		database.FieldSrcCity, database.FieldDstCity, database.FieldSrcTag, database.FieldDstTag:
 		operand = []byte(value)
 
 	default:
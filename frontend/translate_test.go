@@ -53,6 +53,36 @@ func TestTranslateCondition(t *testing.T) {
 			ExpectedField:    database.FieldSrcPfx,
 			ExpectedOperator: database.OpEqual,
 		},
+		{
+			Key:              "PostNatSrcAddr",
+			Value:            "192.0.2.1",
+			ExpectedField:    database.FieldPostNatSrcAddr,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "PostNatSrcPort",
+			Value:            "40123",
+			ExpectedField:    database.FieldPostNatSrcPort,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "NatEvent",
+			Value:            "1",
+			ExpectedField:    database.FieldNatEvent,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "DstCountry",
+			Value:            "de",
+			ExpectedField:    database.FieldDstCountry,
+			ExpectedOperator: database.OpEqual,
+		},
+		{
+			Key:              "DstTag",
+			Value:            "customer-a",
+			ExpectedField:    database.FieldDstTag,
+			ExpectedOperator: database.OpEqual,
+		},
 	}
 
 	fe := Frontend{}
@@ -22,10 +22,15 @@ import (
 	"sync/atomic"
 
 	"github.com/golang/glog"
+	"github.com/bio-routing/tflow2/agents"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/listener"
 	"github.com/bio-routing/tflow2/ipfix"
 	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/ratelimit"
+	"github.com/bio-routing/tflow2/replicator"
 	"github.com/bio-routing/tflow2/srcache"
 	"github.com/bio-routing/tflow2/stats"
 )
@@ -49,6 +54,12 @@ type fieldMap struct {
 	srcPort                int
 	dstPort                int
 	samplingPacketInterval int
+	postNatSrcAddr         int
+	postNatDstAddr         int
+	postNatSrcPort         int
+	postNatDstPort         int
+	natEvent               int
+	firewallEvent          int
 }
 
 // IPFIXServer represents a Netflow Collector instance
@@ -60,65 +71,95 @@ type IPFIXServer struct {
 	// receiver is the channel used to receive flows from the annotator layer
 	Output chan *netflow.Flow
 
-	// con is the UDP socket
-	conn *net.UDPConn
+	// sockets are the UDP sockets the server receives packets on
+	sockets *listener.Group
 
 	wg sync.WaitGroup
 
 	sampleRateCache *srcache.SamplerateCache
 
+	// replicator copies received datagrams to downstream collectors
+	replicator *replicator.Replicator
+
+	// registry maps agent addresses to names
+	registry *agents.Registry
+
+	// limiter limits the rate of flows per agent
+	limiter *ratelimit.Limiter
+
+	// queue buffers flows passed to the annotator layer. Its channel is Output.
+	queue *queue.Queue
+
 	config *config.Config
 }
 
 // New creates and starts a new `IPFIXServer` instance
-func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache) *IPFIXServer {
-	ifs := &IPFIXServer{
-		tmplCache:       newTemplateCache(),
-		Output:          make(chan *netflow.Flow),
-		sampleRateCache: sampleRateCache,
-		config:          config,
-	}
-
-	addr, err := net.ResolveUDPAddr("udp", ifs.config.IPFIX.Listen)
-	if err != nil {
-		panic(fmt.Sprintf("ResolveUDPAddr: %v", err))
-	}
+func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache, replicator *replicator.Replicator, registry *agents.Registry, limiter *ratelimit.Limiter) *IPFIXServer {
+	ifs := newServer(config, sampleRateCache, registry)
+	ifs.replicator = replicator
+	ifs.limiter = limiter
 
-	con, err := net.ListenUDP("udp", addr)
+	sockets, err := listener.Listen("ipfix", ifs.config.IPFIX, numReaders)
 	if err != nil {
 		panic(fmt.Sprintf("Listen: %v", err))
 	}
+	ifs.sockets = sockets
 
 	// Create goroutines that read netflow packet and process it
-	for i := 0; i < numReaders; i++ {
-		ifs.wg.Add(numReaders)
-		go func(num int) {
-			ifs.packetWorker(num, con)
-		}(i)
+	readers := sockets.Readers()
+	ifs.wg.Add(len(readers))
+	for i, r := range readers {
+		go func(num int, r *listener.Reader) {
+			ifs.packetWorker(num, r)
+		}(i, r)
 	}
 
 	return ifs
 }
 
+// NewOffline creates a new `IPFIXServer` instance that does not listen on any socket.
+// Packets are passed to it using Ingest().
+func NewOffline(config *config.Config, sampleRateCache *srcache.SamplerateCache, registry *agents.Registry) *IPFIXServer {
+	return newServer(config, sampleRateCache, registry)
+}
+
+func newServer(config *config.Config, sampleRateCache *srcache.SamplerateCache, registry *agents.Registry) *IPFIXServer {
+	q := queue.ForStage(config, "ipfix")
+	return &IPFIXServer{
+		tmplCache:       newTemplateCache(),
+		Output:          q.C,
+		queue:           q,
+		sampleRateCache: sampleRateCache,
+		registry:        registry,
+		config:          config,
+	}
+}
+
 // Close closes the socket and stops the workers
 func (ifs *IPFIXServer) Close() {
-	ifs.conn.Close()
+	if ifs.sockets != nil {
+		ifs.sockets.Close()
+	}
 	ifs.wg.Wait()
 }
 
-// validateSource checks if src is a configured agent
+// Ingest processes packet `buffer` from `agent` that was received at `ts` out of band,
+// e.g. read from a capture file
+func (ifs *IPFIXServer) Ingest(agent net.IP, buffer []byte, ts int64) {
+	ifs.processPacket(agent, buffer, ts)
+}
+
+// validateSource checks if src is a known agent
 func (ifs *IPFIXServer) validateSource(src net.IP) bool {
-	if _, ok := ifs.config.AgentsNameByIP[src.String()]; ok {
-		return true
-	}
-	return false
+	_, ok := ifs.registry.Name(src)
+	return ok
 }
 
 // packetWorker reads netflow packet from socket and handsoff processing to processFlowSets()
-func (ifs *IPFIXServer) packetWorker(identity int, conn *net.UDPConn) {
+func (ifs *IPFIXServer) packetWorker(identity int, r *listener.Reader) {
 	buffer := make([]byte, 8960)
 	for {
-		length, remote, err := conn.ReadFromUDP(buffer)
+		length, remote, err := r.ReadFromUDP(buffer)
 		if err == io.EOF {
 			break
 		}
@@ -129,18 +170,17 @@ func (ifs *IPFIXServer) packetWorker(identity int, conn *net.UDPConn) {
 		atomic.AddUint64(&stats.GlobalStats.IPFIXpackets, 1)
 		atomic.AddUint64(&stats.GlobalStats.IPFIXbytes, uint64(length))
 
-		if !ifs.validateSource(remote.IP) {
-			glog.Errorf("Unknown source: %s", remote.IP.String())
-		}
+		ifs.replicator.Replicate("ipfix", remote, buffer[:length])
 
-		ifs.processPacket(remote.IP, buffer[:length])
+		ifs.processPacket(remote.IP, buffer[:length], 0)
 	}
 	ifs.wg.Done()
 }
 
 // processPacket takes a raw netflow packet, send it to the decoder, updates template cache
-// (if there are templates in the packet) and passes the decoded packet over to processFlowSets()
-func (ifs *IPFIXServer) processPacket(remote net.IP, buffer []byte) {
+// (if there are templates in the packet) and passes the decoded packet over to processFlowSets().
+// If `ts` is 0 the export time of the packet is used as timestamp of its flows.
+func (ifs *IPFIXServer) processPacket(remote net.IP, buffer []byte, ts int64) {
 	length := len(buffer)
 	packet, err := ipfix.Decode(buffer[:length], remote)
 	if err != nil {
@@ -148,12 +188,23 @@ func (ifs *IPFIXServer) processPacket(remote net.IP, buffer []byte) {
 		return
 	}
 
+	if ts == 0 {
+		ts = int64(packet.Header.ExportTime)
+	}
+
+	// Agents may be identified by the observation domain ID rather than by the source address
+	agent := ifs.registry.ResolveDomainID(remote, packet.Header.DomainID)
+	if !ifs.validateSource(agent) {
+		glog.Errorf("Unknown source: %s", agent.String())
+	}
+
 	ifs.updateTemplateCache(remote, packet)
-	ifs.processFlowSets(remote, packet.Header.DomainID, packet.DataFlowSets(), int64(packet.Header.ExportTime), packet)
+	ifs.processFlowSets(remote, agent, packet.Header.DomainID, packet.DataFlowSets(), ts, packet)
 }
 
-// processFlowSets iterates over flowSets and calls processFlowSet() for each flow set
-func (ifs *IPFIXServer) processFlowSets(remote net.IP, domainID uint32, flowSets []*ipfix.Set, ts int64, packet *ipfix.Packet) {
+// processFlowSets iterates over flowSets received from `remote` and calls processFlowSet() for each flow set
+// with `agent` being the address identifying the agent
+func (ifs *IPFIXServer) processFlowSets(remote net.IP, agent net.IP, domainID uint32, flowSets []*ipfix.Set, ts int64, packet *ipfix.Packet) {
 	addr := remote.String()
 	keyParts := make([]string, 3, 3)
 	for _, set := range flowSets {
@@ -172,7 +223,7 @@ func (ifs *IPFIXServer) processFlowSets(remote net.IP, domainID uint32, flowSets
 			glog.Warning("Error decoding FlowSet")
 			continue
 		}
-		ifs.processFlowSet(template, records, remote, ts, packet)
+		ifs.processFlowSet(template, records, agent, ts, packet)
 	}
 }
 
@@ -247,6 +298,30 @@ func (ifs *IPFIXServer) processFlowSet(template *ipfix.TemplateRecords, records
 			fl.NextHop = convert.Reverse(r.Values[fm.nextHop])
 		}
 
+		if fm.postNatSrcAddr >= 0 {
+			fl.PostNatSrcAddr = convert.Reverse(r.Values[fm.postNatSrcAddr])
+		}
+
+		if fm.postNatDstAddr >= 0 {
+			fl.PostNatDstAddr = convert.Reverse(r.Values[fm.postNatDstAddr])
+		}
+
+		if fm.postNatSrcPort >= 0 {
+			fl.PostNatSrcPort = convert.Uint32(r.Values[fm.postNatSrcPort])
+		}
+
+		if fm.postNatDstPort >= 0 {
+			fl.PostNatDstPort = convert.Uint32(r.Values[fm.postNatDstPort])
+		}
+
+		if fm.natEvent >= 0 {
+			fl.NatEvent = convert.Uint32(r.Values[fm.natEvent])
+		}
+
+		if fm.firewallEvent >= 0 {
+			fl.FirewallEvent = convert.Uint32(r.Values[fm.firewallEvent])
+		}
+
 		if !ifs.config.BGPAugmentation.Enabled {
 			if fm.srcAsn >= 0 {
 				fl.SrcAs = convert.Uint32(r.Values[fm.srcAsn])
@@ -263,7 +338,11 @@ func (ifs *IPFIXServer) processFlowSet(template *ipfix.TemplateRecords, records
 			Dump(&fl)
 		}
 
-		ifs.Output <- &fl
+		if !ifs.limiter.Admit(agent, &fl) {
+			continue
+		}
+
+		ifs.queue.Put(&fl)
 	}
 }
 
@@ -312,6 +391,12 @@ func generateFieldMap(template *ipfix.TemplateRecords) *fieldMap {
 		srcPort:                -1,
 		dstPort:                -1,
 		samplingPacketInterval: -1,
+		postNatSrcAddr:         -1,
+		postNatDstAddr:         -1,
+		postNatSrcPort:         -1,
+		postNatDstPort:         -1,
+		natEvent:               -1,
+		firewallEvent:          -1,
 	}
 
 	i := -1
@@ -353,6 +438,18 @@ func generateFieldMap(template *ipfix.TemplateRecords) *fieldMap {
 			fm.dstAsn = i
 		case ipfix.SamplingPacketInterval:
 			fm.samplingPacketInterval = i
+		case ipfix.PostNATSrcIPv4Addr, ipfix.PostNATSrcIPv6Addr:
+			fm.postNatSrcAddr = i
+		case ipfix.PostNATDstIPv4Addr, ipfix.PostNATDstIPv6Addr:
+			fm.postNatDstAddr = i
+		case ipfix.PostNAPTSrcPort:
+			fm.postNatSrcPort = i
+		case ipfix.PostNAPTDstPort:
+			fm.postNatDstPort = i
+		case ipfix.NATEvent:
+			fm.natEvent = i
+		case ipfix.FirewallEvent:
+			fm.firewallEvent = i
 		}
 	}
 
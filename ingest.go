@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/bio-routing/tflow2/annotation"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/database"
+	"github.com/bio-routing/tflow2/iana"
+	"github.com/bio-routing/tflow2/ifserver"
+	"github.com/bio-routing/tflow2/intfmapper"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/nfserver"
+	"github.com/bio-routing/tflow2/pcap"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/rules"
+	"github.com/bio-routing/tflow2/sfserver"
+	"github.com/bio-routing/tflow2/srcache"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// ingestFunc passes a packet to a collector
+type ingestFunc func(agent net.IP, buffer []byte, ts int64)
+
+// ingestPcap reads NetFlow v9, IPFIX and sFlow packets from capture files `files`,
+// adds the flows to the database and dumps them into the data dir
+func ingestPcap(cfg *config.Config, files []string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("No capture files given")
+	}
+
+	inftMapper, err := intfmapper.New(cfg.Agents, cfg.AggregationPeriod)
+	if err != nil {
+		glog.Warningf("Unable to initialize interface mappper. Interface names will not be available: %v", err)
+		inftMapper, _ = intfmapper.New(nil, cfg.AggregationPeriod)
+	}
+
+	// Flows must not be dropped by any queue or shed by the annotator or they would be pending
+	// forever. Reading captures has no real time constraint anyway.
+	cfg.LoadShedding.Enabled = false
+	cfg.Pipeline.Policy = queue.PolicyBlock
+	for stage, q := range cfg.Pipeline.Stages {
+		q.Policy = queue.PolicyBlock
+		cfg.Pipeline.Stages[stage] = q
+	}
+
+	srcache := srcache.New(cfg.Agents)
+	registry, err := newRegistry(cfg, inftMapper, srcache)
+	if err != nil {
+		return errors.Wrap(err, "Unable to initialize agent registry")
+	}
+
+	// Flows must not expire before they have been dumped to disk
+	flowDB := database.New(
+		cfg.AggregationPeriod,
+		math.MaxInt32,
+		*dbAddWorkers,
+		cfg.Debug,
+		*cfg.CompressionLevel,
+		cfg.DataDir,
+		cfg.Anonymize,
+		inftMapper,
+		registry,
+		iana.New(),
+		make(chan *netflow.Flow),
+	)
+	collectors := make(map[uint16]ingestFunc)
+	outputs := make([]chan *netflow.Flow, 0)
+
+	if *cfg.NetflowV9.Enabled {
+		nfs := nfserver.NewOffline(cfg, srcache, registry)
+		if err := addCollector(collectors, cfg.NetflowV9, nfs.Ingest); err != nil {
+			return err
+		}
+		outputs = append(outputs, nfs.Output)
+	}
+
+	if *cfg.IPFIX.Enabled {
+		ifs := ifserver.NewOffline(cfg, srcache, registry)
+		if err := addCollector(collectors, cfg.IPFIX, ifs.Ingest); err != nil {
+			return err
+		}
+		outputs = append(outputs, ifs.Output)
+	}
+
+	if *cfg.Sflow.Enabled {
+		sfs := sfserver.NewOffline(cfg, srcache, registry)
+		if err := addCollector(collectors, cfg.Sflow, sfs.Ingest); err != nil {
+			return err
+		}
+		outputs = append(outputs, sfs.Output)
+	}
+
+	// Flows are counted on their way from the collectors to the database
+	// so we know when all flows of the captures have been added
+	var pending, forwarders sync.WaitGroup
+	flows := make(chan *netflow.Flow)
+	for _, out := range outputs {
+		forwarders.Add(1)
+		go func(out chan *netflow.Flow) {
+			for fl := range out {
+				pending.Add(1)
+				flows <- fl
+			}
+			forwarders.Done()
+		}(out)
+	}
+
+	ruleEngine, err := rules.New(cfg.Rules, registry)
+	if err != nil {
+		return errors.Wrap(err, "Unable to initialize rules")
+	}
+
+	annotated := queue.ForStage(cfg, "database")
+	if _, err := annotation.New([]chan *netflow.Flow{flows}, annotated, *nAggr, cfg); err != nil {
+		return errors.Wrap(err, "Unable to initialize annotation layer")
+	}
+	for i := 0; i < *dbAddWorkers; i++ {
+		go func() {
+			for fl := range annotated.C {
+				if ruleEngine.Apply(fl) {
+					flowDB.Add(fl)
+				}
+				pending.Done()
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if err := ingestFile(file, collectors); err != nil {
+			return err
+		}
+	}
+
+	for _, out := range outputs {
+		close(out)
+	}
+	forwarders.Wait()
+	pending.Wait()
+
+	flowDB.DumpAll()
+	return nil
+}
+
+// addCollector registers collector `f` for the ports of all listen addresses of `srv`
+func addCollector(collectors map[uint16]ingestFunc, srv *config.Server, f ingestFunc) error {
+	for _, addr := range srv.Addresses() {
+		_, p, err := net.SplitHostPort(addr)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid listen address %s", addr)
+		}
+
+		port, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid port in listen address %s", addr)
+		}
+
+		collectors[uint16(port)] = f
+	}
+
+	return nil
+}
+
+// ingestFile passes all UDP datagrams of capture file `file` to the collector listening on their destination port
+func ingestFile(file string, collectors map[uint16]ingestFunc) error {
+	fh, err := os.Open(file)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open capture file %s", file)
+	}
+	defer fh.Close()
+
+	r, err := pcap.NewReader(fh)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read capture file %s", file)
+	}
+
+	count := 0
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read capture file %s", file)
+		}
+
+		d, err := pcap.DecodeUDP(p.LinkType, p.Data)
+		if err != nil {
+			if err != pcap.ErrNotUDP {
+				glog.Infof("Skipping packet in %s: %v", file, err)
+			}
+			continue
+		}
+
+		ingest, ok := collectors[d.DstPort]
+		if !ok {
+			continue
+		}
+
+		agent := d.SrcAddr
+		if agent4 := agent.To4(); agent4 != nil {
+			agent = agent4
+		}
+
+		ingest(agent, d.Payload, p.Timestamp.Unix())
+		count++
+	}
+
+	glog.Infof("Ingested %d packets from %s", count, file)
+	return nil
+}
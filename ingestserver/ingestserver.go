@@ -0,0 +1,155 @@
+// Package ingestserver provides a gRPC service accepting pre-decoded flows and passes them into annotator layer
+package ingestserver
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/agents"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// IngestServer represents a gRPC flow ingest service instance
+type IngestServer struct {
+	// Output is the channel used to send flows to the annotator layer
+	Output chan *netflow.Flow
+
+	// registry maps agent addresses to names
+	registry *agents.Registry
+
+	// queue buffers flows passed to the annotator layer. Its channel is Output.
+	queue *queue.Queue
+
+	config *config.Config
+	srv    *grpc.Server
+	lis    net.Listener
+}
+
+// New creates and starts a new `IngestServer` instance. It serves TLS if a certificate is configured.
+func New(config *config.Config, registry *agents.Registry) *IngestServer {
+	var opts []grpc.ServerOption
+	if config.Ingest.TLSCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(config.Ingest.TLSCert, config.Ingest.TLSKey)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to load TLS certificate: %v", err))
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	q := queue.ForStage(config, "ingest")
+	s := &IngestServer{
+		Output:   q.C,
+		queue:    q,
+		registry: registry,
+		config:   config,
+		srv:      grpc.NewServer(opts...),
+	}
+
+	lis, err := net.Listen("tcp", s.config.Ingest.Listen)
+	if err != nil {
+		panic(fmt.Sprintf("Listen: %v", err))
+	}
+	s.lis = lis
+
+	netflow.RegisterIngestServer(s.srv, s)
+	go func() {
+		if err := s.srv.Serve(lis); err != nil {
+			glog.Errorf("gRPC ingest server failed: %v", err)
+		}
+	}()
+
+	return s
+}
+
+// Close stops the gRPC server
+func (s *IngestServer) Close() {
+	s.srv.Stop()
+}
+
+// Ingest receives a stream of flows from an authenticated producer and passes them on
+func (s *IngestServer) Ingest(stream netflow.Ingest_IngestServer) error {
+	producer, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	summary := &netflow.IngestSummary{}
+	for {
+		fl, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(summary)
+		}
+		if err != nil {
+			glog.Errorf("Unable to receive flows from producer %s: %v", producer, err)
+			return err
+		}
+
+		if !s.validate(fl) {
+			summary.FlowsRejected++
+			atomic.AddUint64(&stats.GlobalStats.IngestRejected, 1)
+			continue
+		}
+
+		summary.FlowsAccepted++
+		atomic.AddUint64(&stats.GlobalStats.IngestFlows, 1)
+		s.queue.Put(fl)
+	}
+}
+
+// authenticate returns the name of the producer identified by the bearer token in the metadata of `ctx`
+func (s *IngestServer) authenticate(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "missing token")
+	}
+
+	for _, auth := range md["authorization"] {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		for _, p := range s.config.Ingest.Producers {
+			if p.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.Token)) == 1 {
+				return p.Name, nil
+			}
+		}
+	}
+
+	return "", status.Error(codes.Unauthenticated, "invalid token")
+}
+
+// validate checks `fl` is from a known agent and fills in defaults for missing fields
+func (s *IngestServer) validate(fl *netflow.Flow) bool {
+	if _, ok := s.registry.Name(net.IP(fl.Router)); !ok {
+		return false
+	}
+
+	if fl.Timestamp == 0 {
+		fl.Timestamp = time.Now().Unix()
+	}
+
+	if fl.Samplerate == 0 {
+		fl.Samplerate = 1
+	}
+
+	if fl.Family == 0 {
+		fl.Family = 4
+		if len(fl.SrcAddr) == net.IPv6len {
+			fl.Family = 6
+		}
+	}
+
+	return true
+}
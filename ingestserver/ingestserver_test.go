@@ -0,0 +1,190 @@
+package ingestserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/agents"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestIngest(t *testing.T) {
+	assert := assert.New(t)
+
+	registry, err := agents.New([]config.Agent{
+		{Name: "rtr01", IPAddress: "192.0.2.1"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unable to create registry: %v", err)
+	}
+
+	s := New(&config.Config{
+		Ingest: &config.Ingest{
+			Server: config.Server{
+				Listen: "127.0.0.1:0",
+			},
+			Producers: []config.Producer{
+				{Name: "vpc-flow-logs", Token: "secret"},
+			},
+			Insecure: true,
+		},
+	}, registry)
+	defer s.Close()
+
+	conn, err := grpc.Dial(s.lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	client := netflow.NewIngestClient(conn)
+
+	// Unauthenticated
+	stream, err := client.Ingest(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong"))
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	_, err = stream.CloseAndRecv()
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	// Authenticated
+	stream, err = client.Ingest(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret"))
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	assert.Nil(stream.Send(&netflow.Flow{
+		Router:  []byte{192, 0, 2, 1},
+		SrcAddr: []byte{10, 0, 0, 1},
+		DstAddr: []byte{10, 0, 0, 2},
+		Size:    1500,
+	}))
+	assert.Nil(stream.Send(&netflow.Flow{
+		Router: []byte{192, 0, 2, 2},
+	}))
+
+	fl := <-s.Output
+	assert.Equal(uint64(1500), fl.Size)
+	assert.Equal(uint64(1), fl.Samplerate)
+	assert.Equal(uint32(4), fl.Family)
+	assert.NotEqual(int64(0), fl.Timestamp)
+
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv failed: %v", err)
+	}
+	assert.Equal(uint64(1), summary.FlowsAccepted)
+	assert.Equal(uint64(1), summary.FlowsRejected)
+}
+
+// writeCert writes a self-signed certificate for 127.0.0.1 and its key to `dir` and returns the certificate
+func writeCert(t *testing.T, dir string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tflow2"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unable to parse certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return cert
+}
+
+func TestIngestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert := writeCert(t, dir)
+
+	registry, err := agents.New(nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to create registry: %v", err)
+	}
+
+	s := New(&config.Config{
+		Ingest: &config.Ingest{
+			Server: config.Server{
+				Listen: "127.0.0.1:0",
+			},
+			Producers: []config.Producer{
+				{Name: "vpc-flow-logs", Token: "secret"},
+			},
+			TLSCert: filepath.Join(dir, "cert.pem"),
+			TLSKey:  filepath.Join(dir, "key.pem"),
+		},
+	}, registry)
+	defer s.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	conn, err := grpc.Dial(s.lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(pool, "")))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := netflow.NewIngestClient(conn).Ingest(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret"))
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv failed: %v", err)
+	}
+	assert.Equal(t, uint64(0), summary.FlowsAccepted)
+
+	// Plaintext clients are refused
+	plain, err := grpc.Dial(s.lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer plain.Close()
+
+	stream, err = netflow.NewIngestClient(plain).Ingest(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret"))
+	if err == nil {
+		_, err = stream.CloseAndRecv()
+	}
+	assert.NotNil(t, err)
+}
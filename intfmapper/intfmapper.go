@@ -62,15 +62,27 @@ func New(agents []config.Agent, renewInterval int64) (*Mapper, error) {
 
 func (m *Mapper) startRenewWorkers() {
 	for _, agent := range m.agents {
-		go func(agent config.Agent) {
-			for {
-				time.Sleep(time.Second * time.Duration(m.renewInterval))
-				err := m.renewMapping(agent)
-				if err != nil {
-					glog.Infof("Unable to renew interface mapping for %s: %v", agent.Name, err)
-				}
-			}
-		}(agent)
+		go m.renewWorker(agent)
+	}
+}
+
+// AddAgent starts polling the interface mapping of `agent`
+func (m *Mapper) AddAgent(agent config.Agent) {
+	go func() {
+		if err := m.renewMapping(agent); err != nil {
+			glog.Infof("Unable to get interface mapping for %s: %v", agent.Name, err)
+		}
+		m.renewWorker(agent)
+	}()
+}
+
+func (m *Mapper) renewWorker(agent config.Agent) {
+	for {
+		time.Sleep(time.Second * time.Duration(m.renewInterval))
+		err := m.renewMapping(agent)
+		if err != nil {
+			glog.Infof("Unable to renew interface mapping for %s: %v", agent.Name, err)
+		}
 	}
 }
 
@@ -0,0 +1,220 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// version is the protocol version of IPFIX messages
+	version = 10
+
+	// headerLength is the length of an encoded message header
+	headerLength = 16
+
+	// setHeaderLength is the length of an encoded set header
+	setHeaderLength = 4
+
+	// templateHeaderLength is the length of an encoded template record header
+	templateHeaderLength = 4
+
+	// fieldSpecifierLength is the length of an encoded field specifier
+	fieldSpecifierLength = 4
+
+	// DefaultMaxMessageSize keeps IPFIX messages within the usual ethernet MTU
+	DefaultMaxMessageSize = 1400
+)
+
+// FieldSpecifier describes a fixed length Information Element of an export template
+type FieldSpecifier struct {
+	Type   uint16
+	Length uint16
+}
+
+// ExportTemplate is a template used to encode Data Records
+type ExportTemplate struct {
+	ID     uint16
+	Fields []FieldSpecifier
+}
+
+// RecordLength returns the length of a Data Record described by the template
+func (t *ExportTemplate) RecordLength() int {
+	l := 0
+	for _, f := range t.Fields {
+		l += int(f.Length)
+	}
+	return l
+}
+
+func (t *ExportTemplate) encodedLength() int {
+	return templateHeaderLength + len(t.Fields)*fieldSpecifierLength
+}
+
+// Encoder encodes Data Records into IPFIX messages. It keeps track of the
+// sequence number of the Observation Domain and includes the templates in
+// the first message and again every `templateRefresh` seconds as required
+// for UDP transport (RFC7011, section 10.3.6).
+type Encoder struct {
+	domainID        uint32
+	maxMessageSize  int
+	templateRefresh int64
+	templates       []*ExportTemplate
+	templatesByID   map[uint16]*ExportTemplate
+	sequence        uint32
+	lastTemplates   int64
+	templatesDue    bool
+	nextTemplate    int
+}
+
+// NewEncoder creates a new Encoder for Observation Domain `domainID`
+func NewEncoder(domainID uint32, maxMessageSize int, templateRefresh int64) *Encoder {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+	return &Encoder{
+		domainID:        domainID,
+		maxMessageSize:  maxMessageSize,
+		templateRefresh: templateRefresh,
+		templatesByID:   make(map[uint16]*ExportTemplate),
+	}
+}
+
+// AddTemplate registers template `t`. It is sent with the next message.
+func (e *Encoder) AddTemplate(t *ExportTemplate) error {
+	if t.ID <= SetIDTemplateMax {
+		return fmt.Errorf("Template ID %d is reserved", t.ID)
+	}
+	if _, ok := e.templatesByID[t.ID]; ok {
+		return fmt.Errorf("Template %d already exists", t.ID)
+	}
+	if len(t.Fields) == 0 {
+		return fmt.Errorf("Template %d has no fields", t.ID)
+	}
+	for _, f := range t.Fields {
+		if f.Length == 0 || f.Length == 0xffff {
+			return fmt.Errorf("Template %d: field %d must have a fixed length", t.ID, f.Type)
+		}
+	}
+	if headerLength+2*setHeaderLength+t.encodedLength()+t.RecordLength() > e.maxMessageSize {
+		return fmt.Errorf("Template %d exceeds maximum message size", t.ID)
+	}
+
+	e.templates = append(e.templates, t)
+	e.templatesByID[t.ID] = t
+	e.templatesDue = true
+	return nil
+}
+
+// Template returns the template with ID `id` or nil if it does not exist
+func (e *Encoder) Template(id uint16) *ExportTemplate {
+	return e.templatesByID[id]
+}
+
+// Encode encodes `records` of template `templateID` into as many messages as needed
+// to stay within the maximum message size. Each record has to be the concatenation of
+// its field values in network byte order.
+func (e *Encoder) Encode(exportTime int64, templateID uint16, records [][]byte) ([][]byte, error) {
+	t, ok := e.templatesByID[templateID]
+	if !ok {
+		return nil, fmt.Errorf("Unknown template %d", templateID)
+	}
+
+	recLen := t.RecordLength()
+	for _, rec := range records {
+		if len(rec) != recLen {
+			return nil, fmt.Errorf("Record length %d does not match template %d (%d)", len(rec), templateID, recLen)
+		}
+	}
+
+	msgs := make([][]byte, 0)
+	for len(records) > 0 || e.templatesPending(exportTime) {
+		msg := e.newMessage(exportTime)
+
+		if len(records) > 0 {
+			n := (e.maxMessageSize - len(msg) - setHeaderLength) / recLen
+			if n > len(records) {
+				n = len(records)
+			}
+			if n > 0 {
+				msg = appendSet(msg, templateID, records[:n])
+				e.sequence += uint32(n)
+				records = records[n:]
+			}
+		}
+
+		binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)))
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+// templatesPending checks if templates have to be (re)sent
+func (e *Encoder) templatesPending(now int64) bool {
+	if len(e.templates) == 0 {
+		return false
+	}
+	return e.templatesDue || (e.templateRefresh > 0 && now-e.lastTemplates >= e.templateRefresh)
+}
+
+// newMessage creates a message header followed by the template set if it is due
+func (e *Encoder) newMessage(exportTime int64) []byte {
+	msg := make([]byte, headerLength, e.maxMessageSize)
+	binary.BigEndian.PutUint16(msg[0:2], version)
+	binary.BigEndian.PutUint32(msg[4:8], uint32(exportTime))
+	binary.BigEndian.PutUint32(msg[8:12], e.sequence)
+	binary.BigEndian.PutUint32(msg[12:16], e.domainID)
+
+	if !e.templatesPending(exportTime) {
+		return msg
+	}
+
+	// Send as many templates as fit. The remaining ones are sent with the next message.
+	start := len(msg)
+	msg = append(msg, 0, 0, 0, 0)
+	for e.nextTemplate < len(e.templates) {
+		t := e.templates[e.nextTemplate]
+		if len(msg)+t.encodedLength()+setHeaderLength+t.RecordLength() > e.maxMessageSize && len(msg) > start+setHeaderLength {
+			break
+		}
+		msg = appendTemplate(msg, t)
+		e.nextTemplate++
+	}
+	binary.BigEndian.PutUint16(msg[start:start+2], TemplateSetID)
+	binary.BigEndian.PutUint16(msg[start+2:start+4], uint16(len(msg)-start))
+
+	if e.nextTemplate == len(e.templates) {
+		e.nextTemplate = 0
+		e.templatesDue = false
+		e.lastTemplates = exportTime
+	}
+
+	return msg
+}
+
+// appendTemplate appends the template record of `t` to `buf`
+func appendTemplate(buf []byte, t *ExportTemplate) []byte {
+	buf = appendUint16(buf, t.ID)
+	buf = appendUint16(buf, uint16(len(t.Fields)))
+	for _, f := range t.Fields {
+		buf = appendUint16(buf, f.Type)
+		buf = appendUint16(buf, f.Length)
+	}
+	return buf
+}
+
+// appendSet appends a data set of `records` to `buf`
+func appendSet(buf []byte, setID uint16, records [][]byte) []byte {
+	start := len(buf)
+	buf = appendUint16(buf, setID)
+	buf = appendUint16(buf, 0)
+	for _, rec := range records {
+		buf = append(buf, rec...)
+	}
+	binary.BigEndian.PutUint16(buf[start+2:start+4], uint16(len(buf)-start))
+	return buf
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
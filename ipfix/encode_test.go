@@ -0,0 +1,132 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/convert"
+	"github.com/stretchr/testify/assert"
+)
+
+var testTemplate = &ExportTemplate{
+	ID: 256,
+	Fields: []FieldSpecifier{
+		{Type: IPv4SrcAddr, Length: 4},
+		{Type: Protocol, Length: 1},
+		{Type: InBytes, Length: 8},
+	},
+}
+
+func testRecord(src string, proto uint8, bytes uint64) []byte {
+	rec := make([]byte, 0, 13)
+	rec = append(rec, net.ParseIP(src).To4()...)
+	rec = append(rec, proto)
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, bytes)
+	return append(rec, b...)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	enc := NewEncoder(42, 0, 600)
+	assert.Nil(t, enc.AddTemplate(testTemplate))
+
+	msgs, err := enc.Encode(1000, 256, [][]byte{
+		testRecord("10.0.0.1", 6, 1500),
+		testRecord("10.0.0.2", 17, 300),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(msgs))
+
+	packet, err := Decode(msgs[0], net.ParseIP("192.0.2.1"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(42), packet.Header.DomainID)
+	assert.Equal(t, uint32(1000), packet.Header.ExportTime)
+	assert.Equal(t, uint32(0), packet.Header.SequenceNumber)
+	assert.Equal(t, uint16(len(msgs[0])), packet.Header.Length)
+
+	assert.Equal(t, 1, len(packet.Templates))
+	tmpl := packet.Templates[0]
+	assert.Equal(t, uint16(256), tmpl.Header.TemplateID)
+	assert.Equal(t, uint16(3), tmpl.Header.FieldCount)
+	for i, f := range testTemplate.Fields {
+		assert.Equal(t, f.Type, tmpl.Records[i].Type)
+		assert.Equal(t, f.Length, tmpl.Records[i].Length)
+	}
+
+	assert.Equal(t, 1, len(packet.FlowSets))
+	records := tmpl.DecodeFlowSet(*packet.FlowSets[0])
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, net.IP{10, 0, 0, 1}, net.IP(convert.Reverse(records[0].Values[0])))
+	assert.Equal(t, uint64(6), convert.Uint64(records[0].Values[1]))
+	assert.Equal(t, uint64(1500), convert.Uint64(records[0].Values[2]))
+	assert.Equal(t, uint64(17), convert.Uint64(records[1].Values[1]))
+	assert.Equal(t, uint64(300), convert.Uint64(records[1].Values[2]))
+
+	// Templates are only sent again after the refresh interval
+	msgs, err = enc.Encode(1010, 256, [][]byte{testRecord("10.0.0.3", 1, 84)})
+	assert.Nil(t, err)
+	packet, err = Decode(msgs[0], net.ParseIP("192.0.2.1"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), packet.Header.SequenceNumber)
+	assert.Equal(t, 0, len(packet.Templates))
+	assert.Equal(t, 1, len(packet.FlowSets))
+
+	msgs, err = enc.Encode(1600, 256, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(msgs))
+	packet, err = Decode(msgs[0], net.ParseIP("192.0.2.1"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), packet.Header.SequenceNumber)
+	assert.Equal(t, 1, len(packet.Templates))
+	assert.Equal(t, 0, len(packet.FlowSets))
+}
+
+func TestEncodeSplit(t *testing.T) {
+	enc := NewEncoder(1, 100, 0)
+	assert.Nil(t, enc.AddTemplate(testTemplate))
+
+	records := make([][]byte, 10)
+	for i := range records {
+		records[i] = testRecord("10.0.0.1", 6, uint64(i))
+	}
+
+	msgs, err := enc.Encode(1000, 256, records)
+	assert.Nil(t, err)
+
+	total := 0
+	for _, msg := range msgs {
+		assert.True(t, len(msg) <= 100)
+		packet, err := Decode(msg, net.ParseIP("192.0.2.1"))
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(total), packet.Header.SequenceNumber)
+		for _, set := range packet.FlowSets {
+			total += len(testTemplateRecords(t, enc).DecodeFlowSet(*set))
+		}
+	}
+	assert.Equal(t, 10, total)
+}
+
+func TestEncodeErrors(t *testing.T) {
+	enc := NewEncoder(1, 0, 0)
+	assert.NotNil(t, enc.AddTemplate(&ExportTemplate{ID: 2, Fields: testTemplate.Fields}))
+	assert.NotNil(t, enc.AddTemplate(&ExportTemplate{ID: 300}))
+	assert.Nil(t, enc.AddTemplate(testTemplate))
+	assert.NotNil(t, enc.AddTemplate(testTemplate))
+
+	_, err := enc.Encode(0, 257, nil)
+	assert.NotNil(t, err)
+	_, err = enc.Encode(0, 256, [][]byte{{1, 2, 3}})
+	assert.NotNil(t, err)
+}
+
+// testTemplateRecords decodes the template of the first message `enc` sends
+func testTemplateRecords(t *testing.T, enc *Encoder) *TemplateRecords {
+	e := NewEncoder(1, 0, 0)
+	assert.Nil(t, e.AddTemplate(enc.Template(256)))
+	msgs, err := e.Encode(0, 256, nil)
+	assert.Nil(t, err)
+	packet, err := Decode(msgs[0], net.ParseIP("192.0.2.1"))
+	assert.Nil(t, err)
+	return packet.Templates[0]
+}
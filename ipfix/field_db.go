@@ -108,5 +108,21 @@ const (
 	ApplicationDescription    = 94
 	ApplicationTag            = 95
 	ApplicationName           = 96
+	BgpNextAdjacentAsNumber   = 128
+	ExporterIPv4Addr          = 130
+	ExporterIPv6Addr          = 131
+	FlowID                    = 148
+	FlowStartSeconds          = 150
+	FlowEndSeconds            = 151
+	IPv6DstPrefix             = 169
+	IPv6SrcPrefix             = 170
+	PostNATSrcIPv4Addr        = 225
+	PostNATDstIPv4Addr        = 226
+	PostNAPTSrcPort           = 227
+	PostNAPTDstPort           = 228
+	NATEvent                  = 230
+	FirewallEvent             = 233
+	PostNATSrcIPv6Addr        = 281
+	PostNATDstIPv6Addr        = 282
 	SamplingPacketInterval    = 305
 )
@@ -0,0 +1,120 @@
+// Package listener provides the UDP sockets flow collectors receive packets on
+package listener
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/pkg/errors"
+)
+
+// Socket is a UDP socket a collector receives packets on
+type Socket struct {
+	conn   *net.UDPConn
+	stats  *stats.SocketStats
+	closed uint32
+}
+
+// Reader reads packets from a Socket. A Reader must not be shared between goroutines.
+type Reader struct {
+	sock *Socket
+	oob  []byte
+}
+
+// Group is the set of sockets and readers of a collector
+type Group struct {
+	sockets []*Socket
+	readers []*Reader
+}
+
+// Listen opens the sockets for `collector` as configured in `srv`. With SO_REUSEPORT
+// enabled it opens `numReaders` sockets per listen address, each served by one reader.
+// Otherwise it opens one socket per listen address served by `numReaders` readers.
+func Listen(collector string, srv *config.Server, numReaders int) (*Group, error) {
+	g := &Group{}
+	for _, addr := range srv.Addresses() {
+		numSockets := 1
+		readersPerSocket := numReaders
+		if srv.ReusePort {
+			numSockets = numReaders
+			readersPerSocket = 1
+		}
+
+		for i := 0; i < numSockets; i++ {
+			sock, err := listen(collector, addr, i, srv)
+			if err != nil {
+				g.Close()
+				return nil, err
+			}
+			g.sockets = append(g.sockets, sock)
+
+			for j := 0; j < readersPerSocket; j++ {
+				g.readers = append(g.readers, &Reader{
+					sock: sock,
+					oob:  make([]byte, oobSize),
+				})
+			}
+		}
+	}
+
+	return g, nil
+}
+
+func listen(collector string, addr string, id int, srv *config.Server) (*Socket, error) {
+	lc := net.ListenConfig{
+		Control: control(srv.ReusePort),
+	}
+
+	pc, err := lc.ListenPacket(context.Background(), "udp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to listen on %s", addr)
+	}
+	conn := pc.(*net.UDPConn)
+
+	if srv.ReceiveBuffer > 0 {
+		if err := conn.SetReadBuffer(srv.ReceiveBuffer); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "Unable to set receive buffer size on %s", addr)
+		}
+	}
+
+	return &Socket{
+		conn:  conn,
+		stats: stats.NewSocketStats(collector, addr, id),
+	}, nil
+}
+
+// Readers returns the readers of the group. Each reader is to be used by one goroutine.
+func (g *Group) Readers() []*Reader {
+	return g.readers
+}
+
+// Close closes all sockets of the group
+func (g *Group) Close() {
+	for _, s := range g.sockets {
+		atomic.StoreUint32(&s.closed, 1)
+		s.conn.Close()
+	}
+}
+
+// ReadFromUDP reads a packet into `buffer` and updates the drop counter of the socket.
+// It returns io.EOF once the socket has been closed.
+func (r *Reader) ReadFromUDP(buffer []byte) (int, *net.UDPAddr, error) {
+	n, oobn, _, remote, err := r.sock.conn.ReadMsgUDP(buffer, r.oob)
+	if err != nil {
+		if atomic.LoadUint32(&r.sock.closed) == 1 {
+			return 0, nil, io.EOF
+		}
+		return n, remote, err
+	}
+
+	if drops, ok := parseDrops(r.oob[:oobn]); ok {
+		atomic.StoreUint64(&r.sock.stats.Drops, uint64(drops))
+	}
+
+	return n, remote, nil
+}
@@ -0,0 +1,60 @@
+//go:build linux
+// +build linux
+
+package listener
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// oobSize is the size of the control message buffer needed to receive SO_RXQ_OVFL counters
+var oobSize = unix.CmsgSpace(4)
+
+// control sets SO_REUSEPORT (if enabled) and SO_RXQ_OVFL on a socket before it is bound
+func control(reusePort bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if reusePort {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+				if sockErr != nil {
+					return
+				}
+			}
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RXQ_OVFL, 1)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// parseDrops extracts the SO_RXQ_OVFL drop counter from control message `oob`
+func parseDrops(oob []byte) (uint32, bool) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, false
+	}
+
+	for _, m := range msgs {
+		if m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SO_RXQ_OVFL && len(m.Data) >= 4 {
+			return nativeEndian.Uint32(m.Data), true
+		}
+	}
+
+	return 0, false
+}
+
+// nativeEndian is the byte order of the host. Control messages are in host byte order.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
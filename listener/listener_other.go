@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package listener
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// oobSize is zero as kernel drop counters are only supported on Linux
+var oobSize = 0
+
+// control refuses SO_REUSEPORT as socket sharding is only supported on Linux
+func control(reusePort bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if reusePort {
+			return fmt.Errorf("reuse_port is only supported on Linux")
+		}
+		return nil
+	}
+}
+
+// parseDrops always fails as kernel drop counters are only supported on Linux
+func parseDrops(oob []byte) (uint32, bool) {
+	return 0, false
+}
@@ -0,0 +1,75 @@
+package listener
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListen(t *testing.T) {
+	assert := assert.New(t)
+
+	g, err := Listen("test", &config.Server{
+		ListenAddresses: []string{"127.0.0.1:0", "127.0.0.1:0"},
+		ReceiveBuffer:   1 << 20,
+	}, 3)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	assert.Equal(2, len(g.sockets))
+	assert.Equal(6, len(g.Readers()))
+	assert.Equal(g.sockets[0], g.Readers()[2].sock)
+	assert.Equal(g.sockets[1], g.Readers()[3].sock)
+
+	conn, err := net.DialUDP("udp", nil, g.sockets[1].conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("foo"))
+	buffer := make([]byte, 100)
+	n, remote, err := g.Readers()[3].ReadFromUDP(buffer)
+	assert.Nil(err)
+	assert.Equal("foo", string(buffer[:n]))
+	assert.Equal(conn.LocalAddr().String(), remote.String())
+
+	g.Close()
+	_, _, err = g.Readers()[0].ReadFromUDP(buffer)
+	assert.Equal(io.EOF, err)
+}
+
+func TestListenReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT is only supported on Linux")
+	}
+
+	g, err := Listen("test", &config.Server{
+		Listen: "127.0.0.1:0",
+	}, 1)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	addr := g.sockets[0].conn.LocalAddr().String()
+	g.Close()
+
+	g, err = Listen("test", &config.Server{
+		Listen:    addr,
+		ReusePort: true,
+	}, 4)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer g.Close()
+
+	assert.Equal(t, 4, len(g.sockets))
+	assert.Equal(t, 4, len(g.Readers()))
+	for _, s := range g.sockets {
+		assert.Equal(t, addr, s.conn.LocalAddr().String())
+	}
+}
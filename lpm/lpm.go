@@ -0,0 +1,145 @@
+// Package lpm provides a longest prefix match table for IPv4 and IPv6 prefixes
+package lpm
+
+import (
+	"net"
+)
+
+// Table maps IP prefixes to values. It is not safe for concurrent modification.
+type Table struct {
+	v4  *node
+	v6  *node
+	len int
+}
+
+// node is a node of a binary trie
+type node struct {
+	children [2]*node
+	pfx      *net.IPNet
+	value    interface{}
+}
+
+// New creates an empty table
+func New() *Table {
+	return &Table{
+		v4: &node{},
+		v6: &node{},
+	}
+}
+
+// root returns the root node and the normalized form of `ip`
+func (t *Table) root(ip net.IP) (*node, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return t.v4, ip4
+	}
+	return t.v6, ip.To16()
+}
+
+// Insert sets the value of prefix `pfx` to `value`
+func (t *Table) Insert(pfx *net.IPNet, value interface{}) {
+	n, ip := t.root(pfx.IP)
+	if ip == nil {
+		return
+	}
+
+	ones, bits := pfx.Mask.Size()
+	if len(ip) == net.IPv4len && bits == 8*net.IPv6len {
+		ones -= 8 * (net.IPv6len - net.IPv4len)
+	}
+	if ones < 0 {
+		return
+	}
+
+	for i := 0; i < ones; i++ {
+		b := bit(ip, i)
+		if n.children[b] == nil {
+			n.children[b] = &node{}
+		}
+		n = n.children[b]
+	}
+
+	if n.pfx == nil {
+		t.len++
+	}
+	n.pfx = &net.IPNet{
+		IP:   ip.Mask(net.CIDRMask(ones, len(ip)*8)),
+		Mask: net.CIDRMask(ones, len(ip)*8),
+	}
+	n.value = value
+}
+
+// Delete removes prefix `pfx`. It returns false if the prefix is not in the table.
+func (t *Table) Delete(pfx *net.IPNet) bool {
+	n, ip := t.root(pfx.IP)
+	if ip == nil {
+		return false
+	}
+
+	ones, bits := pfx.Mask.Size()
+	if len(ip) == net.IPv4len && bits == 8*net.IPv6len {
+		ones -= 8 * (net.IPv6len - net.IPv4len)
+	}
+	if ones < 0 {
+		return false
+	}
+
+	path := make([]*node, 0, ones+1)
+	for i := 0; i < ones; i++ {
+		path = append(path, n)
+		n = n.children[bit(ip, i)]
+		if n == nil {
+			return false
+		}
+	}
+	if n.pfx == nil {
+		return false
+	}
+
+	n.pfx = nil
+	n.value = nil
+	t.len--
+
+	// Remove nodes that lead to no prefix anymore
+	for i := ones - 1; i >= 0; i-- {
+		if n.pfx != nil || n.children[0] != nil || n.children[1] != nil {
+			break
+		}
+		path[i].children[bit(ip, i)] = nil
+		n = path[i]
+	}
+	return true
+}
+
+// Lookup returns the longest prefix containing `ip` and its value
+func (t *Table) Lookup(ip net.IP) (*net.IPNet, interface{}, bool) {
+	n, ip := t.root(ip)
+	if ip == nil {
+		return nil, nil, false
+	}
+
+	var match *node
+	for i := 0; n != nil; i++ {
+		if n.pfx != nil {
+			match = n
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		n = n.children[bit(ip, i)]
+	}
+
+	if match == nil {
+		return nil, nil, false
+	}
+	return match.pfx, match.value, true
+}
+
+// Len returns the number of prefixes in the table
+func (t *Table) Len() int {
+	return t.len
+}
+
+// bit returns bit `i` of `ip` counting from the most significant bit
+func bit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,79 @@
+package lpm
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestLookup(t *testing.T) {
+	tbl := New()
+	for _, p := range []string{"0.0.0.0/0", "192.0.2.0/24", "192.0.2.128/25", "192.0.2.1/32", "2001:db8::/32", "2001:db8:1::/48"} {
+		tbl.Insert(mustParseCIDR(p), p)
+	}
+	tbl.Insert(mustParseCIDR("192.0.2.0/24"), "192.0.2.0/24")
+	assert.Equal(t, 6, tbl.Len())
+
+	tests := []struct {
+		ip       string
+		expected string
+		ok       bool
+	}{
+		{ip: "192.0.2.1", expected: "192.0.2.1/32", ok: true},
+		{ip: "192.0.2.2", expected: "192.0.2.0/24", ok: true},
+		{ip: "192.0.2.200", expected: "192.0.2.128/25", ok: true},
+		{ip: "198.51.100.1", expected: "0.0.0.0/0", ok: true},
+		{ip: "2001:db8:1::1", expected: "2001:db8:1::/48", ok: true},
+		{ip: "2001:db8:2::1", expected: "2001:db8::/32", ok: true},
+		{ip: "2001:db9::1", ok: false},
+	}
+
+	for _, test := range tests {
+		pfx, value, ok := tbl.Lookup(net.ParseIP(test.ip))
+		assert.Equalf(t, test.ok, ok, "%s", test.ip)
+		if !test.ok {
+			continue
+		}
+		assert.Equalf(t, test.expected, pfx.String(), "%s", test.ip)
+		assert.Equalf(t, test.expected, value, "%s", test.ip)
+	}
+
+	// 4 byte representations of IPv4 addresses
+	pfx, _, ok := tbl.Lookup(net.IP{192, 0, 2, 1})
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.1/32", pfx.String())
+}
+
+func TestDelete(t *testing.T) {
+	tbl := New()
+	for _, p := range []string{"192.0.2.0/24", "192.0.2.128/25", "2001:db8::/32"} {
+		tbl.Insert(mustParseCIDR(p), p)
+	}
+
+	assert.False(t, tbl.Delete(mustParseCIDR("192.0.2.0/23")))
+	assert.True(t, tbl.Delete(mustParseCIDR("192.0.2.128/25")))
+	assert.False(t, tbl.Delete(mustParseCIDR("192.0.2.128/25")))
+	assert.Equal(t, 2, tbl.Len())
+
+	pfx, _, ok := tbl.Lookup(net.ParseIP("192.0.2.200"))
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.0/24", pfx.String())
+
+	assert.True(t, tbl.Delete(mustParseCIDR("192.0.2.0/24")))
+	_, _, ok = tbl.Lookup(net.ParseIP("192.0.2.200"))
+	assert.False(t, ok)
+	assert.Nil(t, tbl.v4.children[0])
+	assert.Nil(t, tbl.v4.children[1])
+
+	_, _, ok = tbl.Lookup(net.ParseIP("2001:db8::1"))
+	assert.True(t, ok)
+}
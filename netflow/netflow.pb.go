@@ -13,6 +13,8 @@ It has these top-level messages:
 	Flow
 	Intf
 	Flows
+	IngestSummary
+	FlowBatch
 */
 package netflow
 
@@ -103,6 +105,46 @@ type Flow struct {
 	DstPort uint32 `protobuf:"varint,18,opt,name=dst_port,json=dstPort" json:"dst_port,omitempty"`
 	// Samplerate
 	Samplerate uint64 `protobuf:"varint,19,opt,name=samplerate" json:"samplerate,omitempty"`
+	// SRC IP address after NAT
+	PostNatSrcAddr []byte `protobuf:"bytes,20,opt,name=post_nat_src_addr,json=postNatSrcAddr,proto3" json:"post_nat_src_addr,omitempty"`
+	// DST IP address after NAT
+	PostNatDstAddr []byte `protobuf:"bytes,21,opt,name=post_nat_dst_addr,json=postNatDstAddr,proto3" json:"post_nat_dst_addr,omitempty"`
+	// SRC port after NAPT
+	PostNatSrcPort uint32 `protobuf:"varint,22,opt,name=post_nat_src_port,json=postNatSrcPort" json:"post_nat_src_port,omitempty"`
+	// DST port after NAPT
+	PostNatDstPort uint32 `protobuf:"varint,23,opt,name=post_nat_dst_port,json=postNatDstPort" json:"post_nat_dst_port,omitempty"`
+	// NAT event (e.g. create, delete) as defined by IANA IE 230
+	NatEvent uint32 `protobuf:"varint,24,opt,name=nat_event,json=natEvent" json:"nat_event,omitempty"`
+	// Firewall event (e.g. flow created, denied) as defined by IANA IE 233
+	FirewallEvent uint32 `protobuf:"varint,25,opt,name=firewall_event,json=firewallEvent" json:"firewall_event,omitempty"`
+	// Customer owning the SRC prefix
+	SrcCustomer string `protobuf:"bytes,27,opt,name=src_customer,json=srcCustomer" json:"src_customer,omitempty"`
+	// Customer owning the DST prefix
+	DstCustomer string `protobuf:"bytes,28,opt,name=dst_customer,json=dstCustomer" json:"dst_customer,omitempty"`
+	// Site of the SRC prefix
+	SrcSite string `protobuf:"bytes,29,opt,name=src_site,json=srcSite" json:"src_site,omitempty"`
+	// Site of the DST prefix
+	DstSite string `protobuf:"bytes,30,opt,name=dst_site,json=dstSite" json:"dst_site,omitempty"`
+	// AS path of the SRC prefix
+	SrcAsPath []uint32 `protobuf:"varint,31,rep,packed,name=src_as_path,json=srcAsPath" json:"src_as_path,omitempty"`
+	// AS path of the DST prefix
+	DstAsPath []uint32 `protobuf:"varint,32,rep,packed,name=dst_as_path,json=dstAsPath" json:"dst_as_path,omitempty"`
+	// BGP communities of the SRC prefix
+	SrcCommunities []string `protobuf:"bytes,33,rep,name=src_communities,json=srcCommunities" json:"src_communities,omitempty"`
+	// BGP communities of the DST prefix
+	DstCommunities []string `protobuf:"bytes,34,rep,name=dst_communities,json=dstCommunities" json:"dst_communities,omitempty"`
+	// ISO 3166-1 country code of the SRC IP address
+	SrcCountry string `protobuf:"bytes,35,opt,name=src_country,json=srcCountry" json:"src_country,omitempty"`
+	// ISO 3166-1 country code of the DST IP address
+	DstCountry string `protobuf:"bytes,36,opt,name=dst_country,json=dstCountry" json:"dst_country,omitempty"`
+	// City of the SRC IP address
+	SrcCity string `protobuf:"bytes,37,opt,name=src_city,json=srcCity" json:"src_city,omitempty"`
+	// City of the DST IP address
+	DstCity string `protobuf:"bytes,38,opt,name=dst_city,json=dstCity" json:"dst_city,omitempty"`
+	// Tag group of the SRC of the flow
+	SrcTag string `protobuf:"bytes,39,opt,name=src_tag,json=srcTag" json:"src_tag,omitempty"`
+	// Tag group of the DST of the flow
+	DstTag string `protobuf:"bytes,40,opt,name=dst_tag,json=dstTag" json:"dst_tag,omitempty"`
 }
 
 func (m *Flow) Reset()                    { *m = Flow{} }
@@ -243,6 +285,146 @@ func (m *Flow) GetSamplerate() uint64 {
 	return 0
 }
 
+func (m *Flow) GetPostNatSrcAddr() []byte {
+	if m != nil {
+		return m.PostNatSrcAddr
+	}
+	return nil
+}
+
+func (m *Flow) GetPostNatDstAddr() []byte {
+	if m != nil {
+		return m.PostNatDstAddr
+	}
+	return nil
+}
+
+func (m *Flow) GetPostNatSrcPort() uint32 {
+	if m != nil {
+		return m.PostNatSrcPort
+	}
+	return 0
+}
+
+func (m *Flow) GetPostNatDstPort() uint32 {
+	if m != nil {
+		return m.PostNatDstPort
+	}
+	return 0
+}
+
+func (m *Flow) GetNatEvent() uint32 {
+	if m != nil {
+		return m.NatEvent
+	}
+	return 0
+}
+
+func (m *Flow) GetFirewallEvent() uint32 {
+	if m != nil {
+		return m.FirewallEvent
+	}
+	return 0
+}
+
+func (m *Flow) GetSrcCustomer() string {
+	if m != nil {
+		return m.SrcCustomer
+	}
+	return ""
+}
+
+func (m *Flow) GetDstCustomer() string {
+	if m != nil {
+		return m.DstCustomer
+	}
+	return ""
+}
+
+func (m *Flow) GetSrcSite() string {
+	if m != nil {
+		return m.SrcSite
+	}
+	return ""
+}
+
+func (m *Flow) GetDstSite() string {
+	if m != nil {
+		return m.DstSite
+	}
+	return ""
+}
+
+func (m *Flow) GetSrcAsPath() []uint32 {
+	if m != nil {
+		return m.SrcAsPath
+	}
+	return nil
+}
+
+func (m *Flow) GetDstAsPath() []uint32 {
+	if m != nil {
+		return m.DstAsPath
+	}
+	return nil
+}
+
+func (m *Flow) GetSrcCommunities() []string {
+	if m != nil {
+		return m.SrcCommunities
+	}
+	return nil
+}
+
+func (m *Flow) GetDstCommunities() []string {
+	if m != nil {
+		return m.DstCommunities
+	}
+	return nil
+}
+
+func (m *Flow) GetSrcCountry() string {
+	if m != nil {
+		return m.SrcCountry
+	}
+	return ""
+}
+
+func (m *Flow) GetDstCountry() string {
+	if m != nil {
+		return m.DstCountry
+	}
+	return ""
+}
+
+func (m *Flow) GetSrcCity() string {
+	if m != nil {
+		return m.SrcCity
+	}
+	return ""
+}
+
+func (m *Flow) GetDstCity() string {
+	if m != nil {
+		return m.DstCity
+	}
+	return ""
+}
+
+func (m *Flow) GetSrcTag() string {
+	if m != nil {
+		return m.SrcTag
+	}
+	return ""
+}
+
+func (m *Flow) GetDstTag() string {
+	if m != nil {
+		return m.DstTag
+	}
+	return ""
+}
+
 // Intf groups an interfaces ID and name
 type Intf struct {
 	// ID is an interface ID
@@ -297,11 +479,67 @@ func (m *Flows) GetInterfaceMapping() []*Intf {
 	return nil
 }
 
+// IngestSummary is returned to a producer once its stream of flows ended
+type IngestSummary struct {
+	// Number of flows accepted
+	FlowsAccepted uint64 `protobuf:"varint,1,opt,name=flows_accepted,json=flowsAccepted" json:"flows_accepted,omitempty"`
+	// Number of flows rejected, e.g. from unknown routers
+	FlowsRejected uint64 `protobuf:"varint,2,opt,name=flows_rejected,json=flowsRejected" json:"flows_rejected,omitempty"`
+}
+
+func (m *IngestSummary) Reset()                    { *m = IngestSummary{} }
+func (m *IngestSummary) String() string            { return proto.CompactTextString(m) }
+func (*IngestSummary) ProtoMessage()               {}
+func (*IngestSummary) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *IngestSummary) GetFlowsAccepted() uint64 {
+	if m != nil {
+		return m.FlowsAccepted
+	}
+	return 0
+}
+
+func (m *IngestSummary) GetFlowsRejected() uint64 {
+	if m != nil {
+		return m.FlowsRejected
+	}
+	return 0
+}
+
+// FlowBatch is a batch of flows exchanged with annotators
+type FlowBatch struct {
+	// ID identifies a batch and its reply
+	Id uint64 `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	// Flows of the batch
+	Flows []*Flow `protobuf:"bytes,2,rep,name=flows" json:"flows,omitempty"`
+}
+
+func (m *FlowBatch) Reset()                    { *m = FlowBatch{} }
+func (m *FlowBatch) String() string            { return proto.CompactTextString(m) }
+func (*FlowBatch) ProtoMessage()               {}
+func (*FlowBatch) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *FlowBatch) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *FlowBatch) GetFlows() []*Flow {
+	if m != nil {
+		return m.Flows
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Pfx)(nil), "netflow.pfx")
 	proto.RegisterType((*Flow)(nil), "netflow.Flow")
 	proto.RegisterType((*Intf)(nil), "netflow.Intf")
 	proto.RegisterType((*Flows)(nil), "netflow.Flows")
+	proto.RegisterType((*IngestSummary)(nil), "netflow.IngestSummary")
+	proto.RegisterType((*FlowBatch)(nil), "netflow.FlowBatch")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -316,6 +554,7 @@ const _ = grpc.SupportPackageIsVersion4
 
 type AnnotatorClient interface {
 	Annotate(ctx context.Context, in *Flow, opts ...grpc.CallOption) (*Flow, error)
+	AnnotateStream(ctx context.Context, opts ...grpc.CallOption) (Annotator_AnnotateStreamClient, error)
 }
 
 type annotatorClient struct {
@@ -335,10 +574,42 @@ func (c *annotatorClient) Annotate(ctx context.Context, in *Flow, opts ...grpc.C
 	return out, nil
 }
 
+func (c *annotatorClient) AnnotateStream(ctx context.Context, opts ...grpc.CallOption) (Annotator_AnnotateStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Annotator_serviceDesc.Streams[0], c.cc, "/netflow.annotator/AnnotateStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &annotatorAnnotateStreamClient{stream}
+	return x, nil
+}
+
+type Annotator_AnnotateStreamClient interface {
+	Send(*FlowBatch) error
+	Recv() (*FlowBatch, error)
+	grpc.ClientStream
+}
+
+type annotatorAnnotateStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *annotatorAnnotateStreamClient) Send(m *FlowBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *annotatorAnnotateStreamClient) Recv() (*FlowBatch, error) {
+	m := new(FlowBatch)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Annotator service
 
 type AnnotatorServer interface {
 	Annotate(context.Context, *Flow) (*Flow, error)
+	AnnotateStream(Annotator_AnnotateStreamServer) error
 }
 
 func RegisterAnnotatorServer(s *grpc.Server, srv AnnotatorServer) {
@@ -363,6 +634,32 @@ func _Annotator_Annotate_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Annotator_AnnotateStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AnnotatorServer).AnnotateStream(&annotatorAnnotateStreamServer{stream})
+}
+
+type Annotator_AnnotateStreamServer interface {
+	Send(*FlowBatch) error
+	Recv() (*FlowBatch, error)
+	grpc.ServerStream
+}
+
+type annotatorAnnotateStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *annotatorAnnotateStreamServer) Send(m *FlowBatch) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *annotatorAnnotateStreamServer) Recv() (*FlowBatch, error) {
+	m := new(FlowBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Annotator_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "netflow.annotator",
 	HandlerType: (*AnnotatorServer)(nil),
@@ -372,42 +669,172 @@ var _Annotator_serviceDesc = grpc.ServiceDesc{
 			Handler:    _Annotator_Annotate_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "AnnotateStream",
+			Handler:       _Annotator_AnnotateStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "netflow.proto",
+}
+
+// Client API for Ingest service
+
+type IngestClient interface {
+	Ingest(ctx context.Context, opts ...grpc.CallOption) (Ingest_IngestClient, error)
+}
+
+type ingestClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewIngestClient(cc *grpc.ClientConn) IngestClient {
+	return &ingestClient{cc}
+}
+
+func (c *ingestClient) Ingest(ctx context.Context, opts ...grpc.CallOption) (Ingest_IngestClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Ingest_serviceDesc.Streams[0], c.cc, "/netflow.ingest/Ingest", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ingestIngestClient{stream}
+	return x, nil
+}
+
+type Ingest_IngestClient interface {
+	Send(*Flow) error
+	CloseAndRecv() (*IngestSummary, error)
+	grpc.ClientStream
+}
+
+type ingestIngestClient struct {
+	grpc.ClientStream
+}
+
+func (x *ingestIngestClient) Send(m *Flow) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ingestIngestClient) CloseAndRecv() (*IngestSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Ingest service
+
+type IngestServer interface {
+	Ingest(Ingest_IngestServer) error
+}
+
+func RegisterIngestServer(s *grpc.Server, srv IngestServer) {
+	s.RegisterService(&_Ingest_serviceDesc, srv)
+}
+
+func _Ingest_Ingest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).Ingest(&ingestIngestServer{stream})
+}
+
+type Ingest_IngestServer interface {
+	SendAndClose(*IngestSummary) error
+	Recv() (*Flow, error)
+	grpc.ServerStream
+}
+
+type ingestIngestServer struct {
+	grpc.ServerStream
+}
+
+func (x *ingestIngestServer) SendAndClose(m *IngestSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ingestIngestServer) Recv() (*Flow, error) {
+	m := new(Flow)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _Ingest_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "netflow.ingest",
+	HandlerType: (*IngestServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Ingest",
+			Handler:       _Ingest_Ingest_Handler,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "netflow.proto",
 }
 
 func init() { proto.RegisterFile("netflow.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 476 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x52, 0xcd, 0x8e, 0xd3, 0x30,
-	0x10, 0x26, 0x6d, 0xfa, 0x37, 0xdd, 0x2e, 0xbb, 0x46, 0x80, 0x59, 0xa1, 0x55, 0x15, 0x84, 0x14,
-	0xf6, 0xb0, 0x87, 0x72, 0x40, 0xe2, 0xd6, 0x0b, 0xa2, 0x07, 0x44, 0x95, 0x17, 0x88, 0x4c, 0xe2,
-	0xb0, 0xd6, 0x26, 0xb6, 0x65, 0x4f, 0xb5, 0x81, 0xb7, 0xe0, 0x8d, 0xd1, 0xd8, 0x69, 0x61, 0x11,
-	0x37, 0x7f, 0x3f, 0x33, 0xfe, 0xec, 0x19, 0x58, 0x69, 0x89, 0x4d, 0x6b, 0x1e, 0x6e, 0xad, 0x33,
-	0x68, 0xd8, 0x6c, 0x80, 0xd9, 0x3b, 0x18, 0xdb, 0xa6, 0x67, 0xe7, 0x30, 0xda, 0xed, 0x79, 0xb2,
-	0x4e, 0xf2, 0xb3, 0x62, 0xb4, 0xdb, 0x33, 0x06, 0x69, 0x27, 0xfc, 0x3d, 0x1f, 0x05, 0x26, 0x9c,
-	0xb3, 0x5f, 0x29, 0xa4, 0x9f, 0x5a, 0xf3, 0xc0, 0x5e, 0xc0, 0xd4, 0x99, 0x03, 0x4a, 0x37, 0x14,
-	0x0c, 0x88, 0xf8, 0x46, 0x74, 0xaa, 0xfd, 0x11, 0xca, 0x56, 0xc5, 0x80, 0xd8, 0x2b, 0x98, 0x7b,
-	0x57, 0x95, 0xa2, 0xae, 0x1d, 0x1f, 0x87, 0x8a, 0x99, 0x77, 0xd5, 0xb6, 0xae, 0x1d, 0x49, 0xb5,
-	0xc7, 0x28, 0xa5, 0x51, 0xaa, 0x3d, 0x06, 0xe9, 0x0a, 0xe6, 0x21, 0x6b, 0x65, 0x5a, 0x3e, 0x09,
-	0xfd, 0x4e, 0x98, 0x71, 0x98, 0x59, 0x51, 0xdd, 0x4b, 0xf4, 0x7c, 0x1a, 0xa4, 0x23, 0xa4, 0xe0,
-	0x5e, 0xfd, 0x94, 0x7c, 0xb6, 0x4e, 0xf2, 0xb4, 0x08, 0x67, 0xf6, 0x1c, 0xa6, 0x4a, 0x63, 0xa9,
-	0x34, 0x9f, 0x07, 0xf3, 0x44, 0x69, 0xdc, 0x69, 0xf6, 0x12, 0x66, 0x44, 0x9b, 0x03, 0xf2, 0x45,
-	0xcc, 0xab, 0x34, 0x7e, 0x3d, 0x20, 0x85, 0xd2, 0xb2, 0xc7, 0xf2, 0xce, 0x58, 0x0e, 0x31, 0x14,
-	0xe1, 0xcf, 0xc6, 0x52, 0xab, 0xf0, 0x14, 0xcf, 0x97, 0xb1, 0x15, 0x3d, 0xc4, 0x13, 0x1d, 0x9e,
-	0xe1, 0xf9, 0x59, 0xa4, 0xe9, 0x11, 0x9e, 0x5d, 0xc3, 0xf2, 0xd8, 0x88, 0xb4, 0x55, 0xd0, 0x16,
-	0x43, 0xaf, 0xad, 0x67, 0xaf, 0x61, 0x81, 0xaa, 0x93, 0x1e, 0x45, 0x67, 0xf9, 0xf9, 0x3a, 0xc9,
-	0xc7, 0xc5, 0x1f, 0x82, 0xbd, 0x05, 0xfa, 0xa6, 0xd2, 0x36, 0x3d, 0x7f, 0xba, 0x4e, 0xf2, 0xe5,
-	0xe6, 0xec, 0xf6, 0x34, 0xc4, 0xa6, 0x2f, 0x28, 0xc8, 0xbe, 0xe9, 0xc9, 0x46, 0x77, 0x93, 0xed,
-	0xe2, 0x7f, 0xb6, 0xda, 0x23, 0xd9, 0x86, 0x21, 0x58, 0xe3, 0x90, 0x5f, 0xc6, 0x3f, 0xa3, 0x06,
-	0xc6, 0xe1, 0x71, 0x08, 0x41, 0x62, 0x51, 0xa2, 0x22, 0x92, 0xae, 0x01, 0xbc, 0xe8, 0x6c, 0x2b,
-	0x9d, 0x40, 0xc9, 0x9f, 0x85, 0x4f, 0xfd, 0x8b, 0xc9, 0x6e, 0x20, 0xdd, 0x69, 0x6c, 0x68, 0x7f,
-	0x54, 0x1d, 0xd6, 0x61, 0x55, 0x8c, 0x54, 0x4d, 0x63, 0xd0, 0xa2, 0x93, 0x61, 0x11, 0x16, 0x45,
-	0x38, 0x67, 0x77, 0x30, 0xa1, 0xf5, 0xf1, 0xec, 0x0d, 0x4c, 0x28, 0x9e, 0xe7, 0xc9, 0x7a, 0x9c,
-	0x2f, 0x37, 0xab, 0x53, 0x5e, 0x92, 0x8b, 0xa8, 0xb1, 0x8f, 0x70, 0xa9, 0x34, 0x4a, 0xd7, 0x88,
-	0x4a, 0x96, 0x9d, 0xb0, 0x56, 0xe9, 0xef, 0x7c, 0xf4, 0x4f, 0x01, 0xdd, 0x5d, 0x5c, 0x9c, 0x7c,
-	0x5f, 0xa2, 0x6d, 0xf3, 0x01, 0x16, 0x42, 0x6b, 0x83, 0x02, 0x8d, 0x63, 0x37, 0x30, 0xdf, 0x46,
-	0x20, 0xd9, 0xe3, 0xab, 0xae, 0x1e, 0xc3, 0xec, 0xc9, 0xb7, 0x69, 0xd8, 0xb0, 0xf7, 0xbf, 0x03,
-	0x00, 0x00, 0xff, 0xff, 0x2a, 0x39, 0x13, 0x10, 0x2e, 0x03, 0x00, 0x00,
+	// 874 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x95, 0xdf, 0x6f, 0xdb, 0x36,
+	0x10, 0xc7, 0xeb, 0x1f, 0x89, 0x2d, 0x3a, 0x76, 0x13, 0x6e, 0x4d, 0xd8, 0xa4, 0x4b, 0x5d, 0x75,
+	0x59, 0xd5, 0x3e, 0x14, 0x43, 0xfa, 0x36, 0x60, 0xc3, 0xb2, 0x76, 0xc3, 0x3c, 0x60, 0x5b, 0xa0,
+	0xf4, 0x75, 0x10, 0x38, 0x89, 0xb2, 0xb9, 0x5a, 0x94, 0x40, 0x9e, 0x17, 0x7b, 0xff, 0xdf, 0xfe,
+	0xaf, 0xe1, 0x8e, 0xb2, 0x22, 0x67, 0xed, 0x9b, 0x79, 0xdf, 0x0f, 0x4f, 0xdf, 0xbb, 0x23, 0x69,
+	0x36, 0x36, 0x0a, 0xf2, 0x65, 0x79, 0xfb, 0xba, 0xb2, 0x25, 0x94, 0x7c, 0x50, 0x2f, 0xc3, 0x97,
+	0xac, 0x57, 0xe5, 0x6b, 0x3e, 0x61, 0xdd, 0xd9, 0xb5, 0xe8, 0x4c, 0x3b, 0xd1, 0x41, 0xdc, 0x9d,
+	0x5d, 0x73, 0xce, 0xfa, 0x85, 0x74, 0x1f, 0x44, 0x97, 0x22, 0xf4, 0x3b, 0xfc, 0x37, 0x60, 0xfd,
+	0x9f, 0x96, 0xe5, 0x2d, 0x3f, 0x66, 0xfb, 0xb6, 0x5c, 0x81, 0xb2, 0xf5, 0x86, 0x7a, 0x85, 0xf1,
+	0x5c, 0x16, 0x7a, 0xb9, 0xa1, 0x6d, 0xe3, 0xb8, 0x5e, 0xf1, 0xc7, 0x6c, 0xe8, 0x6c, 0x9a, 0xc8,
+	0x2c, 0xb3, 0xa2, 0x47, 0x3b, 0x06, 0xce, 0xa6, 0x57, 0x59, 0x66, 0x51, 0xca, 0x1c, 0x78, 0xa9,
+	0xef, 0xa5, 0xcc, 0x01, 0x49, 0xa7, 0x6c, 0x48, 0x5e, 0xd3, 0x72, 0x29, 0xf6, 0x28, 0x5f, 0xb3,
+	0xe6, 0x82, 0x0d, 0x2a, 0x99, 0x7e, 0x50, 0xe0, 0xc4, 0x3e, 0x49, 0xdb, 0x25, 0x1a, 0x77, 0xfa,
+	0x1f, 0x25, 0x06, 0xd3, 0x4e, 0xd4, 0x8f, 0xe9, 0x37, 0x7f, 0xc4, 0xf6, 0xb5, 0x81, 0x44, 0x1b,
+	0x31, 0x24, 0x78, 0x4f, 0x1b, 0x98, 0x19, 0x7e, 0xc2, 0x06, 0x18, 0x2e, 0x57, 0x20, 0x02, 0xef,
+	0x57, 0x1b, 0xf8, 0x7d, 0x05, 0x68, 0xca, 0xa8, 0x35, 0x24, 0x8b, 0xb2, 0x12, 0xcc, 0x9b, 0xc2,
+	0xf5, 0xcf, 0x65, 0x85, 0xa9, 0xa8, 0x14, 0x27, 0x46, 0x3e, 0x15, 0x16, 0xe2, 0x30, 0x4c, 0x65,
+	0x38, 0x71, 0xe0, 0xc3, 0x58, 0x84, 0xe3, 0xe7, 0x6c, 0xb4, 0x4d, 0x84, 0xda, 0x98, 0xb4, 0xa0,
+	0xce, 0x75, 0xe5, 0xf8, 0x13, 0x16, 0x80, 0x2e, 0x94, 0x03, 0x59, 0x54, 0x62, 0x32, 0xed, 0x44,
+	0xbd, 0xf8, 0x2e, 0xc0, 0x2f, 0x18, 0xb6, 0x29, 0xa9, 0xf2, 0xb5, 0x78, 0x38, 0xed, 0x44, 0xa3,
+	0xcb, 0x83, 0xd7, 0xcd, 0x10, 0xf3, 0x75, 0x8c, 0x46, 0xae, 0xf3, 0x35, 0x62, 0xf8, 0x6d, 0xc4,
+	0x0e, 0x3f, 0x86, 0x65, 0x0e, 0x10, 0xab, 0x87, 0x50, 0x95, 0x16, 0xc4, 0x91, 0xef, 0x19, 0x26,
+	0x28, 0x2d, 0x6c, 0x87, 0x40, 0x12, 0xf7, 0x12, 0x6e, 0x42, 0xe9, 0x9c, 0x31, 0x27, 0x8b, 0x6a,
+	0xa9, 0xac, 0x04, 0x25, 0x3e, 0xa3, 0xa6, 0xb6, 0x22, 0xfc, 0x25, 0x3b, 0xaa, 0x4a, 0x07, 0x89,
+	0x91, 0x90, 0x34, 0x33, 0xfe, 0x9c, 0x7a, 0x36, 0x41, 0xe1, 0x37, 0x09, 0x37, 0xf5, 0xa8, 0xdb,
+	0x68, 0x33, 0xf3, 0x47, 0x3b, 0xe8, 0x3b, 0x07, 0xff, 0x43, 0x1b, 0xd3, 0xc7, 0xe4, 0xac, 0x95,
+	0x95, 0x0c, 0xde, 0xcf, 0x4a, 0xe8, 0xc9, 0x0e, 0xfa, 0xae, 0xae, 0xe5, 0x8c, 0x05, 0x48, 0xa9,
+	0xbf, 0x95, 0x01, 0x21, 0xfc, 0x89, 0x32, 0x12, 0x7e, 0xc4, 0x35, 0xbf, 0x60, 0x93, 0x5c, 0x5b,
+	0x75, 0x2b, 0x97, 0xcb, 0x9a, 0x78, 0x4c, 0xc4, 0x78, 0x1b, 0xf5, 0xd8, 0x33, 0x76, 0x80, 0x86,
+	0xd2, 0x95, 0x83, 0xb2, 0x50, 0x56, 0x9c, 0x4d, 0x3b, 0x51, 0x10, 0x8f, 0x9c, 0x4d, 0xdf, 0xd6,
+	0x21, 0x44, 0xd0, 0x48, 0x83, 0x3c, 0xf1, 0x48, 0xe6, 0xa0, 0x41, 0xea, 0x59, 0x38, 0x0d, 0x4a,
+	0x7c, 0x41, 0x32, 0xce, 0xe2, 0x46, 0x83, 0xda, 0xce, 0x82, 0xa4, 0x73, 0x2f, 0x65, 0x0e, 0x48,
+	0x3a, 0x67, 0x23, 0x7f, 0xf6, 0x92, 0x4a, 0xc2, 0x42, 0x3c, 0x9d, 0xf6, 0xf0, 0x34, 0xd1, 0x01,
+	0xbc, 0x96, 0xb0, 0x40, 0xdd, 0x1f, 0x42, 0xaf, 0x4f, 0xbd, 0x4e, 0x27, 0x91, 0xf4, 0x17, 0xec,
+	0x21, 0x79, 0x2f, 0x8b, 0x62, 0x65, 0x34, 0x68, 0xe5, 0xc4, 0xb3, 0x69, 0x2f, 0x0a, 0xe2, 0x09,
+	0xda, 0xbf, 0x8b, 0x22, 0x48, 0x15, 0xb4, 0xc0, 0xd0, 0x83, 0x58, 0x44, 0x0b, 0x7c, 0xea, 0x1d,
+	0xa5, 0xe5, 0xca, 0x80, 0xdd, 0x88, 0xe7, 0xe4, 0x97, 0x51, 0x36, 0x8a, 0x20, 0xe0, 0x33, 0x79,
+	0xe0, 0x4b, 0x0f, 0x50, 0x16, 0x0f, 0xd4, 0x9d, 0x48, 0x35, 0x6c, 0xc4, 0x45, 0xd3, 0x89, 0xb7,
+	0x1a, 0x36, 0xdb, 0x4e, 0x90, 0xf4, 0x55, 0xd3, 0x09, 0x92, 0x4e, 0xfc, 0xcd, 0x00, 0x39, 0x17,
+	0x2f, 0x48, 0xc1, 0xbb, 0xf0, 0x5e, 0xce, 0x51, 0xc0, 0x3d, 0x28, 0x44, 0x5e, 0xc8, 0x1c, 0xbc,
+	0x97, 0xf3, 0x5f, 0xfa, 0xc3, 0xd3, 0xc3, 0xb3, 0xb8, 0x0f, 0x72, 0xee, 0xc2, 0x57, 0xac, 0x3f,
+	0x33, 0x90, 0xe3, 0x9b, 0xa7, 0x33, 0x7a, 0xc2, 0xc6, 0x71, 0x57, 0x67, 0xf8, 0x74, 0x18, 0x59,
+	0x28, 0x7a, 0xbc, 0x82, 0x98, 0x7e, 0x87, 0x0b, 0xb6, 0x87, 0x4f, 0x9e, 0xe3, 0xcf, 0xd9, 0x1e,
+	0x5e, 0x29, 0x27, 0x3a, 0xd3, 0x5e, 0x34, 0xba, 0x1c, 0x37, 0x77, 0x0c, 0xe5, 0xd8, 0x6b, 0xfc,
+	0x1b, 0x76, 0xa4, 0x0d, 0x28, 0x9b, 0xcb, 0x54, 0x25, 0x85, 0xac, 0x2a, 0x6d, 0xe6, 0xa2, 0x7b,
+	0x6f, 0x03, 0x7e, 0x3b, 0x3e, 0x6c, 0xb8, 0x5f, 0x3d, 0x16, 0xfe, 0xc1, 0xc6, 0x33, 0x33, 0x57,
+	0x0e, 0x6e, 0x56, 0x45, 0x21, 0xed, 0x86, 0x4e, 0x24, 0x66, 0x4d, 0x64, 0x9a, 0xaa, 0x0a, 0x94,
+	0xb7, 0xda, 0x8f, 0xc7, 0x14, 0xbd, 0xaa, 0x83, 0x77, 0x98, 0x55, 0x7f, 0xa9, 0x14, 0xb1, 0x6e,
+	0x0b, 0x8b, 0xeb, 0x60, 0xf8, 0x3d, 0x0b, 0xd0, 0xe9, 0x0f, 0x12, 0xd2, 0x45, 0xab, 0xf2, 0x3e,
+	0x55, 0xde, 0x14, 0xd7, 0xfd, 0x74, 0x71, 0x97, 0xb7, 0x2c, 0x90, 0xc6, 0x94, 0x20, 0xa1, 0xb4,
+	0xfc, 0x15, 0x1b, 0x5e, 0xf9, 0x85, 0xe2, 0xbb, 0xf8, 0xe9, 0xee, 0x32, 0x7c, 0xc0, 0xbf, 0x63,
+	0x93, 0x2d, 0x7b, 0x03, 0x56, 0xc9, 0x82, 0xf3, 0x1d, 0x84, 0x3c, 0x9d, 0x7e, 0x24, 0x16, 0x3e,
+	0x88, 0x3a, 0x5f, 0x77, 0x2e, 0xbf, 0xc5, 0xe7, 0x1b, 0x3b, 0xc3, 0xdf, 0xb0, 0x7d, 0xdf, 0xa3,
+	0xfb, 0xdf, 0x3c, 0x6e, 0x75, 0xb7, 0xd5, 0x43, 0x4c, 0xf0, 0xe7, 0x3e, 0xfd, 0x6b, 0xbc, 0xf9,
+	0x6f, 0x00, 0x9f, 0x5f, 0x76, 0xa0, 0x02, 0x07, 0x00, 0x00,
 }
@@ -98,7 +98,8 @@ func Decode(raw []byte, remote net.IP) (*Packet, error) {
 func decodeOption(packet *Packet, end unsafe.Pointer, size uintptr, remote net.IP) {
 	min := uintptr(end) - size
 
-	for uintptr(end) > min {
+	// Option template flow sets are padded to 32 bit boundaries
+	for uintptr(end) >= min+sizeOfOptionsTemplateRecordHeader {
 		headerPtr := unsafe.Pointer(uintptr(end) - sizeOfOptionsTemplateRecordHeader)
 
 		tmplRecs := &TemplateRecords{}
@@ -107,7 +108,7 @@ func decodeOption(packet *Packet, end unsafe.Pointer, size uintptr, remote net.I
 		tmplRecs.Packet = packet
 		tmplRecs.Records = make([]*TemplateRecord, 0, numPreAllocRecs)
 
-		ptr := headerPtr
+		ptr := unsafe.Pointer(uintptr(headerPtr) - sizeOfOptionScope)
 		// Process option scopes
 		for i := uint16(0); i < hdr.OptionScopeLength/uint16(sizeOfOptionScope); i++ {
 			optScope := (*OptionScope)(ptr)
@@ -66,11 +66,29 @@ func TestDecode2(t *testing.T) {
 		9, 0} // Version
 	s = convert.Reverse(s)
 
-	_, err := Decode(s, net.IP([]byte{1, 1, 1, 1}))
+	packet, err := Decode(s, net.IP([]byte{1, 1, 1, 1}))
 	if err != nil {
-		t.Errorf("Decoding packet failed: %v\n", err)
+		t.Fatalf("Decoding packet failed: %v\n", err)
 	}
 
+	if len(packet.Templates) != 1 {
+		t.Fatalf("Expected 1 template, got %d", len(packet.Templates))
+	}
+	tmpl := packet.Templates[0]
+	if tmpl.Header.TemplateID != 266 {
+		t.Errorf("Unexpected template ID %d", tmpl.Header.TemplateID)
+	}
+	if len(tmpl.OptionScopes) != 1 || *tmpl.OptionScopes[0] != (OptionScope{ScopeFieldLength: 4, ScopeFieldType: ScopeSystem}) {
+		t.Errorf("Unexpected option scopes %v", tmpl.OptionScopes)
+	}
+	if len(tmpl.Records) != 4 {
+		t.Fatalf("Expected 4 option fields, got %d", len(tmpl.Records))
+	}
+	for i, rec := range tmpl.Records {
+		if *rec != (TemplateRecord{Length: 8, Type: uint16(41 + i)}) {
+			t.Errorf("Unexpected option field %d: %v", i, *rec)
+		}
+	}
 }
 
 func testEq(a, b []byte) bool {
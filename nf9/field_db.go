@@ -108,4 +108,17 @@ const (
 	ApplicationDescription    = 94
 	ApplicationTag            = 95
 	ApplicationName           = 96
+	PostNATSrcIPv4Addr        = 225
+	PostNATDstIPv4Addr        = 226
+	PostNAPTSrcPort           = 227
+	PostNAPTDstPort           = 228
+	NATEvent                  = 230
+	FirewallEvent             = 233
+	PostNATSrcIPv6Addr        = 281
+	PostNATDstIPv6Addr        = 282
+	ASAXlateSrcAddrIPv4       = 40001
+	ASAXlateDstAddrIPv4       = 40002
+	ASAXlateSrcPort           = 40003
+	ASAXlateDstPort           = 40004
+	ASAFwEvent                = 40005
 )
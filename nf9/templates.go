@@ -24,6 +24,15 @@ var (
 	sizeOfOptionScope                 = unsafe.Sizeof(OptionScope{})
 )
 
+// Option scope types as defined in RFC3954
+const (
+	ScopeSystem    = 1
+	ScopeInterface = 2
+	ScopeLineCard  = 3
+	ScopeCache     = 4
+	ScopeTemplate  = 5
+)
+
 // TemplateRecordHeader represents the header of a template record
 type TemplateRecordHeader struct {
 	// Number of fields in this Template Record. Because a Template FlowSet
@@ -86,6 +95,25 @@ type OptionScope struct {
 	ScopeFieldType uint16
 }
 
+// FieldRecords returns the fields of an Options Data Record or Flow Data Record
+// described by this template. For options templates these are the scope fields
+// followed by the option fields as this is the order they appear in on the wire.
+func (t *TemplateRecords) FieldRecords() []*TemplateRecord {
+	if t.OptionScopes == nil {
+		return t.Records
+	}
+
+	recs := make([]*TemplateRecord, 0, len(t.OptionScopes)+len(t.Records))
+	for _, s := range t.OptionScopes {
+		recs = append(recs, &TemplateRecord{
+			Length: s.ScopeFieldLength,
+			Type:   s.ScopeFieldType,
+		})
+	}
+
+	return append(recs, t.Records...)
+}
+
 //TemplateRecord represents a Template Record as described in RFC3954
 type TemplateRecord struct {
 	// The length (in bytes) of the field.
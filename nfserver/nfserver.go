@@ -21,13 +21,18 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/bio-routing/tflow2/agents"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/srcache"
 
 	"github.com/golang/glog"
 	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/listener"
 	"github.com/bio-routing/tflow2/netflow"
 	"github.com/bio-routing/tflow2/nf9"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/ratelimit"
+	"github.com/bio-routing/tflow2/replicator"
 	"github.com/bio-routing/tflow2/stats"
 )
 
@@ -52,6 +57,13 @@ type fieldMap struct {
 	flowSamplerID             int
 	samplingInterval          int
 	flowSamplerRandomInterval int
+	scopeInterface            int
+	postNatSrcAddr            int
+	postNatDstAddr            int
+	postNatSrcPort            int
+	postNatDstPort            int
+	natEvent                  int
+	firewallEvent             int
 }
 
 // NetflowServer represents a Netflow Collector instance
@@ -63,66 +75,95 @@ type NetflowServer struct {
 	// receiver is the channel used to receive flows from the annotator layer
 	Output chan *netflow.Flow
 
-	// con is the UDP socket
-	conn *net.UDPConn
+	// sockets are the UDP sockets the server receives packets on
+	sockets *listener.Group
 
 	wg sync.WaitGroup
 
 	sampleRateCache *srcache.SamplerateCache
 
+	// replicator copies received datagrams to downstream collectors
+	replicator *replicator.Replicator
+
+	// registry maps agent addresses to names
+	registry *agents.Registry
+
+	// limiter limits the rate of flows per agent
+	limiter *ratelimit.Limiter
+
+	// queue buffers flows passed to the annotator layer. Its channel is Output.
+	queue *queue.Queue
+
 	config *config.Config
 }
 
 // New creates and starts a new `NetflowServer` instance
-func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache) *NetflowServer {
-	nfs := &NetflowServer{
-		tmplCache:       newTemplateCache(),
-		Output:          make(chan *netflow.Flow),
-		sampleRateCache: sampleRateCache,
-		config:          config,
-	}
+func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache, replicator *replicator.Replicator, registry *agents.Registry, limiter *ratelimit.Limiter) *NetflowServer {
+	nfs := newServer(config, sampleRateCache, registry)
+	nfs.replicator = replicator
+	nfs.limiter = limiter
 
-	addr, err := net.ResolveUDPAddr("udp", nfs.config.NetflowV9.Listen)
-	if err != nil {
-		panic(fmt.Sprintf("ResolveUDPAddr: %v", err))
-	}
-
-	conn, err := net.ListenUDP("udp", addr)
+	sockets, err := listener.Listen("netflow_v9", nfs.config.NetflowV9, numReaders)
 	if err != nil {
 		panic(fmt.Sprintf("Listen: %v", err))
 	}
-	nfs.conn = conn
+	nfs.sockets = sockets
 
 	// Create goroutines that read netflow packet and process it
-	nfs.wg.Add(numReaders)
-	for i := 0; i < numReaders; i++ {
-		go func(num int) {
-			nfs.packetWorker(num)
-		}(i)
+	readers := sockets.Readers()
+	nfs.wg.Add(len(readers))
+	for i, r := range readers {
+		go func(num int, r *listener.Reader) {
+			nfs.packetWorker(num, r)
+		}(i, r)
 	}
 
 	return nfs
 }
 
+// NewOffline creates a new `NetflowServer` instance that does not listen on any socket.
+// Packets are passed to it using Ingest().
+func NewOffline(config *config.Config, sampleRateCache *srcache.SamplerateCache, registry *agents.Registry) *NetflowServer {
+	return newServer(config, sampleRateCache, registry)
+}
+
+func newServer(config *config.Config, sampleRateCache *srcache.SamplerateCache, registry *agents.Registry) *NetflowServer {
+	q := queue.ForStage(config, "netflow_v9")
+	return &NetflowServer{
+		tmplCache:       newTemplateCache(),
+		Output:          q.C,
+		queue:           q,
+		sampleRateCache: sampleRateCache,
+		registry:        registry,
+		config:          config,
+	}
+}
+
 // Close closes the socket and stops the workers
 func (nfs *NetflowServer) Close() {
-	nfs.conn.Close()
+	if nfs.sockets != nil {
+		nfs.sockets.Close()
+	}
 	nfs.wg.Wait()
 }
 
-// validateSource checks if src is a configured agent
+// Ingest processes packet `buffer` from `agent` that was received at `ts` out of band,
+// e.g. read from a capture file
+func (nfs *NetflowServer) Ingest(agent net.IP, buffer []byte, ts int64) {
+	nfs.processPacket(agent, buffer, ts)
+}
+
+// validateSource checks if src is a known agent
 func (nfs *NetflowServer) validateSource(src net.IP) bool {
-	if _, ok := nfs.config.AgentsNameByIP[src.String()]; ok {
-		return true
-	}
-	return false
+	_, ok := nfs.registry.Name(src)
+	return ok
 }
 
 // packetWorker reads netflow packet from socket and handsoff processing to processFlowSets()
-func (nfs *NetflowServer) packetWorker(identity int) {
+func (nfs *NetflowServer) packetWorker(identity int, r *listener.Reader) {
 	buffer := make([]byte, 8960)
 	for {
-		length, remote, err := nfs.conn.ReadFromUDP(buffer)
+		length, remote, err := r.ReadFromUDP(buffer)
 		if err == io.EOF {
 			break
 		}
@@ -133,18 +174,17 @@ func (nfs *NetflowServer) packetWorker(identity int) {
 		atomic.AddUint64(&stats.GlobalStats.Netflow9packets, 1)
 		atomic.AddUint64(&stats.GlobalStats.Netflow9bytes, uint64(length))
 
-		if !nfs.validateSource(remote.IP) {
-			glog.Errorf("Unknown source: %s", remote.IP.String())
-		}
+		nfs.replicator.Replicate("netflow_v9", remote, buffer[:length])
 
-		nfs.processPacket(remote.IP, buffer[:length])
+		nfs.processPacket(remote.IP, buffer[:length], 0)
 	}
 	nfs.wg.Done()
 }
 
 // processPacket takes a raw netflow packet, send it to the decoder, updates template cache
-// (if there are templates in the packet) and passes the decoded packet over to processFlowSets()
-func (nfs *NetflowServer) processPacket(remote net.IP, buffer []byte) {
+// (if there are templates in the packet) and passes the decoded packet over to processFlowSets().
+// If `ts` is 0 the export time of the packet is used as timestamp of its flows.
+func (nfs *NetflowServer) processPacket(remote net.IP, buffer []byte, ts int64) {
 	length := len(buffer)
 	packet, err := nf9.Decode(buffer[:length], remote)
 	if err != nil {
@@ -152,12 +192,23 @@ func (nfs *NetflowServer) processPacket(remote net.IP, buffer []byte) {
 		return
 	}
 
+	if ts == 0 {
+		ts = int64(packet.Header.UnixSecs)
+	}
+
+	// Agents may be identified by the source ID rather than by the source address
+	agent := nfs.registry.ResolveSourceID(remote, packet.Header.SourceID)
+	if !nfs.validateSource(agent) {
+		glog.Errorf("Unknown source: %s", agent.String())
+	}
+
 	nfs.updateTemplateCache(remote, packet)
-	nfs.processFlowSets(remote, packet.Header.SourceID, packet.DataFlowSets(), int64(packet.Header.UnixSecs), packet)
+	nfs.processFlowSets(remote, agent, packet.Header.SourceID, packet.DataFlowSets(), ts, packet)
 }
 
-// processFlowSets iterates over flowSets and calls processFlowSet() for each flow set
-func (nfs *NetflowServer) processFlowSets(remote net.IP, sourceID uint32, flowSets []*nf9.FlowSet, ts int64, packet *nf9.Packet) {
+// processFlowSets iterates over flowSets received from `remote` and calls processFlowSet() for each flow set
+// with `agent` being the address identifying the agent
+func (nfs *NetflowServer) processFlowSets(remote net.IP, agent net.IP, sourceID uint32, flowSets []*nf9.FlowSet, ts int64, packet *nf9.Packet) {
 	addr := remote.String()
 	keyParts := make([]string, 3, 3)
 	for _, set := range flowSets {
@@ -171,12 +222,12 @@ func (nfs *NetflowServer) processFlowSets(remote net.IP, sourceID uint32, flowSe
 			continue
 		}
 
-		records := nf9.DecodeFlowSet(template.Records, *set)
+		records := nf9.DecodeFlowSet(template.FieldRecords(), *set)
 		if records == nil {
 			glog.Warning("Error decoding FlowSet")
 			continue
 		}
-		nfs.processFlowSet(template, records, remote, ts, packet)
+		nfs.processFlowSet(template, records, agent, ts, packet)
 	}
 }
 
@@ -186,13 +237,7 @@ func (nfs *NetflowServer) processFlowSet(template *nf9.TemplateRecords, records
 
 	for _, r := range records {
 		if template.OptionScopes != nil {
-			if fm.samplingInterval >= 0 {
-				nfs.sampleRateCache.Set(agent, uint64(convert.Uint32(r.Values[fm.samplingInterval])))
-			}
-
-			if fm.flowSamplerRandomInterval >= 0 {
-				nfs.sampleRateCache.Set(agent, uint64(convert.Uint32(r.Values[fm.flowSamplerRandomInterval])))
-			}
+			nfs.updateSampleRate(fm, r, agent)
 			continue
 		}
 
@@ -256,6 +301,30 @@ func (nfs *NetflowServer) processFlowSet(template *nf9.TemplateRecords, records
 			fl.NextHop = convert.Reverse(r.Values[fm.nextHop])
 		}
 
+		if fm.postNatSrcAddr >= 0 {
+			fl.PostNatSrcAddr = convert.Reverse(r.Values[fm.postNatSrcAddr])
+		}
+
+		if fm.postNatDstAddr >= 0 {
+			fl.PostNatDstAddr = convert.Reverse(r.Values[fm.postNatDstAddr])
+		}
+
+		if fm.postNatSrcPort >= 0 {
+			fl.PostNatSrcPort = convert.Uint32(r.Values[fm.postNatSrcPort])
+		}
+
+		if fm.postNatDstPort >= 0 {
+			fl.PostNatDstPort = convert.Uint32(r.Values[fm.postNatDstPort])
+		}
+
+		if fm.natEvent >= 0 {
+			fl.NatEvent = convert.Uint32(r.Values[fm.natEvent])
+		}
+
+		if fm.firewallEvent >= 0 {
+			fl.FirewallEvent = convert.Uint32(r.Values[fm.firewallEvent])
+		}
+
 		if !nfs.config.BGPAugmentation.Enabled {
 			if fm.srcAsn >= 0 {
 				fl.SrcAs = convert.Uint32(r.Values[fm.srcAsn])
@@ -266,13 +335,49 @@ func (nfs *NetflowServer) processFlowSet(template *nf9.TemplateRecords, records
 			}
 		}
 
-		fl.Samplerate = nfs.sampleRateCache.Get(agent)
+		if fm.flowSamplerID >= 0 {
+			fl.Samplerate = nfs.sampleRateCache.GetSampler(agent, convert.Uint32(r.Values[fm.flowSamplerID]), fl.IntIn)
+		} else {
+			fl.Samplerate = nfs.sampleRateCache.GetInterface(agent, fl.IntIn)
+		}
 
 		if nfs.config.Debug > 2 {
 			Dump(&fl)
 		}
 
-		nfs.Output <- &fl
+		if !nfs.limiter.Admit(agent, &fl) {
+			continue
+		}
+
+		nfs.queue.Put(&fl)
+	}
+}
+
+// updateSampleRate updates the samplerate cache from an options data record. Rates are
+// stored per sampler if the record carries a sampler ID, per interface if the record
+// is scoped to an interface and per agent otherwise.
+func (nfs *NetflowServer) updateSampleRate(fm *fieldMap, r nf9.FlowDataRecord, agent net.IP) {
+	var rate uint64
+	switch {
+	case fm.samplingInterval >= 0:
+		rate = uint64(convert.Uint32(r.Values[fm.samplingInterval]))
+	case fm.flowSamplerRandomInterval >= 0:
+		rate = uint64(convert.Uint32(r.Values[fm.flowSamplerRandomInterval]))
+	default:
+		return
+	}
+
+	if rate == 0 {
+		return
+	}
+
+	switch {
+	case fm.flowSamplerID >= 0:
+		nfs.sampleRateCache.SetSampler(agent, convert.Uint32(r.Values[fm.flowSamplerID]), rate)
+	case fm.scopeInterface >= 0:
+		nfs.sampleRateCache.SetInterface(agent, convert.Uint32(r.Values[fm.scopeInterface]), rate)
+	default:
+		nfs.sampleRateCache.Set(agent, rate)
 	}
 }
 
@@ -323,9 +428,24 @@ func generateFieldMap(template *nf9.TemplateRecords) *fieldMap {
 		flowSamplerID:             -1,
 		samplingInterval:          -1,
 		flowSamplerRandomInterval: -1,
+		scopeInterface:            -1,
+		postNatSrcAddr:            -1,
+		postNatDstAddr:            -1,
+		postNatSrcPort:            -1,
+		postNatDstPort:            -1,
+		natEvent:                  -1,
+		firewallEvent:             -1,
 	}
 
 	i := -1
+	for _, s := range template.OptionScopes {
+		i++
+
+		if s.ScopeFieldType == nf9.ScopeInterface {
+			fm.scopeInterface = i
+		}
+	}
+
 	for _, f := range template.Records {
 		i++
 
@@ -362,10 +482,24 @@ func generateFieldMap(template *nf9.TemplateRecords) *fieldMap {
 			fm.srcAsn = i
 		case nf9.DstAs:
 			fm.dstAsn = i
+		case nf9.FlowSamplerID:
+			fm.flowSamplerID = i
 		case nf9.SamplingInterval:
 			fm.samplingInterval = i
 		case nf9.FlowSamplerRandomInterval:
 			fm.flowSamplerRandomInterval = i
+		case nf9.PostNATSrcIPv4Addr, nf9.PostNATSrcIPv6Addr, nf9.ASAXlateSrcAddrIPv4:
+			fm.postNatSrcAddr = i
+		case nf9.PostNATDstIPv4Addr, nf9.PostNATDstIPv6Addr, nf9.ASAXlateDstAddrIPv4:
+			fm.postNatDstAddr = i
+		case nf9.PostNAPTSrcPort, nf9.ASAXlateSrcPort:
+			fm.postNatSrcPort = i
+		case nf9.PostNAPTDstPort, nf9.ASAXlateDstPort:
+			fm.postNatDstPort = i
+		case nf9.NATEvent:
+			fm.natEvent = i
+		case nf9.FirewallEvent, nf9.ASAFwEvent:
+			fm.firewallEvent = i
 		}
 	}
 	return &fm
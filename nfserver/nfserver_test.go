@@ -0,0 +1,113 @@
+package nfserver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/agents"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/nf9"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/srcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessFlowSetSampleRates(t *testing.T) {
+	assert := assert.New(t)
+
+	agent := net.IP{192, 0, 2, 1}
+	q := queue.New("netflow_v9", 10, queue.PolicyBlock)
+	nfs := &NetflowServer{
+		Output:          q.C,
+		queue:           q,
+		sampleRateCache: srcache.New(nil),
+		config: &config.Config{
+			BGPAugmentation: &config.BGPAugment{},
+		},
+	}
+
+	// Values are little endian as the packet has been reversed during decoding
+	interfaceOptions := &nf9.TemplateRecords{
+		OptionScopes: []*nf9.OptionScope{
+			{ScopeFieldLength: 4, ScopeFieldType: nf9.ScopeInterface},
+		},
+		Records: []*nf9.TemplateRecord{
+			{Length: 4, Type: nf9.SamplingInterval},
+		},
+	}
+	nfs.processFlowSet(interfaceOptions, []nf9.FlowDataRecord{
+		{Values: [][]byte{{5, 0, 0, 0}, {0, 2, 0, 0}}},
+	}, agent, 0, nil)
+
+	samplerOptions := &nf9.TemplateRecords{
+		OptionScopes: []*nf9.OptionScope{
+			{ScopeFieldLength: 4, ScopeFieldType: nf9.ScopeSystem},
+		},
+		Records: []*nf9.TemplateRecord{
+			{Length: 1, Type: nf9.FlowSamplerID},
+			{Length: 4, Type: nf9.FlowSamplerRandomInterval},
+		},
+	}
+	nfs.processFlowSet(samplerOptions, []nf9.FlowDataRecord{
+		{Values: [][]byte{{1, 0, 0, 0}, {1}, {100, 0, 0, 0}}},
+		{Values: [][]byte{{1, 0, 0, 0}, {2}, {0, 16, 0, 0}}},
+	}, agent, 0, nil)
+
+	data := &nf9.TemplateRecords{
+		Records: []*nf9.TemplateRecord{
+			{Length: 4, Type: nf9.InputSnmp},
+			{Length: 1, Type: nf9.FlowSamplerID},
+		},
+	}
+	nfs.processFlowSet(data, []nf9.FlowDataRecord{
+		{Values: [][]byte{{5, 0, 0, 0}, {1}}},
+		{Values: [][]byte{{5, 0, 0, 0}, {2}}},
+		{Values: [][]byte{{5, 0, 0, 0}, {3}}},
+		{Values: [][]byte{{6, 0, 0, 0}, {3}}},
+	}, agent, 0, nil)
+
+	for _, expected := range []uint64{100, 4096, 512, 1} {
+		fl := <-nfs.Output
+		assert.Equal(expected, fl.Samplerate)
+	}
+}
+
+func TestProcessPacketOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	agent := net.IP{192, 0, 2, 1}
+	registry, err := agents.New([]config.Agent{{Name: "rtr01", IPAddress: "192.0.2.1"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nfs := NewOffline(&config.Config{
+		BGPAugmentation: &config.BGPAugment{},
+	}, srcache.New(nil), registry)
+
+	nfs.processPacket(agent, []byte{
+		0, 9, // Version
+		0, 2, // Count
+		0, 0, 0, 0, // sysUpTime
+		0, 0, 0, 0, // UNIX secs
+		0, 0, 0, 1, // Sequence Number
+		0, 0, 0, 0, // Source ID
+
+		0, 1, // FlowSetID (options template)
+		0, 20, // Length
+		1, 0, // TemplateID
+		0, 4, // OptionScopeLength
+		0, 4, // OptionLength
+		0, 2, // Scope 1 Field Type = 2 = Interface
+		0, 4, // Scope 1 Field Length
+		0, 34, // Type = SamplingInterval
+		0, 4, // Length
+		0, 0, // Padding
+
+		1, 0, // FlowSetID
+		0, 12, // Length
+		0, 0, 0, 5, // Interface
+		0, 0, 2, 0, // SamplingInterval
+	}, 0)
+
+	assert.Equal(uint64(512), nfs.sampleRateCache.GetInterface(agent, 5))
+}
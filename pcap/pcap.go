@@ -0,0 +1,333 @@
+// Package pcap reads packets from pcap and pcapng capture files
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// Link types as defined in http://www.tcpdump.org/linktypes.html
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLinuxSLL = 113
+	LinkTypeIPv4     = 228
+	LinkTypeIPv6     = 229
+)
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+
+	blockTypeSectionHeader  = 0x0a0d0d0a
+	blockTypeInterface      = 0x00000001
+	blockTypeEnhancedPacket = 0x00000006
+	byteOrderMagic          = 0x1a2b3c4d
+
+	optionEndOfOpt = 0
+	optionTSResol  = 9
+
+	// maxTSResolDecimal and maxTSResolBinary are the finest timestamp resolutions whose
+	// units per second fit into 64 bits
+	maxTSResolDecimal = 19
+	maxTSResolBinary  = 63
+
+	// maxBlockSize limits the memory allocated for a single packet or block
+	maxBlockSize = 1 << 24
+)
+
+// Packet is a packet read from a capture file
+type Packet struct {
+	Timestamp time.Time
+	LinkType  uint32
+	Data      []byte
+}
+
+// Reader reads packets from a pcap or pcapng capture file
+type Reader struct {
+	r         *bufio.Reader
+	byteOrder binary.ByteOrder
+	ng        bool
+
+	// pcap
+	linkType uint32
+	tsScale  int64
+
+	// pcapng
+	interfaces []iface
+}
+
+// iface is an interface described by a pcapng Interface Description Block
+type iface struct {
+	linkType uint32
+
+	// tsUnits is the number of timestamp units per second
+	tsUnits uint64
+}
+
+// NewReader creates a new Reader reading from `r`. The file format is detected from the file header.
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{
+		r: bufio.NewReader(r),
+	}
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(pr.r, magic); err != nil {
+		return nil, fmt.Errorf("Unable to read file header: %v", err)
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(magic) == blockTypeSectionHeader:
+		pr.ng = true
+		if err := pr.readSectionHeader(); err != nil {
+			return nil, err
+		}
+		return pr, nil
+	case binary.LittleEndian.Uint32(magic) == magicMicroseconds || binary.LittleEndian.Uint32(magic) == magicNanoseconds:
+		pr.byteOrder = binary.LittleEndian
+	case binary.BigEndian.Uint32(magic) == magicMicroseconds || binary.BigEndian.Uint32(magic) == magicNanoseconds:
+		pr.byteOrder = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("Unknown file format: magic 0x%x", magic)
+	}
+
+	pr.tsScale = int64(time.Microsecond)
+	if pr.byteOrder.Uint32(magic) == magicNanoseconds {
+		pr.tsScale = int64(time.Nanosecond)
+	}
+
+	hdr := make([]byte, 20)
+	if _, err := io.ReadFull(pr.r, hdr); err != nil {
+		return nil, fmt.Errorf("Unable to read file header: %v", err)
+	}
+	pr.linkType = pr.byteOrder.Uint32(hdr[16:20]) & 0x0fffffff
+
+	return pr, nil
+}
+
+// Next returns the next packet of the capture. It returns io.EOF at the end of the file.
+func (pr *Reader) Next() (*Packet, error) {
+	if pr.ng {
+		return pr.nextNG()
+	}
+
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(pr.r, hdr); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("Truncated packet header")
+		}
+		return nil, err
+	}
+
+	capLen := pr.byteOrder.Uint32(hdr[8:12])
+	if capLen > maxBlockSize {
+		return nil, fmt.Errorf("Packet too large: %d bytes", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return nil, fmt.Errorf("Truncated packet: %v", err)
+	}
+
+	sec := int64(pr.byteOrder.Uint32(hdr[0:4]))
+	frac := int64(pr.byteOrder.Uint32(hdr[4:8]))
+	return &Packet{
+		Timestamp: time.Unix(sec, frac*pr.tsScale),
+		LinkType:  pr.linkType,
+		Data:      data,
+	}, nil
+}
+
+// nextNG reads blocks until it finds the next Enhanced Packet Block
+func (pr *Reader) nextNG() (*Packet, error) {
+	for {
+		blockType, body, err := pr.readBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch blockType {
+		case blockTypeSectionHeader:
+			if err := pr.parseSectionHeader(body); err != nil {
+				return nil, err
+			}
+		case blockTypeInterface:
+			if err := pr.parseInterface(body); err != nil {
+				return nil, err
+			}
+		case blockTypeEnhancedPacket:
+			return pr.parseEnhancedPacket(body)
+		}
+	}
+}
+
+// readSectionHeader reads the remainder of the first Section Header Block after its block type
+func (pr *Reader) readSectionHeader() error {
+	hdr := make([]byte, 8)
+	if _, err := io.ReadFull(pr.r, hdr); err != nil {
+		return fmt.Errorf("Unable to read section header: %v", err)
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(hdr[4:8]) == byteOrderMagic:
+		pr.byteOrder = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[4:8]) == byteOrderMagic:
+		pr.byteOrder = binary.BigEndian
+	default:
+		return fmt.Errorf("Invalid byte order magic in section header")
+	}
+
+	length := pr.byteOrder.Uint32(hdr[0:4])
+	if length < 28 || length > maxBlockSize || length%4 != 0 {
+		return fmt.Errorf("Invalid section header length %d", length)
+	}
+
+	rest := make([]byte, length-12)
+	if _, err := io.ReadFull(pr.r, rest); err != nil {
+		return fmt.Errorf("Unable to read section header: %v", err)
+	}
+
+	return pr.parseSectionHeader(append(hdr[4:8], rest[:len(rest)-4]...))
+}
+
+// readBlock reads a pcapng block and returns its type and body
+func (pr *Reader) readBlock() (uint32, []byte, error) {
+	hdr := make([]byte, 8)
+	if _, err := io.ReadFull(pr.r, hdr); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, fmt.Errorf("Truncated block header")
+		}
+		return 0, nil, err
+	}
+
+	// A new section may switch the byte order
+	if binary.LittleEndian.Uint32(hdr[0:4]) == blockTypeSectionHeader {
+		peek, err := pr.r.Peek(4)
+		if err != nil {
+			return 0, nil, fmt.Errorf("Truncated section header")
+		}
+		switch {
+		case binary.LittleEndian.Uint32(peek) == byteOrderMagic:
+			pr.byteOrder = binary.LittleEndian
+		case binary.BigEndian.Uint32(peek) == byteOrderMagic:
+			pr.byteOrder = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("Invalid byte order magic in section header")
+		}
+	}
+
+	blockType := pr.byteOrder.Uint32(hdr[0:4])
+	length := pr.byteOrder.Uint32(hdr[4:8])
+	if length < 12 || length > maxBlockSize || length%4 != 0 {
+		return 0, nil, fmt.Errorf("Invalid block length %d", length)
+	}
+
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(pr.r, body); err != nil {
+		return 0, nil, fmt.Errorf("Truncated block: %v", err)
+	}
+
+	return blockType, body[:len(body)-4], nil
+}
+
+func (pr *Reader) parseSectionHeader(body []byte) error {
+	if len(body) < 16 {
+		return fmt.Errorf("Section header too short")
+	}
+
+	if major := pr.byteOrder.Uint16(body[4:6]); major != 1 {
+		return fmt.Errorf("Unsupported pcapng version %d", major)
+	}
+
+	// Interface IDs are local to a section
+	pr.interfaces = nil
+	return nil
+}
+
+func (pr *Reader) parseInterface(body []byte) error {
+	if len(body) < 8 {
+		return fmt.Errorf("Interface description block too short")
+	}
+
+	intf := iface{
+		linkType: uint32(pr.byteOrder.Uint16(body[0:2])),
+		tsUnits:  1000000,
+	}
+
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code := pr.byteOrder.Uint16(opts[0:2])
+		length := int(pr.byteOrder.Uint16(opts[2:4]))
+		if code == optionEndOfOpt || len(opts) < 4+length {
+			break
+		}
+
+		if code == optionTSResol && length >= 1 {
+			units, err := tsUnits(opts[4])
+			if err != nil {
+				return err
+			}
+			intf.tsUnits = units
+		}
+
+		opts = opts[4+(length+3)/4*4:]
+	}
+
+	pr.interfaces = append(pr.interfaces, intf)
+	return nil
+}
+
+// tsUnits returns the number of timestamp units per second of if_tsresol value `resol`. The most
+// significant bit selects a negative power of 2 instead of 10.
+func tsUnits(resol byte) (uint64, error) {
+	exp := resol & 0x7f
+	if resol&0x80 != 0 {
+		if exp > maxTSResolBinary {
+			return 0, fmt.Errorf("Unsupported timestamp resolution 2^-%d", exp)
+		}
+		return 1 << exp, nil
+	}
+
+	if exp > maxTSResolDecimal {
+		return 0, fmt.Errorf("Unsupported timestamp resolution 10^-%d", exp)
+	}
+	units := uint64(1)
+	for i := byte(0); i < exp; i++ {
+		units *= 10
+	}
+	return units, nil
+}
+
+func (pr *Reader) parseEnhancedPacket(body []byte) (*Packet, error) {
+	if len(body) < 20 {
+		return nil, fmt.Errorf("Enhanced packet block too short")
+	}
+
+	id := pr.byteOrder.Uint32(body[0:4])
+	if int(id) >= len(pr.interfaces) {
+		return nil, fmt.Errorf("Enhanced packet block references unknown interface %d", id)
+	}
+	intf := pr.interfaces[id]
+
+	ts := uint64(pr.byteOrder.Uint32(body[4:8]))<<32 | uint64(pr.byteOrder.Uint32(body[8:12]))
+	capLen := pr.byteOrder.Uint32(body[12:16])
+	if int(capLen) > len(body)-20 {
+		return nil, fmt.Errorf("Enhanced packet block truncated")
+	}
+
+	// The fraction times 10^9 may exceed 64 bits for resolutions finer than nanoseconds. As the
+	// fraction is less than tsUnits, the quotient is less than 10^9 and does not overflow.
+	sec := ts / intf.tsUnits
+	hi, lo := bits.Mul64(ts%intf.tsUnits, uint64(time.Second))
+	nsec, _ := bits.Div64(hi, lo, intf.tsUnits)
+	return &Packet{
+		Timestamp: time.Unix(int64(sec), int64(nsec)),
+		LinkType:  intf.linkType,
+		Data:      body[20 : 20+capLen],
+	}, nil
+}
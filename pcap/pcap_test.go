@@ -0,0 +1,229 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// udpPacket builds an ethernet frame carrying an IPv4 UDP datagram
+func udpPacket(src net.IP, dstPort uint16, payload []byte) []byte {
+	b := &bytes.Buffer{}
+	b.Write(make([]byte, 12))
+	binary.Write(b, binary.BigEndian, uint16(etherTypeIPv4))
+
+	b.Write([]byte{0x45, 0})
+	binary.Write(b, binary.BigEndian, uint16(sizeOfIPv4+sizeOfUDPHeader+len(payload)))
+	b.Write([]byte{0, 0, 0x40, 0, 64, protocolUDP, 0, 0})
+	b.Write(src.To4())
+	b.Write(net.IP{192, 0, 2, 100})
+
+	binary.Write(b, binary.BigEndian, uint16(50000))
+	binary.Write(b, binary.BigEndian, dstPort)
+	binary.Write(b, binary.BigEndian, uint16(sizeOfUDPHeader+len(payload)))
+	b.Write([]byte{0, 0})
+	b.Write(payload)
+
+	return b.Bytes()
+}
+
+func TestReaderPcap(t *testing.T) {
+	assert := assert.New(t)
+
+	frame := udpPacket(net.IP{192, 0, 2, 1}, 2055, []byte("foo"))
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		b := &bytes.Buffer{}
+		binary.Write(b, bo, []uint32{magicNanoseconds})
+		binary.Write(b, bo, []uint16{2, 4})
+		binary.Write(b, bo, []uint32{0, 0, 65535, LinkTypeEthernet})
+		binary.Write(b, bo, []uint32{1500000000, 250, uint32(len(frame)), uint32(len(frame))})
+		b.Write(frame)
+
+		r, err := NewReader(b)
+		if err != nil {
+			t.Fatalf("NewReader failed: %v", err)
+		}
+
+		p, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		assert.Equal(time.Unix(1500000000, 250), p.Timestamp)
+		assert.Equal(uint32(LinkTypeEthernet), p.LinkType)
+		assert.Equal(frame, p.Data)
+
+		_, err = r.Next()
+		assert.Equal(io.EOF, err)
+	}
+}
+
+// pcapNG returns a pcapng file of `frame` captured at `ts` on an interface of timestamp resolution `resol`
+func pcapNG(resol byte, ts uint64, frame []byte) *bytes.Buffer {
+	block := func(b *bytes.Buffer, blockType uint32, body []byte) {
+		binary.Write(b, binary.LittleEndian, blockType)
+		binary.Write(b, binary.LittleEndian, uint32(len(body)+12))
+		b.Write(body)
+		binary.Write(b, binary.LittleEndian, uint32(len(body)+12))
+	}
+
+	b := &bytes.Buffer{}
+
+	shb := &bytes.Buffer{}
+	binary.Write(shb, binary.LittleEndian, uint32(byteOrderMagic))
+	binary.Write(shb, binary.LittleEndian, []uint16{1, 0})
+	binary.Write(shb, binary.LittleEndian, int64(-1))
+	block(b, blockTypeSectionHeader, shb.Bytes())
+
+	idb := &bytes.Buffer{}
+	binary.Write(idb, binary.LittleEndian, []uint16{LinkTypeEthernet, 0})
+	binary.Write(idb, binary.LittleEndian, uint32(65535))
+	binary.Write(idb, binary.LittleEndian, []uint16{optionTSResol, 1})
+	idb.Write([]byte{resol, 0, 0, 0})
+	binary.Write(idb, binary.LittleEndian, []uint16{optionEndOfOpt, 0})
+	block(b, blockTypeInterface, idb.Bytes())
+
+	// Name resolution block to be skipped
+	block(b, 4, []byte{0, 0, 0, 0})
+
+	epb := &bytes.Buffer{}
+	binary.Write(epb, binary.LittleEndian, []uint32{0, uint32(ts >> 32), uint32(ts), uint32(len(frame)), uint32(len(frame))})
+	epb.Write(frame)
+	epb.Write(make([]byte, (4-len(frame)%4)%4))
+	block(b, blockTypeEnhancedPacket, epb.Bytes())
+
+	return b
+}
+
+func TestReaderPcapNG(t *testing.T) {
+	assert := assert.New(t)
+
+	// Interface with millisecond resolution
+	frame := udpPacket(net.IP{192, 0, 2, 1}, 6343, []byte("bar"))
+	r, err := NewReader(pcapNG(3, 1500000000123, frame))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+
+	p, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	assert.Equal(time.Unix(1500000000, 123000000), p.Timestamp)
+	assert.Equal(uint32(LinkTypeEthernet), p.LinkType)
+	assert.Equal(frame, p.Data)
+
+	_, err = r.Next()
+	assert.Equal(io.EOF, err)
+}
+
+func TestReaderPcapNGTSResol(t *testing.T) {
+	tests := []struct {
+		name     string
+		resol    byte
+		ts       uint64
+		expected time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "Picoseconds",
+			resol:    12,
+			ts:       1500000000123456789,
+			expected: time.Unix(1500000, 123456),
+		},
+		{
+			name:     "10^-19 seconds",
+			resol:    19,
+			ts:       15123456789012345678,
+			expected: time.Unix(1, 512345678),
+		},
+		{
+			name:     "2^-30 seconds",
+			resol:    0x80 | 30,
+			ts:       3<<30 | 1<<29,
+			expected: time.Unix(3, 500000000),
+		},
+		{
+			name:     "2^-63 seconds",
+			resol:    0x80 | 63,
+			ts:       3 << 62,
+			expected: time.Unix(1, 500000000),
+		},
+		{
+			name:    "10^-20 seconds",
+			resol:   20,
+			wantErr: true,
+		},
+		{
+			name:    "2^-64 seconds",
+			resol:   0xc0,
+			wantErr: true,
+		},
+	}
+
+	frame := udpPacket(net.IP{192, 0, 2, 1}, 6343, []byte("bar"))
+	for _, test := range tests {
+		r, err := NewReader(pcapNG(test.resol, test.ts, frame))
+		if err != nil {
+			t.Fatalf("NewReader failed: %v", err)
+		}
+
+		p, err := r.Next()
+		if test.wantErr {
+			assert.NotNil(t, err, test.name)
+			continue
+		}
+		if assert.Nil(t, err, test.name) {
+			assert.Equal(t, test.expected, p.Timestamp, test.name)
+		}
+	}
+}
+
+func TestReaderUnknownFormat(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7, 8}))
+	assert.NotNil(t, err)
+}
+
+func TestDecodeUDP(t *testing.T) {
+	assert := assert.New(t)
+
+	frame := udpPacket(net.IP{192, 0, 2, 1}, 4739, []byte("foo"))
+	d, err := DecodeUDP(LinkTypeEthernet, frame)
+	if err != nil {
+		t.Fatalf("DecodeUDP failed: %v", err)
+	}
+	assert.Equal(net.IP{192, 0, 2, 1}, d.SrcAddr)
+	assert.Equal(uint16(4739), d.DstPort)
+	assert.Equal([]byte("foo"), d.Payload)
+
+	// VLAN tagged
+	tagged := append([]byte{}, frame[:12]...)
+	tagged = append(tagged, 0x81, 0x00, 0x00, 0x0a)
+	tagged = append(tagged, frame[12:]...)
+	d, err = DecodeUDP(LinkTypeEthernet, tagged)
+	if err != nil {
+		t.Fatalf("DecodeUDP failed: %v", err)
+	}
+	assert.Equal([]byte("foo"), d.Payload)
+
+	// Raw IP with ethernet padding
+	raw := append(append([]byte{}, frame[sizeOfEthernet:]...), 0, 0, 0)
+	d, err = DecodeUDP(LinkTypeRaw, raw)
+	if err != nil {
+		t.Fatalf("DecodeUDP failed: %v", err)
+	}
+	assert.Equal([]byte("foo"), d.Payload)
+
+	// TCP
+	tcp := append([]byte{}, frame...)
+	tcp[sizeOfEthernet+9] = 6
+	_, err = DecodeUDP(LinkTypeEthernet, tcp)
+	assert.Equal(ErrNotUDP, err)
+
+	_, err = DecodeUDP(LinkTypeEthernet, frame[:20])
+	assert.NotNil(err)
+}
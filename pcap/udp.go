@@ -0,0 +1,168 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	etherTypeIPv4   = 0x0800
+	etherTypeIPv6   = 0x86dd
+	etherTypeVLAN   = 0x8100
+	etherTypeQinQ   = 0x88a8
+	protocolUDP     = 17
+	sizeOfEthernet  = 14
+	sizeOfLinuxSLL  = 16
+	sizeOfIPv4      = 20
+	sizeOfIPv6      = 40
+	sizeOfUDPHeader = 8
+)
+
+// ErrNotUDP is returned by DecodeUDP for packets that do not carry a UDP datagram
+var ErrNotUDP = fmt.Errorf("Not a UDP datagram")
+
+// Datagram is a UDP datagram extracted from a captured packet
+type Datagram struct {
+	SrcAddr net.IP
+	DstAddr net.IP
+	SrcPort uint16
+	DstPort uint16
+	Payload []byte
+}
+
+// DecodeUDP extracts the UDP datagram from packet `data` captured on a link of type `linkType`
+func DecodeUDP(linkType uint32, data []byte) (*Datagram, error) {
+	switch linkType {
+	case LinkTypeEthernet:
+		return decodeEthernet(data)
+	case LinkTypeLinuxSLL:
+		if len(data) < sizeOfLinuxSLL {
+			return nil, fmt.Errorf("Linux cooked header truncated")
+		}
+		return decodeEtherType(binary.BigEndian.Uint16(data[14:16]), data[sizeOfLinuxSLL:])
+	case LinkTypeNull:
+		if len(data) < 4 {
+			return nil, fmt.Errorf("Loopback header truncated")
+		}
+		return decodeIP(data[4:])
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		return decodeIP(data)
+	}
+
+	return nil, fmt.Errorf("Unsupported link type %d", linkType)
+}
+
+func decodeEthernet(data []byte) (*Datagram, error) {
+	if len(data) < sizeOfEthernet {
+		return nil, fmt.Errorf("Ethernet header truncated")
+	}
+
+	etherType := binary.BigEndian.Uint16(data[12:14])
+	data = data[sizeOfEthernet:]
+	for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("VLAN tag truncated")
+		}
+		etherType = binary.BigEndian.Uint16(data[2:4])
+		data = data[4:]
+	}
+
+	return decodeEtherType(etherType, data)
+}
+
+func decodeEtherType(etherType uint16, data []byte) (*Datagram, error) {
+	switch etherType {
+	case etherTypeIPv4, etherTypeIPv6:
+		return decodeIP(data)
+	}
+	return nil, ErrNotUDP
+}
+
+// decodeIP decodes an IPv4 or IPv6 packet depending on its version field
+func decodeIP(data []byte) (*Datagram, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("IP header truncated")
+	}
+
+	switch data[0] >> 4 {
+	case 4:
+		return decodeIPv4(data)
+	case 6:
+		return decodeIPv6(data)
+	}
+	return nil, fmt.Errorf("Unknown IP version %d", data[0]>>4)
+}
+
+func decodeIPv4(data []byte) (*Datagram, error) {
+	if len(data) < sizeOfIPv4 {
+		return nil, fmt.Errorf("IPv4 header truncated")
+	}
+
+	hdrLen := int(data[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(data[2:4]))
+	if hdrLen < sizeOfIPv4 || totalLen < hdrLen || len(data) < hdrLen {
+		return nil, fmt.Errorf("Invalid IPv4 header")
+	}
+
+	if data[9] != protocolUDP {
+		return nil, ErrNotUDP
+	}
+
+	// Flow export packets are reassembled by the kernel. We do not bother with fragments.
+	if binary.BigEndian.Uint16(data[6:8])&0x3fff != 0 {
+		return nil, fmt.Errorf("Fragmented IPv4 packet")
+	}
+
+	if totalLen < len(data) {
+		data = data[:totalLen]
+	}
+
+	d, err := decodeUDP(data[hdrLen:])
+	if err != nil {
+		return nil, err
+	}
+	d.SrcAddr = net.IP(data[12:16])
+	d.DstAddr = net.IP(data[16:20])
+	return d, nil
+}
+
+func decodeIPv6(data []byte) (*Datagram, error) {
+	if len(data) < sizeOfIPv6 {
+		return nil, fmt.Errorf("IPv6 header truncated")
+	}
+
+	if data[6] != protocolUDP {
+		return nil, ErrNotUDP
+	}
+
+	payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+	if sizeOfIPv6+payloadLen < len(data) {
+		data = data[:sizeOfIPv6+payloadLen]
+	}
+
+	d, err := decodeUDP(data[sizeOfIPv6:])
+	if err != nil {
+		return nil, err
+	}
+	d.SrcAddr = net.IP(data[8:24])
+	d.DstAddr = net.IP(data[24:40])
+	return d, nil
+}
+
+func decodeUDP(data []byte) (*Datagram, error) {
+	if len(data) < sizeOfUDPHeader {
+		return nil, fmt.Errorf("UDP header truncated")
+	}
+
+	length := int(binary.BigEndian.Uint16(data[4:6]))
+	if length < sizeOfUDPHeader || length > len(data) {
+		return nil, fmt.Errorf("UDP datagram truncated")
+	}
+
+	return &Datagram{
+		SrcPort: binary.BigEndian.Uint16(data[0:2]),
+		DstPort: binary.BigEndian.Uint16(data[2:4]),
+		Payload: data[sizeOfUDPHeader:length],
+	}, nil
+}
@@ -0,0 +1,72 @@
+// Package queue provides the bounded queues between the stages of the flow pipeline
+package queue
+
+import (
+	"sync/atomic"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/stats"
+)
+
+// Policies for full queues
+const (
+	// PolicyBlock waits for the next stage to catch up
+	PolicyBlock = "block"
+
+	// PolicyDrop drops flows
+	PolicyDrop = "drop"
+)
+
+// Queue is a bounded buffer of flows between two pipeline stages
+type Queue struct {
+	// C is read by the next stage
+	C chan *netflow.Flow
+
+	drop  bool
+	stats *stats.QueueStats
+}
+
+// New creates a queue of `size` flows for stage `stage`. Flows put into a full queue are
+// handled according to `policy`.
+func New(stage string, size int, policy string) *Queue {
+	q := &Queue{
+		C:    make(chan *netflow.Flow, size),
+		drop: policy == PolicyDrop,
+	}
+	q.stats = stats.NewQueueStats(stage, q.Len, size)
+	return q
+}
+
+// ForStage creates the queue of stage `stage` as configured in `cfg`
+func ForStage(cfg *config.Config, stage string) *Queue {
+	qc := cfg.Pipeline.Queue(stage)
+	return New(stage, qc.QueueSize, qc.Policy)
+}
+
+// Put passes `fl` to the next stage
+func (q *Queue) Put(fl *netflow.Flow) {
+	select {
+	case q.C <- fl:
+		return
+	default:
+	}
+
+	if q.drop {
+		atomic.AddUint64(&q.stats.Drops, 1)
+		return
+	}
+
+	atomic.AddUint64(&q.stats.Blocked, 1)
+	q.C <- fl
+}
+
+// Len returns the number of flows in the queue
+func (q *Queue) Len() int {
+	return len(q.C)
+}
+
+// Cap returns the capacity of the queue
+func (q *Queue) Cap() int {
+	return cap(q.C)
+}
@@ -0,0 +1,36 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrop(t *testing.T) {
+	q := New("drop", 2, PolicyDrop)
+	for i := 0; i < 5; i++ {
+		q.Put(&netflow.Flow{})
+	}
+
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, 2, q.Cap())
+	assert.Equal(t, uint64(3), q.stats.Drops)
+	assert.Equal(t, uint64(0), q.stats.Blocked)
+}
+
+func TestBlock(t *testing.T) {
+	q := New("block", 1, PolicyBlock)
+	q.Put(&netflow.Flow{})
+
+	done := make(chan struct{})
+	go func() {
+		q.Put(&netflow.Flow{})
+		close(done)
+	}()
+
+	<-q.C
+	<-done
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, uint64(0), q.stats.Drops)
+}
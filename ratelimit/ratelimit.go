@@ -0,0 +1,202 @@
+// Package ratelimit limits the rate of flows accepted from agents
+package ratelimit
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/agents"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/stats"
+)
+
+// Policies for flows exceeding the rate limit
+const (
+	// PolicyDrop drops flows exceeding the limit
+	PolicyDrop = "drop"
+
+	// PolicyDownsample drops flows exceeding the limit and compensates
+	// by raising the samplerate of the next accepted flow
+	PolicyDownsample = "downsample"
+)
+
+// idleTimeout is the minimum time buckets are kept after the last flow of their agent
+const idleTimeout = time.Minute
+
+// Limiter limits the rate of flows per agent using token buckets. A single Limiter is shared by all
+// collectors, so flows of an agent are limited regardless of the protocol they are received by.
+// Buckets of agents idle long enough to refill them are expired.
+type Limiter struct {
+	rate       float64
+	burst      float64
+	downsample bool
+	rates      map[string]float64
+	buckets    map[string]*bucket
+	registry   *agents.Registry
+	mu         sync.RWMutex
+	now        func() time.Time
+}
+
+// bucket is the token bucket of an agent
+type bucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	skipped uint64
+	stats   *stats.AgentStats
+	mu      sync.Mutex
+}
+
+// New creates a new Limiter. It returns nil if rate limiting is disabled.
+// Agents are named in statistics as known by `registry`.
+func New(cfg *config.Config, registry *agents.Registry) *Limiter {
+	if !cfg.RateLimit.Enabled {
+		return nil
+	}
+
+	l := &Limiter{
+		rate:       cfg.RateLimit.Rate,
+		burst:      cfg.RateLimit.Burst,
+		downsample: cfg.RateLimit.Policy == PolicyDownsample,
+		rates:      make(map[string]float64),
+		buckets:    make(map[string]*bucket),
+		registry:   registry,
+		now:        time.Now,
+	}
+
+	for _, a := range cfg.Agents {
+		if a.RateLimit == 0 {
+			continue
+		}
+		if ip := net.ParseIP(a.IPAddress); ip != nil {
+			l.rates[ip.String()] = a.RateLimit
+		}
+	}
+
+	go l.expire(idleTimeout)
+	return l
+}
+
+// Admit checks if flow `fl` of `agent` is within the agents rate limit. Flows exceeding the
+// limit are to be discarded. With the downsample policy the samplerate of the next admitted
+// flow is multiplied by the number of flows it represents.
+func (l *Limiter) Admit(agent net.IP, fl *netflow.Flow) bool {
+	if l == nil {
+		return true
+	}
+
+	b := l.getBucket(agent)
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := l.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		if l.downsample {
+			b.skipped++
+			atomic.AddUint64(&b.stats.DownsampledFlows, 1)
+			return false
+		}
+		atomic.AddUint64(&b.stats.ThrottledFlows, 1)
+		return false
+	}
+
+	b.tokens--
+	if b.skipped > 0 {
+		if fl.Samplerate == 0 {
+			fl.Samplerate = 1
+		}
+		fl.Samplerate *= b.skipped + 1
+		b.skipped = 0
+	}
+
+	return true
+}
+
+// getBucket returns the token bucket of `agent`. It returns nil if the agent is not limited.
+func (l *Limiter) getBucket(agent net.IP) *bucket {
+	key := agent.String()
+
+	rate := l.rate
+	if r, ok := l.rates[key]; ok {
+		rate = r
+	}
+	if rate <= 0 {
+		return nil
+	}
+
+	l.mu.RLock()
+	b, ok := l.buckets[key]
+	l.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		return b
+	}
+
+	burst := l.burst
+	if burst < rate {
+		burst = rate
+	}
+
+	name, ok := l.registry.Name(agent)
+	if !ok {
+		name = key
+	}
+
+	b = &bucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   l.now(),
+		stats:  stats.GetAgentStats(name),
+	}
+	l.buckets[key] = b
+	return b
+}
+
+// expire removes the buckets of agents idle for at least `interval`, checked every `interval`
+func (l *Limiter) expire(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.expireIdle(interval)
+	}
+}
+
+// expireIdle removes the buckets idle for at least `idle` and long enough to be refilled. Such
+// buckets do not differ from new ones.
+func (l *Limiter) expireIdle(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, b := range l.buckets {
+		b.mu.Lock()
+		elapsed := now.Sub(b.last)
+		full := b.tokens+elapsed.Seconds()*b.rate >= b.burst
+		if elapsed >= idle && full && b.skipped == 0 {
+			delete(l.buckets, key)
+		}
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/agents"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLimiter(t *testing.T, policy string) (*Limiter, *time.Time) {
+	cfg := &config.Config{
+		RateLimit: &config.RateLimit{
+			Enabled: true,
+			Rate:    10,
+			Policy:  policy,
+		},
+		Agents: []config.Agent{
+			{Name: policy + "01", IPAddress: "192.0.2.1"},
+			{Name: policy + "02", IPAddress: "192.0.2.2", RateLimit: 2},
+		},
+	}
+
+	registry, err := agents.New(cfg.Agents, nil)
+	if err != nil {
+		t.Fatalf("Unable to create registry: %v", err)
+	}
+
+	now := time.Unix(1500000000, 0)
+	l := New(cfg, registry)
+	l.now = func() time.Time {
+		return now
+	}
+	return l, &now
+}
+
+func TestDrop(t *testing.T) {
+	l, now := testLimiter(t, PolicyDrop)
+	agent := net.IP{192, 0, 2, 1}
+
+	admitted := 0
+	for i := 0; i < 20; i++ {
+		if l.Admit(agent, &netflow.Flow{Samplerate: 1}) {
+			admitted++
+		}
+	}
+	assert.Equal(t, 10, admitted)
+	assert.Equal(t, uint64(10), stats.GetAgentStats("drop01").ThrottledFlows)
+
+	// Tokens are refilled over time
+	*now = now.Add(500 * time.Millisecond)
+	admitted = 0
+	for i := 0; i < 20; i++ {
+		if l.Admit(agent, &netflow.Flow{Samplerate: 1}) {
+			admitted++
+		}
+	}
+	assert.Equal(t, 5, admitted)
+
+	// Per agent limit
+	admitted = 0
+	for i := 0; i < 20; i++ {
+		if l.Admit(net.IP{192, 0, 2, 2}, &netflow.Flow{}) {
+			admitted++
+		}
+	}
+	assert.Equal(t, 2, admitted)
+}
+
+func TestDownsample(t *testing.T) {
+	l, now := testLimiter(t, PolicyDownsample)
+	agent := net.IP{192, 0, 2, 2}
+
+	for i := 0; i < 2; i++ {
+		assert.True(t, l.Admit(agent, &netflow.Flow{Samplerate: 100}))
+	}
+	for i := 0; i < 3; i++ {
+		assert.False(t, l.Admit(agent, &netflow.Flow{Samplerate: 100}))
+	}
+	assert.Equal(t, uint64(3), stats.GetAgentStats("downsample02").DownsampledFlows)
+
+	// The next accepted flow accounts for the discarded ones
+	*now = now.Add(500 * time.Millisecond)
+	fl := &netflow.Flow{Samplerate: 100}
+	assert.True(t, l.Admit(agent, fl))
+	assert.Equal(t, uint64(400), fl.Samplerate)
+
+	*now = now.Add(500 * time.Millisecond)
+	fl = &netflow.Flow{Samplerate: 100}
+	assert.True(t, l.Admit(agent, fl))
+	assert.Equal(t, uint64(100), fl.Samplerate)
+}
+
+func TestUnlimitedAgent(t *testing.T) {
+	l := New(&config.Config{
+		RateLimit: &config.RateLimit{Enabled: true},
+		Agents: []config.Agent{
+			{Name: "limited01", IPAddress: "192.0.2.1", RateLimit: 1},
+		},
+	}, nil)
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.Admit(net.IP{192, 0, 2, 2}, &netflow.Flow{}))
+	}
+	assert.Equal(t, 0, len(l.buckets))
+}
+
+func TestDisabled(t *testing.T) {
+	l := New(&config.Config{RateLimit: &config.RateLimit{}}, nil)
+	assert.Nil(t, l)
+	assert.True(t, l.Admit(net.IP{192, 0, 2, 1}, &netflow.Flow{}))
+}
+
+func TestExpireIdle(t *testing.T) {
+	l, now := testLimiter(t, PolicyDrop)
+
+	for i := 0; i < 20; i++ {
+		l.Admit(net.IP{192, 0, 2, 1}, &netflow.Flow{})
+	}
+	l.Admit(net.IP{192, 0, 2, 2}, &netflow.Flow{})
+	assert.Equal(t, 2, len(l.buckets))
+
+	// Buckets of active agents are kept
+	*now = now.Add(30 * time.Second)
+	l.Admit(net.IP{192, 0, 2, 1}, &netflow.Flow{})
+	l.expireIdle(time.Minute)
+	assert.Equal(t, 2, len(l.buckets))
+
+	*now = now.Add(40 * time.Second)
+	l.expireIdle(time.Minute)
+	assert.Equal(t, 1, len(l.buckets))
+	assert.NotNil(t, l.buckets["192.0.2.1"])
+
+	*now = now.Add(30 * time.Second)
+	l.expireIdle(time.Minute)
+	assert.Equal(t, 0, len(l.buckets))
+}
@@ -0,0 +1,150 @@
+// Package rdns resolves addresses to the names of their PTR records in the background
+package rdns
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+)
+
+// Resolver resolves addresses to names and caches the results. Lookups never block:
+// addresses not cached are queued and resolved by a pool of workers.
+type Resolver struct {
+	lookupAddr  func(ctx context.Context, addr string) ([]string, error)
+	timeout     time.Duration
+	ttl         time.Duration
+	negativeTTL time.Duration
+	cacheSize   int
+	now         func() time.Time
+
+	queue chan string
+
+	// mu protects entries, lru and pending
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	pending map[string]struct{}
+}
+
+// entry is a cached result of a lookup. Failed lookups are cached with an empty name.
+type entry struct {
+	addr    string
+	name    string
+	expires time.Time
+}
+
+// New creates a resolver as configured in `cfg`
+func New(cfg *config.ReverseDNS) *Resolver {
+	resolver := net.DefaultResolver
+	if cfg.Resolver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, cfg.Resolver)
+			},
+		}
+	}
+
+	r := &Resolver{
+		lookupAddr:  resolver.LookupAddr,
+		timeout:     time.Duration(cfg.Timeout) * time.Millisecond,
+		ttl:         time.Duration(cfg.TTL) * time.Second,
+		negativeTTL: time.Duration(cfg.NegativeTTL) * time.Second,
+		cacheSize:   cfg.CacheSize,
+		now:         time.Now,
+		queue:       make(chan string, cfg.QueueSize),
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		pending:     make(map[string]struct{}),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		go r.worker()
+	}
+
+	return r
+}
+
+// Name returns the cached name of address `addr`. If the address is not cached a lookup is
+// queued unless the queue is full, in which case the address is tried again on the next call.
+func (r *Resolver) Name(addr string) (string, bool) {
+	if net.ParseIP(addr) == nil {
+		return "", false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if el, ok := r.entries[addr]; ok {
+		e := el.Value.(*entry)
+		if r.now().Before(e.expires) {
+			r.lru.MoveToFront(el)
+			return e.name, e.name != ""
+		}
+		r.lru.Remove(el)
+		delete(r.entries, addr)
+	}
+
+	if _, ok := r.pending[addr]; ok {
+		return "", false
+	}
+
+	select {
+	case r.queue <- addr:
+		r.pending[addr] = struct{}{}
+	default:
+	}
+
+	return "", false
+}
+
+// worker resolves queued addresses
+func (r *Resolver) worker() {
+	for addr := range r.queue {
+		name := r.resolve(addr)
+
+		r.mu.Lock()
+		delete(r.pending, addr)
+		r.add(addr, name)
+		r.mu.Unlock()
+	}
+}
+
+// resolve looks up the name of `addr`. It returns an empty name if there is none.
+func (r *Resolver) resolve(addr string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	names, err := r.lookupAddr(ctx, addr)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// add caches `name` of `addr` and evicts the least recently used entries exceeding the cache size
+func (r *Resolver) add(addr string, name string) {
+	ttl := r.ttl
+	if name == "" {
+		ttl = r.negativeTTL
+	}
+
+	r.entries[addr] = r.lru.PushFront(&entry{
+		addr:    addr,
+		name:    name,
+		expires: r.now().Add(ttl),
+	})
+
+	for r.lru.Len() > r.cacheSize {
+		el := r.lru.Back()
+		r.lru.Remove(el)
+		delete(r.entries, el.Value.(*entry).addr)
+	}
+}
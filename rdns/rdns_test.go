@@ -0,0 +1,178 @@
+package rdns
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeName encodes domain name `name` as sequence of labels
+func encodeName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// serveDNS answers PTR queries on `conn` with the names of `ptrs`. Other queries are answered with NXDOMAIN.
+func serveDNS(conn net.PacketConn, ptrs map[string]string) {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < 12 {
+			continue
+		}
+
+		// Question
+		end := 12
+		var labels []string
+		for end < n && buf[end] != 0 {
+			labels = append(labels, string(buf[end+1:end+1+int(buf[end])]))
+			end += int(buf[end]) + 1
+		}
+		end += 5
+		if end > n {
+			continue
+		}
+		question := buf[12:end]
+		qtype := binary.BigEndian.Uint16(buf[end-4:])
+
+		resp := []byte{buf[0], buf[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}
+		resp = append(resp, question...)
+
+		name, ok := ptrs[strings.Join(labels, ".")]
+		switch {
+		case ok && qtype == 12:
+			rdata := encodeName(name)
+			resp[7] = 1
+			resp = append(resp, 0xc0, 12, 0, 12, 0, 1, 0, 0, 0x0e, 0x10, byte(len(rdata)>>8), byte(len(rdata)))
+			resp = append(resp, rdata...)
+		case !ok:
+			resp[3] |= 3
+		}
+
+		conn.WriteTo(resp, addr)
+	}
+}
+
+// name waits for the name of `addr` to be resolved
+func name(t *testing.T, r *Resolver, addr string) string {
+	for i := 0; i < 100; i++ {
+		if name, ok := r.Name(addr); ok {
+			return name
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s not resolved", addr)
+	return ""
+}
+
+func TestResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go serveDNS(conn, map[string]string{
+		"1.2.0.192.in-addr.arpa": "host1.example.com.",
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa": "host6.example.com.",
+	})
+
+	r := New(&config.ReverseDNS{
+		Resolver:    conn.LocalAddr().String(),
+		CacheSize:   2,
+		TTL:         60,
+		NegativeTTL: 10,
+		Timeout:     1000,
+		Workers:     2,
+		QueueSize:   8,
+	})
+
+	// Lookups are queued
+	_, ok := r.Name("192.0.2.1")
+	assert.False(t, ok)
+
+	assert.Equal(t, "host1.example.com", name(t, r, "192.0.2.1"))
+	assert.Equal(t, "host6.example.com", name(t, r, "2001:db8::1"))
+
+	// Addresses without name are cached too
+	r.Name("192.0.2.2")
+	cached := func(addr string) bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		_, ok := r.entries[addr]
+		return ok
+	}
+	for i := 0; i < 100 && !cached("192.0.2.2"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, cached("192.0.2.2"))
+	assert.False(t, cached("192.0.2.1"), "least recently used entry is evicted")
+	assert.True(t, cached("2001:db8::1"))
+
+	_, ok = r.Name("192.0.2.2")
+	assert.False(t, ok)
+
+	_, ok = r.Name("<nil>")
+	assert.False(t, ok)
+}
+
+func TestResolverNeverBlocks(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	r := New(&config.ReverseDNS{
+		CacheSize: 16,
+		TTL:       60,
+		Timeout:   1000,
+		Workers:   1,
+		QueueSize: 1,
+	})
+	r.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		<-block
+		return []string{"slow.example.com."}, nil
+	}
+
+	start := time.Now()
+	for i := 1; i < 10; i++ {
+		_, ok := r.Name(net.IPv4(192, 0, 2, byte(i)).String())
+		assert.False(t, ok)
+	}
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestResolverExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := New(&config.ReverseDNS{CacheSize: 16, TTL: 60, NegativeTTL: 10})
+	r.now = func() time.Time { return now }
+
+	r.add("192.0.2.1", "host1.example.com")
+	r.add("192.0.2.2", "")
+
+	name, ok := r.Name("192.0.2.1")
+	assert.True(t, ok)
+	assert.Equal(t, "host1.example.com", name)
+
+	now = now.Add(30 * time.Second)
+	_, ok = r.Name("192.0.2.1")
+	assert.True(t, ok)
+	_, ok = r.Name("192.0.2.2")
+	assert.False(t, ok)
+	assert.Equal(t, 1, r.lru.Len(), "expired entries are removed")
+
+	now = now.Add(time.Minute)
+	_, ok = r.Name("192.0.2.1")
+	assert.False(t, ok)
+	assert.Equal(t, 0, r.lru.Len())
+}
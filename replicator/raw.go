@@ -0,0 +1,75 @@
+package replicator
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+const (
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	udpHeaderLen  = 8
+	protocolUDP   = 17
+	ttl           = 64
+)
+
+// udpPacket returns an IP packet carrying `payload` in a UDP datagram from `src` to `dst`.
+// Both addresses must be of the same address family.
+func udpPacket(src *net.UDPAddr, dst *net.UDPAddr, payload []byte) []byte {
+	udpLen := udpHeaderLen + len(payload)
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+
+	var pkt []byte
+	if srcIP != nil && dstIP != nil {
+		pkt = make([]byte, ipv4HeaderLen+udpLen)
+		pkt[0] = 0x45
+		binary.BigEndian.PutUint16(pkt[2:4], uint16(len(pkt)))
+		pkt[8] = ttl
+		pkt[9] = protocolUDP
+		copy(pkt[12:16], srcIP)
+		copy(pkt[16:20], dstIP)
+		binary.BigEndian.PutUint16(pkt[10:12], ^checksum(0, pkt[:ipv4HeaderLen]))
+	} else {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+		pkt = make([]byte, ipv6HeaderLen+udpLen)
+		pkt[0] = 0x60
+		binary.BigEndian.PutUint16(pkt[4:6], uint16(udpLen))
+		pkt[6] = protocolUDP
+		pkt[7] = ttl
+		copy(pkt[8:24], srcIP)
+		copy(pkt[24:40], dstIP)
+	}
+
+	udp := pkt[len(pkt)-udpLen:]
+	binary.BigEndian.PutUint16(udp[0:2], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpLen))
+	copy(udp[udpHeaderLen:], payload)
+
+	// The checksum covers a pseudo header of the addresses, protocol and length
+	sum := checksum(0, srcIP)
+	sum = checksum(sum, dstIP)
+	sum = checksum(sum, []byte{0, protocolUDP, byte(udpLen >> 8), byte(udpLen)})
+	csum := ^checksum(sum, udp)
+	if csum == 0 {
+		csum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:8], csum)
+
+	return pkt
+}
+
+// checksum adds `b` to the ones' complement sum `sum`. An odd length `b` is padded with zero.
+func checksum(sum uint16, b []byte) uint16 {
+	s := uint32(sum)
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+	return uint16(s)
+}
@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package replicator
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// rawConn sends UDP datagrams with arbitrary source addresses to a target
+type rawConn struct {
+	fd  int
+	dst *net.UDPAddr
+	sa  unix.Sockaddr
+}
+
+// newRawConn opens a raw socket to send datagrams to `dst`. IPPROTO_RAW sockets expect packets
+// including their IP header.
+func newRawConn(dst *net.UDPAddr) (*rawConn, error) {
+	family := unix.AF_INET6
+	var sa unix.Sockaddr
+	if ip := dst.IP.To4(); ip != nil {
+		family = unix.AF_INET
+		sa4 := &unix.SockaddrInet4{}
+		copy(sa4.Addr[:], ip)
+		sa = sa4
+	} else {
+		sa6 := &unix.SockaddrInet6{}
+		copy(sa6.Addr[:], dst.IP.To16())
+		sa = sa6
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_RAW, unix.IPPROTO_RAW)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawConn{
+		fd:  fd,
+		dst: dst,
+		sa:  sa,
+	}, nil
+}
+
+// supports checks if datagrams from `src` can be sent, i.e. `src` is of the address family of the target
+func (c *rawConn) supports(src *net.UDPAddr) bool {
+	return src != nil && (src.IP.To4() != nil) == (c.dst.IP.To4() != nil)
+}
+
+// write sends `data` from `src` to the target
+func (c *rawConn) write(src *net.UDPAddr, data []byte) error {
+	return unix.Sendto(c.fd, udpPacket(src, c.dst, data), 0, c.sa)
+}
+
+func (c *rawConn) close() {
+	unix.Close(c.fd)
+}
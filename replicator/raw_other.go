@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package replicator
+
+import (
+	"fmt"
+	"net"
+)
+
+// rawConn is a stub as sending datagrams with the source address of their agent is only supported on Linux
+type rawConn struct{}
+
+// newRawConn refuses to preserve source addresses as it is only supported on Linux
+func newRawConn(dst *net.UDPAddr) (*rawConn, error) {
+	return nil, fmt.Errorf("preserve_source is only supported on Linux")
+}
+
+func (c *rawConn) supports(src *net.UDPAddr) bool {
+	return false
+}
+
+func (c *rawConn) write(src *net.UDPAddr, data []byte) error {
+	return fmt.Errorf("preserve_source is only supported on Linux")
+}
+
+func (c *rawConn) close() {}
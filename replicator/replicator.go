@@ -0,0 +1,203 @@
+// Package replicator copies received flow datagrams to downstream collectors
+package replicator
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Replicator copies datagrams to a set of UDP targets
+type Replicator struct {
+	targets []*target
+	wg      sync.WaitGroup
+}
+
+// target is a downstream collector
+type target struct {
+	name string
+	conn *net.UDPConn
+
+	// raw sends datagrams with the address of their agent as source if preserve_source is enabled
+	raw *rawConn
+
+	queue     chan datagram
+	protocols map[string]struct{}
+	agents    map[string]struct{}
+	stats     *stats.ReplicationStats
+	debug     int
+}
+
+// New creates a new Replicator and starts a sender for every replication target in `cfg`
+func New(cfg *config.Config) (*Replicator, error) {
+	r := &Replicator{}
+
+	for _, repl := range cfg.Replication {
+		t, err := newTarget(repl, cfg.Agents, cfg.Debug)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.targets = append(r.targets, t)
+	}
+
+	r.wg.Add(len(r.targets))
+	for _, t := range r.targets {
+		go func(t *target) {
+			t.send()
+			r.wg.Done()
+		}(t)
+	}
+
+	return r, nil
+}
+
+// datagram is a datagram received from `src`
+type datagram struct {
+	src  *net.UDPAddr
+	data []byte
+}
+
+func newTarget(repl config.Replication, agents []config.Agent, debug int) (*target, error) {
+	addr, err := net.ResolveUDPAddr("udp", repl.Address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to resolve replication target %s", repl.Name)
+	}
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to connect to replication target %s", repl.Name)
+	}
+
+	t := &target{
+		name:  repl.Name,
+		conn:  conn,
+		queue: make(chan datagram, repl.QueueSize),
+		stats: stats.NewReplicationStats(repl.Name),
+		debug: debug,
+	}
+
+	if repl.PreserveSource {
+		t.raw, err = newRawConn(addr)
+		if err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "Unable to open raw socket for replication target %s", repl.Name)
+		}
+	}
+
+	if len(repl.Protocols) > 0 {
+		t.protocols = make(map[string]struct{})
+		for _, p := range repl.Protocols {
+			t.protocols[p] = struct{}{}
+		}
+	}
+
+	if len(repl.Agents) > 0 {
+		t.agents = make(map[string]struct{})
+		for _, a := range repl.Agents {
+			t.agents[agentAddress(a, agents)] = struct{}{}
+		}
+	}
+
+	return t, nil
+}
+
+// agentAddress returns the IP address of the agent named `name`. If there is none `name` is returned.
+func agentAddress(name string, agents []config.Agent) string {
+	for _, a := range agents {
+		if a.Name == name {
+			return net.ParseIP(a.IPAddress).String()
+		}
+	}
+
+	if ip := net.ParseIP(name); ip != nil {
+		return ip.String()
+	}
+	return name
+}
+
+// Replicate queues datagram `buffer` received by collector `protocol` from `src` for all
+// matching targets. It never blocks. If the queue of a target is full the datagram is dropped for it.
+func (r *Replicator) Replicate(protocol string, src *net.UDPAddr, buffer []byte) {
+	if r == nil || len(r.targets) == 0 {
+		return
+	}
+
+	// Collectors reuse and modify their buffers so we need our own copy
+	var data []byte
+	agentAddr := src.IP.String()
+	for _, t := range r.targets {
+		if !t.matches(protocol, agentAddr) {
+			continue
+		}
+
+		if data == nil {
+			data = make([]byte, len(buffer))
+			copy(data, buffer)
+		}
+
+		select {
+		case t.queue <- datagram{src: src, data: data}:
+		default:
+			atomic.AddUint64(&t.stats.Drops, 1)
+		}
+	}
+}
+
+// Close stops all senders and closes their sockets once the queued datagrams have been sent
+func (r *Replicator) Close() {
+	for _, t := range r.targets {
+		close(t.queue)
+	}
+	r.wg.Wait()
+}
+
+func (t *target) matches(protocol string, agent string) bool {
+	if t.protocols != nil {
+		if _, ok := t.protocols[protocol]; !ok {
+			return false
+		}
+	}
+
+	if t.agents != nil {
+		if _, ok := t.agents[agent]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// send sends queued datagrams to the target until the queue is closed. With a raw socket
+// datagrams are sent from the address they were received from, unless its address family
+// differs from the one of the target.
+func (t *target) send() {
+	defer t.conn.Close()
+	if t.raw != nil {
+		defer t.raw.close()
+	}
+
+	for dg := range t.queue {
+		var err error
+		if t.raw != nil && t.raw.supports(dg.src) {
+			err = t.raw.write(dg.src, dg.data)
+		} else {
+			_, err = t.conn.Write(dg.data)
+		}
+		if err != nil {
+			atomic.AddUint64(&t.stats.Errors, 1)
+			if t.debug > 0 {
+				glog.Warningf("Unable to replicate datagram to %s: %v", t.name, err)
+			}
+			continue
+		}
+
+		atomic.AddUint64(&t.stats.Packets, 1)
+		atomic.AddUint64(&t.stats.Bytes, uint64(len(dg.data)))
+	}
+}
@@ -0,0 +1,192 @@
+package replicator
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	return conn
+}
+
+func read(conn *net.UDPConn) string {
+	buffer := make([]byte, 100)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFromUDP(buffer)
+	if err != nil {
+		return ""
+	}
+	return string(buffer[:n])
+}
+
+func TestReplicate(t *testing.T) {
+	assert := assert.New(t)
+
+	all := listen(t)
+	defer all.Close()
+	filtered := listen(t)
+	defer filtered.Close()
+
+	r, err := New(&config.Config{
+		Agents: []config.Agent{
+			{Name: "rtr01", IPAddress: "192.0.2.1"},
+		},
+		Replication: []config.Replication{
+			{
+				Name:      "all",
+				Address:   all.LocalAddr().String(),
+				QueueSize: 10,
+			},
+			{
+				Name:      "filtered",
+				Address:   filtered.LocalAddr().String(),
+				Protocols: []string{"sflow"},
+				Agents:    []string{"rtr01"},
+				QueueSize: 10,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	buffer := []byte("foo")
+	r.Replicate("netflow_v9", &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 2055}, buffer)
+	r.Replicate("sflow", &net.UDPAddr{IP: net.IP{192, 0, 2, 2}, Port: 2055}, []byte("bar"))
+
+	// Collectors modify their buffers after replication
+	r.Replicate("sflow", &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 2055}, buffer)
+	buffer[0] = 'x'
+
+	assert.Equal("foo", read(all))
+	assert.Equal("bar", read(all))
+	assert.Equal("foo", read(all))
+	assert.Equal("foo", read(filtered))
+
+	r.Close()
+	assert.Equal(uint64(3), r.targets[0].stats.Packets)
+	assert.Equal(uint64(9), r.targets[0].stats.Bytes)
+	assert.Equal(uint64(1), r.targets[1].stats.Packets)
+}
+
+func TestReplicateNonBlocking(t *testing.T) {
+	r := &Replicator{
+		targets: []*target{
+			{
+				name:  "slow",
+				queue: make(chan datagram, 1),
+				stats: stats.NewReplicationStats("slow"),
+			},
+		},
+	}
+
+	r.Replicate("ipfix", &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 2055}, []byte("foo"))
+	r.Replicate("ipfix", &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 2055}, []byte("bar"))
+	r.Replicate("ipfix", &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 2055}, []byte("baz"))
+
+	assert.Equal(t, uint64(2), r.targets[0].stats.Drops)
+	assert.Equal(t, "foo", string((<-r.targets[0].queue).data))
+}
+
+func TestReplicateNil(t *testing.T) {
+	var r *Replicator
+	r.Replicate("ipfix", &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 2055}, []byte("foo"))
+}
+
+func TestUDPPacket(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       *net.UDPAddr
+		dst       *net.UDPAddr
+		headerLen int
+	}{
+		{
+			name:      "IPv4",
+			src:       &net.UDPAddr{IP: net.IP{192, 0, 2, 1}, Port: 50000},
+			dst:       &net.UDPAddr{IP: net.IP{198, 51, 100, 1}, Port: 2055},
+			headerLen: ipv4HeaderLen,
+		},
+		{
+			name:      "IPv6",
+			src:       &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000},
+			dst:       &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2055},
+			headerLen: ipv6HeaderLen,
+		},
+	}
+
+	for _, test := range tests {
+		pkt := udpPacket(test.src, test.dst, []byte("foo"))
+		if !assert.Equal(t, test.headerLen+udpHeaderLen+3, len(pkt), test.name) {
+			continue
+		}
+		udp := pkt[test.headerLen:]
+		assert.Equal(t, []byte{0xc3, 0x50, 0x08, 0x07, 0, 11}, udp[:6], test.name)
+		assert.Equal(t, "foo", string(udp[udpHeaderLen:]), test.name)
+
+		// The checksums of valid headers and datagrams are 0xffff
+		if test.headerLen == ipv4HeaderLen {
+			assert.Equal(t, uint16(0xffff), checksum(0, pkt[:ipv4HeaderLen]), test.name)
+		}
+		sum := checksum(0, udpPacketAddrs(test.src.IP))
+		sum = checksum(sum, udpPacketAddrs(test.dst.IP))
+		sum = checksum(sum, []byte{0, protocolUDP, 0, 11})
+		assert.Equal(t, uint16(0xffff), checksum(sum, udp), test.name)
+	}
+}
+
+// udpPacketAddrs returns `ip` in the length used in packets of its address family
+func udpPacketAddrs(ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func TestReplicatePreserveSource(t *testing.T) {
+	conn := listen(t)
+	defer conn.Close()
+
+	r, err := New(&config.Config{
+		Replication: []config.Replication{
+			{
+				Name:           "preserved",
+				Address:        conn.LocalAddr().String(),
+				QueueSize:      10,
+				PreserveSource: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Skipf("Raw sockets are not available: %v", err)
+	}
+	defer r.Close()
+
+	r.Replicate("ipfix", &net.UDPAddr{IP: net.IP{127, 0, 0, 2}, Port: 50000}, []byte("foo"))
+	r.Replicate("ipfix", &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000}, []byte("bar"))
+
+	buffer := make([]byte, 100)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, src, err := conn.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	assert.Equal(t, "foo", string(buffer[:n]))
+	assert.Equal(t, "127.0.0.2:50000", src.String())
+
+	// Datagrams of agents of the other address family are sent from our address
+	n, src, err = conn.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	assert.Equal(t, "bar", string(buffer[:n]))
+	assert.Equal(t, "127.0.0.1", src.IP.String())
+}
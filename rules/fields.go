@@ -0,0 +1,72 @@
+package rules
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/pkg/errors"
+)
+
+// setFunc assigns a value to a field of flow `fl`
+type setFunc func(fl *netflow.Flow)
+
+// setters maps the names of fields that can be set to functions parsing the value to assign
+var setters = map[string]func(val string) (setFunc, error){
+	"SrcAddr":    addrSetter(func(fl *netflow.Flow, ip []byte) { fl.SrcAddr = ip }),
+	"DstAddr":    addrSetter(func(fl *netflow.Flow, ip []byte) { fl.DstAddr = ip }),
+	"NextHop":    addrSetter(func(fl *netflow.Flow, ip []byte) { fl.NextHop = ip }),
+	"Protocol":   uint32Setter(8, func(fl *netflow.Flow, v uint32) { fl.Protocol = v }),
+	"IntIn":      uint32Setter(32, func(fl *netflow.Flow, v uint32) { fl.IntIn = v }),
+	"IntOut":     uint32Setter(32, func(fl *netflow.Flow, v uint32) { fl.IntOut = v }),
+	"SrcAsn":     uint32Setter(32, func(fl *netflow.Flow, v uint32) { fl.SrcAs = v }),
+	"DstAsn":     uint32Setter(32, func(fl *netflow.Flow, v uint32) { fl.DstAs = v }),
+	"NextHopAsn": uint32Setter(32, func(fl *netflow.Flow, v uint32) { fl.NextHopAs = v }),
+	"SrcPort":    uint32Setter(16, func(fl *netflow.Flow, v uint32) { fl.SrcPort = v }),
+	"DstPort":    uint32Setter(16, func(fl *netflow.Flow, v uint32) { fl.DstPort = v }),
+	"Samplerate": uint32Setter(32, func(fl *netflow.Flow, v uint32) { fl.Samplerate = uint64(v) }),
+}
+
+// getSetFunc returns a function assigning `val` to field `field`
+func getSetFunc(field string, val string) (setFunc, error) {
+	s, ok := setters[field]
+	if !ok {
+		return nil, fmt.Errorf("Unknown field: %s", field)
+	}
+
+	f, err := s(val)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid value for field %s", field)
+	}
+	return f, nil
+}
+
+func addrSetter(set func(fl *netflow.Flow, ip []byte)) func(val string) (setFunc, error) {
+	return func(val string) (setFunc, error) {
+		ip := net.ParseIP(val)
+		if ip == nil {
+			return nil, fmt.Errorf("Unable to parse IP address %s", val)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+
+		return func(fl *netflow.Flow) {
+			set(fl, ip)
+		}, nil
+	}
+}
+
+func uint32Setter(bits int, set func(fl *netflow.Flow, v uint32)) func(val string) (setFunc, error) {
+	return func(val string) (setFunc, error) {
+		v, err := strconv.ParseUint(val, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(fl *netflow.Flow) {
+			set(fl, uint32(v))
+		}, nil
+	}
+}
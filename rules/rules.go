@@ -0,0 +1,303 @@
+// Package rules filters and rewrites annotated flows before they are stored
+package rules
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/bio-routing/tflow2/agents"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/pkg/errors"
+)
+
+// Actions of rules
+const (
+	// ActionDrop drops matching flows
+	ActionDrop = "drop"
+
+	// ActionKeep keeps matching flows without evaluating further rules
+	ActionKeep = "keep"
+
+	// ActionSet assigns values to fields of matching flows
+	ActionSet = "set"
+
+	// ActionTag sets the source and/or destination tag of matching flows
+	ActionTag = "tag"
+)
+
+// Sides of flows tagged by ActionTag
+const (
+	TagSideSrc  = "src"
+	TagSideDst  = "dst"
+	TagSideBoth = "both"
+)
+
+// Engine applies rules to flows in the order they are configured
+type Engine struct {
+	rules    []*rule
+	registry *agents.Registry
+}
+
+// rule is a parsed rule
+type rule struct {
+	name   string
+	match  []matchFunc
+	action string
+	set    []setFunc
+	tag    string
+	src    bool
+	dst    bool
+	stats  *stats.RuleStats
+}
+
+// matchFunc checks a condition of a rule
+type matchFunc func(fl *netflow.Flow) bool
+
+// New creates a new Engine. It returns nil if no rules are configured.
+// Agents are matched by name as known by `registry`.
+func New(cfg []config.Rule, registry *agents.Registry) (*Engine, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+
+	e := &Engine{
+		rules:    make([]*rule, 0, len(cfg)),
+		registry: registry,
+	}
+
+	names := make(map[string]struct{})
+	for i, rc := range cfg {
+		name := rc.Name
+		if name == "" {
+			name = fmt.Sprintf("rule%d", i+1)
+		}
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("Duplicate rule name: %s", name)
+		}
+		names[name] = struct{}{}
+
+		r, err := e.newRule(name, rc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid rule %s", name)
+		}
+		e.rules = append(e.rules, r)
+	}
+
+	return e, nil
+}
+
+func (e *Engine) newRule(name string, rc config.Rule) (*rule, error) {
+	r := &rule{
+		name:   name,
+		action: rc.Action,
+		tag:    rc.Tag,
+	}
+
+	switch rc.Action {
+	case ActionDrop, ActionKeep:
+	case ActionSet:
+		if len(rc.Set) == 0 {
+			return nil, fmt.Errorf("No fields to set")
+		}
+		for field, val := range rc.Set {
+			f, err := getSetFunc(field, val)
+			if err != nil {
+				return nil, err
+			}
+			r.set = append(r.set, f)
+		}
+	case ActionTag:
+		if rc.Tag == "" {
+			return nil, fmt.Errorf("No tag given")
+		}
+		switch rc.TagSide {
+		case TagSideSrc:
+			r.src = true
+		case TagSideDst:
+			r.dst = true
+		case TagSideBoth, "":
+			r.src, r.dst = true, true
+		default:
+			return nil, fmt.Errorf("Unknown tag side: %s", rc.TagSide)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown action: %s", rc.Action)
+	}
+
+	match, err := e.matchFuncs(rc.Match)
+	if err != nil {
+		return nil, err
+	}
+	r.match = match
+	r.stats = stats.NewRuleStats(name)
+
+	return r, nil
+}
+
+func (e *Engine) matchFuncs(m config.RuleMatch) ([]matchFunc, error) {
+	funcs := make([]matchFunc, 0)
+
+	if len(m.Agents) > 0 {
+		funcs = append(funcs, e.agentMatch(m.Agents))
+	}
+
+	for _, p := range []struct {
+		prefixes []string
+		addr     func(fl *netflow.Flow) []byte
+	}{
+		{m.SrcPrefixes, (*netflow.Flow).GetSrcAddr},
+		{m.DstPrefixes, (*netflow.Flow).GetDstAddr},
+	} {
+		if len(p.prefixes) == 0 {
+			continue
+		}
+		f, err := prefixMatch(p.prefixes, p.addr)
+		if err != nil {
+			return nil, err
+		}
+		funcs = append(funcs, f)
+	}
+
+	for _, u := range []struct {
+		values []uint32
+		field  func(fl *netflow.Flow) uint32
+	}{
+		{m.Protocols, (*netflow.Flow).GetProtocol},
+		{m.SrcPorts, (*netflow.Flow).GetSrcPort},
+		{m.DstPorts, (*netflow.Flow).GetDstPort},
+		{m.IntIn, (*netflow.Flow).GetIntIn},
+		{m.IntOut, (*netflow.Flow).GetIntOut},
+	} {
+		if len(u.values) > 0 {
+			funcs = append(funcs, uint32Match(u.values, u.field))
+		}
+	}
+
+	if len(m.Interfaces) > 0 {
+		in := uint32Match(m.Interfaces, (*netflow.Flow).GetIntIn)
+		out := uint32Match(m.Interfaces, (*netflow.Flow).GetIntOut)
+		funcs = append(funcs, func(fl *netflow.Flow) bool {
+			return in(fl) || out(fl)
+		})
+	}
+
+	return funcs, nil
+}
+
+// agentMatch matches flows of agents by name or IP address
+func (e *Engine) agentMatch(agents []string) matchFunc {
+	set := make(map[string]struct{}, len(agents))
+	for _, a := range agents {
+		if ip := net.ParseIP(a); ip != nil {
+			a = ip.String()
+		}
+		set[a] = struct{}{}
+	}
+
+	return func(fl *netflow.Flow) bool {
+		ip := net.IP(fl.Router)
+		if _, ok := set[ip.String()]; ok {
+			return true
+		}
+		name, ok := e.registry.Name(ip)
+		if !ok {
+			return false
+		}
+		_, ok = set[name]
+		return ok
+	}
+}
+
+func prefixMatch(prefixes []string, addr func(fl *netflow.Flow) []byte) (matchFunc, error) {
+	nets := make([]*net.IPNet, 0, len(prefixes))
+	for _, p := range prefixes {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to parse prefix %s", p)
+		}
+		nets = append(nets, n)
+	}
+
+	return func(fl *netflow.Flow) bool {
+		ip := net.IP(addr(fl))
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func uint32Match(values []uint32, field func(fl *netflow.Flow) uint32) matchFunc {
+	set := make(map[uint32]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+
+	return func(fl *netflow.Flow) bool {
+		_, ok := set[field(fl)]
+		return ok
+	}
+}
+
+// Apply applies the rules to `fl`. It returns false if the flow is to be dropped.
+func (e *Engine) Apply(fl *netflow.Flow) bool {
+	if e == nil {
+		return true
+	}
+
+	for _, r := range e.rules {
+		if !r.matches(fl) {
+			continue
+		}
+		atomic.AddUint64(&r.stats.Hits, 1)
+
+		switch r.action {
+		case ActionDrop:
+			return false
+		case ActionKeep:
+			return true
+		case ActionSet:
+			for _, f := range r.set {
+				f(fl)
+			}
+		case ActionTag:
+			if r.src {
+				fl.SrcTag = r.tag
+			}
+			if r.dst {
+				fl.DstTag = r.tag
+			}
+		}
+	}
+
+	return true
+}
+
+func (r *rule) matches(fl *netflow.Flow) bool {
+	for _, m := range r.match {
+		if !m(fl) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter starts `workers` workers applying the rules to flows from `in` and passing
+// the flows that are not dropped on to `next`
+func (e *Engine) Filter(in *queue.Queue, next *queue.Queue, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for fl := range in.C {
+				if e.Apply(fl) {
+					next.Put(fl)
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,188 @@
+package rules
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/agents"
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEngine(t *testing.T, cfg []config.Rule) *Engine {
+	registry, err := agents.New([]config.Agent{
+		{Name: "rtr01", IPAddress: "192.0.2.1"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unable to create registry: %v", err)
+	}
+
+	e, err := New(cfg, registry)
+	if err != nil {
+		t.Fatalf("Unable to create rules: %v", err)
+	}
+	return e
+}
+
+func TestApply(t *testing.T) {
+	e := testEngine(t, []config.Rule{
+		{
+			Name:   "keep-rtr02",
+			Match:  config.RuleMatch{Agents: []string{"192.0.2.2"}},
+			Action: ActionKeep,
+		},
+		{
+			Name: "monitoring",
+			Match: config.RuleMatch{
+				DstPrefixes: []string{"203.0.113.0/28"},
+			},
+			Action: ActionDrop,
+		},
+		{
+			Name: "mgmt",
+			Match: config.RuleMatch{
+				Agents:     []string{"rtr01"},
+				Interfaces: []uint32{42},
+			},
+			Action: ActionDrop,
+		},
+		{
+			Name: "https",
+			Match: config.RuleMatch{
+				SrcPrefixes: []string{"198.51.100.0/24", "2001:db8::/32"},
+				Protocols:   []uint32{6},
+				DstPorts:    []uint32{443},
+			},
+			Action: ActionTag,
+			Tag:    "https",
+		},
+		{
+			Name: "normalise",
+			Match: config.RuleMatch{
+				SrcPrefixes: []string{"198.51.100.0/24"},
+			},
+			Action: ActionSet,
+			Set: map[string]string{
+				"SrcAsn":  "64512",
+				"NextHop": "192.0.2.254",
+			},
+		},
+		{
+			Name:    "again",
+			Action:  ActionTag,
+			Tag:     "web",
+			TagSide: TagSideDst,
+		},
+	})
+
+	rtr01 := []byte{192, 0, 2, 1}
+	rtr02 := []byte{192, 0, 2, 2}
+
+	tests := []struct {
+		name     string
+		flow     *netflow.Flow
+		keep     bool
+		expected *netflow.Flow
+	}{
+		{
+			name: "Dropped by prefix",
+			flow: &netflow.Flow{Router: rtr01, DstAddr: []byte{203, 0, 113, 1}},
+			keep: false,
+		},
+		{
+			name:     "Kept before drop",
+			flow:     &netflow.Flow{Router: rtr02, DstAddr: []byte{203, 0, 113, 1}},
+			keep:     true,
+			expected: &netflow.Flow{Router: rtr02, DstAddr: []byte{203, 0, 113, 1}},
+		},
+		{
+			name: "Dropped by agent and interface",
+			flow: &netflow.Flow{Router: rtr01, IntOut: 42},
+			keep: false,
+		},
+		{
+			name:     "Interface of other agent",
+			flow:     &netflow.Flow{Router: []byte{192, 0, 2, 3}, IntIn: 42},
+			keep:     true,
+			expected: &netflow.Flow{Router: []byte{192, 0, 2, 3}, IntIn: 42, DstTag: "web"},
+		},
+		{
+			name: "Tagged and rewritten",
+			flow: &netflow.Flow{Router: rtr01, SrcAddr: []byte{198, 51, 100, 1}, Protocol: 6, DstPort: 443},
+			keep: true,
+			expected: &netflow.Flow{
+				Router:   rtr01,
+				SrcAddr:  []byte{198, 51, 100, 1},
+				Protocol: 6,
+				DstPort:  443,
+				SrcAs:    64512,
+				NextHop:  []byte{192, 0, 2, 254},
+				SrcTag:   "https",
+				DstTag:   "web",
+			},
+		},
+		{
+			name: "IPv6",
+			flow: &netflow.Flow{Router: rtr01, SrcAddr: net.ParseIP("2001:db8::1"), Protocol: 6, DstPort: 443},
+			keep: true,
+			expected: &netflow.Flow{
+				Router:   rtr01,
+				SrcAddr:  net.ParseIP("2001:db8::1"),
+				Protocol: 6,
+				DstPort:  443,
+				SrcTag:   "https",
+				DstTag:   "web",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		keep := e.Apply(test.flow)
+		assert.Equalf(t, test.keep, keep, "Test %q", test.name)
+		if test.keep {
+			assert.Equalf(t, test.expected, test.flow, "Test %q", test.name)
+		}
+	}
+
+	hits := make(map[string]uint64)
+	for _, r := range e.rules {
+		hits[r.name] = r.stats.Hits
+	}
+	assert.Equal(t, map[string]uint64{
+		"keep-rtr02": 1,
+		"monitoring": 1,
+		"mgmt":       1,
+		"https":      2,
+		"normalise":  1,
+		"again":      3,
+	}, hits)
+}
+
+func TestInvalidRules(t *testing.T) {
+	tests := []config.Rule{
+		{Action: "reject"},
+		{Action: ActionTag},
+		{Action: ActionTag, Tag: "a", TagSide: "left"},
+		{Action: ActionSet},
+		{Action: ActionSet, Set: map[string]string{"Foo": "1"}},
+		{Action: ActionSet, Set: map[string]string{"SrcPort": "65536"}},
+		{Action: ActionSet, Set: map[string]string{"SrcAddr": "foo"}},
+		{Action: ActionDrop, Match: config.RuleMatch{SrcPrefixes: []string{"192.0.2.0/33"}}},
+	}
+
+	for _, test := range tests {
+		_, err := New([]config.Rule{test}, nil)
+		assert.NotNilf(t, err, "Rule %v", test)
+	}
+
+	_, err := New([]config.Rule{{Name: "a", Action: ActionDrop}, {Name: "a", Action: ActionDrop}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestNoRules(t *testing.T) {
+	e, err := New(nil, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, e)
+	assert.True(t, e.Apply(&netflow.Flow{}))
+}
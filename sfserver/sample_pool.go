@@ -0,0 +1,85 @@
+// Copyright 2017 EXARING AG. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sfserver
+
+import (
+	"sync"
+
+	"github.com/bio-routing/tflow2/sflow"
+)
+
+// samplePoolKey identifies a data source of an agent
+type samplePoolKey struct {
+	agent    string
+	sourceID uint32
+}
+
+// samplePoolState is the state of a data source as seen in the last flow sample
+type samplePoolState struct {
+	seq     uint32
+	pool    uint32
+	dropped uint32
+}
+
+// samplePoolTracker keeps track of sample pools and drop counters of data sources in order
+// to calculate the effective sampling rate as described in the sFlow v5 specification
+type samplePoolTracker struct {
+	sources map[samplePoolKey]samplePoolState
+	lock    sync.Mutex
+}
+
+// newSamplePoolTracker creates and initializes a new `samplePoolTracker` instance
+func newSamplePoolTracker() *samplePoolTracker {
+	return &samplePoolTracker{sources: make(map[samplePoolKey]samplePoolState)}
+}
+
+// update processes flow sample header `fsh` of `agent` and returns the effective
+// sampling rate of the sample and the number of samples that were dropped by the
+// agent since the previous sample of the same data source. The effective rate is the
+// sample pool delta divided by the sequence number delta. If there is no previous
+// sample or the counters went backwards the configured sampling rate is returned.
+func (t *samplePoolTracker) update(agent string, fsh *sflow.FlowSampleHeader) (rate uint64, dropped uint64) {
+	key := samplePoolKey{agent: agent, sourceID: fsh.SourceIDClassIndex}
+	cur := samplePoolState{
+		seq:     fsh.SequenceNumber,
+		pool:    fsh.SamplePool,
+		dropped: fsh.DroppedPackets,
+	}
+
+	t.lock.Lock()
+	prev, ok := t.sources[key]
+	t.sources[key] = cur
+	t.lock.Unlock()
+
+	rate = uint64(fsh.SamplingRate)
+	if !ok {
+		return rate, 0
+	}
+
+	// Deltas are calculated in uint32 to cope with counter wraps. A sequence number delta
+	// in the upper half of the range means the agent restarted or samples got reordered.
+	seqDelta := cur.seq - prev.seq
+	if seqDelta == 0 || seqDelta > 1<<31 {
+		return rate, 0
+	}
+
+	if cur.dropped >= prev.dropped {
+		dropped = uint64(cur.dropped - prev.dropped)
+	}
+
+	poolDelta := cur.pool - prev.pool
+	if poolDelta < seqDelta {
+		return rate, dropped
+	}
+
+	return (uint64(poolDelta) + uint64(seqDelta)/2) / uint64(seqDelta), dropped
+}
@@ -0,0 +1,56 @@
+package sfserver
+
+import (
+	"testing"
+
+	"github.com/bio-routing/tflow2/sflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplePoolTracker(t *testing.T) {
+	tests := []struct {
+		name            string
+		fsh             sflow.FlowSampleHeader
+		expectedRate    uint64
+		expectedDropped uint64
+	}{
+		{
+			name:         "First sample uses configured rate",
+			fsh:          sflow.FlowSampleHeader{SourceIDClassIndex: 1, SequenceNumber: 10, SamplePool: 10000, SamplingRate: 1000},
+			expectedRate: 1000,
+		},
+		{
+			name:         "Other source ID is tracked separately",
+			fsh:          sflow.FlowSampleHeader{SourceIDClassIndex: 2, SequenceNumber: 500, SamplePool: 4294966784, SamplingRate: 512},
+			expectedRate: 512,
+		},
+		{
+			name:         "Pool delta matches configured rate",
+			fsh:          sflow.FlowSampleHeader{SourceIDClassIndex: 1, SequenceNumber: 12, SamplePool: 12000, SamplingRate: 1000},
+			expectedRate: 1000,
+		},
+		{
+			name:            "Drops increase effective rate",
+			fsh:             sflow.FlowSampleHeader{SourceIDClassIndex: 1, SequenceNumber: 14, SamplePool: 18000, DroppedPackets: 4, SamplingRate: 1000},
+			expectedRate:    3000,
+			expectedDropped: 4,
+		},
+		{
+			name:         "Counter wrap",
+			fsh:          sflow.FlowSampleHeader{SourceIDClassIndex: 2, SequenceNumber: 501, SamplePool: 512, SamplingRate: 512},
+			expectedRate: 1024,
+		},
+		{
+			name:         "Agent restart falls back to configured rate",
+			fsh:          sflow.FlowSampleHeader{SourceIDClassIndex: 1, SequenceNumber: 1, SamplePool: 1000, SamplingRate: 1000},
+			expectedRate: 1000,
+		},
+	}
+
+	tr := newSamplePoolTracker()
+	for _, test := range tests {
+		rate, dropped := tr.update("rtr01", &test.fsh)
+		assert.Equal(t, test.expectedRate, rate, test.name)
+		assert.Equal(t, test.expectedDropped, dropped, test.name)
+	}
+}
@@ -23,10 +23,15 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
+	"github.com/bio-routing/tflow2/agents"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/convert"
+	"github.com/bio-routing/tflow2/listener"
 	"github.com/bio-routing/tflow2/netflow"
 	"github.com/bio-routing/tflow2/packet"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/ratelimit"
+	"github.com/bio-routing/tflow2/replicator"
 	"github.com/bio-routing/tflow2/sflow"
 	"github.com/bio-routing/tflow2/srcache"
 	"github.com/bio-routing/tflow2/stats"
@@ -43,56 +48,92 @@ type SflowServer struct {
 	// bgpAugment is used to decide if ASN information from netflow packets should be used
 	bgpAugment bool
 
-	// con is the UDP socket
-	conn *net.UDPConn
+	// sockets are the UDP sockets the server receives packets on
+	sockets *listener.Group
 
 	wg sync.WaitGroup
 
 	config *config.Config
 
 	sampleRateCache *srcache.SamplerateCache
+
+	// replicator copies received datagrams to downstream collectors
+	replicator *replicator.Replicator
+
+	// registry maps agent addresses to names
+	registry *agents.Registry
+
+	// limiter limits the rate of flows per agent
+	limiter *ratelimit.Limiter
+
+	// queue buffers flows passed to the annotator layer. Its channel is Output.
+	queue *queue.Queue
+
+	// samplePools is used to calculate effective sampling rates from sample pools
+	samplePools *samplePoolTracker
 }
 
 // New creates and starts a new `SflowServer` instance
-func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache) *SflowServer {
-	sfs := &SflowServer{
-		Output:          make(chan *netflow.Flow),
-		config:          config,
-		sampleRateCache: sampleRateCache,
-	}
+func New(numReaders int, config *config.Config, sampleRateCache *srcache.SamplerateCache, replicator *replicator.Replicator, registry *agents.Registry, limiter *ratelimit.Limiter) *SflowServer {
+	sfs := newServer(config, sampleRateCache, registry)
+	sfs.replicator = replicator
+	sfs.limiter = limiter
 
-	addr, err := net.ResolveUDPAddr("udp", sfs.config.Sflow.Listen)
-	if err != nil {
-		panic(fmt.Sprintf("ResolveUDPAddr: %v", err))
-	}
-
-	con, err := net.ListenUDP("udp", addr)
+	sockets, err := listener.Listen("sflow", sfs.config.Sflow, numReaders)
 	if err != nil {
 		panic(fmt.Sprintf("Listen: %v", err))
 	}
+	sfs.sockets = sockets
 
 	// Create goroutines that read netflow packet and process it
-	for i := 0; i < numReaders; i++ {
-		sfs.wg.Add(numReaders)
-		go func(num int) {
-			sfs.packetWorker(num, con)
-		}(i)
+	readers := sockets.Readers()
+	sfs.wg.Add(len(readers))
+	for i, r := range readers {
+		go func(num int, r *listener.Reader) {
+			sfs.packetWorker(num, r)
+		}(i, r)
 	}
 
 	return sfs
 }
 
+// NewOffline creates a new `SflowServer` instance that does not listen on any socket.
+// Packets are passed to it using Ingest().
+func NewOffline(config *config.Config, sampleRateCache *srcache.SamplerateCache, registry *agents.Registry) *SflowServer {
+	return newServer(config, sampleRateCache, registry)
+}
+
+func newServer(config *config.Config, sampleRateCache *srcache.SamplerateCache, registry *agents.Registry) *SflowServer {
+	q := queue.ForStage(config, "sflow")
+	return &SflowServer{
+		Output:          q.C,
+		queue:           q,
+		config:          config,
+		sampleRateCache: sampleRateCache,
+		registry:        registry,
+		samplePools:     newSamplePoolTracker(),
+	}
+}
+
 // Close closes the socket and stops the workers
 func (sfs *SflowServer) Close() {
-	sfs.conn.Close()
+	if sfs.sockets != nil {
+		sfs.sockets.Close()
+	}
 	sfs.wg.Wait()
 }
 
+// Ingest processes packet `buffer` from `agent` that was received at `ts` out of band,
+// e.g. read from a capture file
+func (sfs *SflowServer) Ingest(agent net.IP, buffer []byte, ts int64) {
+	sfs.processPacket(agent, buffer, ts)
+}
+
 // packetWorker reads netflow packet from socket and handsoff processing to processFlowSets()
-func (sfs *SflowServer) packetWorker(identity int, conn *net.UDPConn) {
+func (sfs *SflowServer) packetWorker(identity int, r *listener.Reader) {
 	buffer := make([]byte, 8960)
 	for {
-		length, remote, err := conn.ReadFromUDP(buffer)
+		length, remote, err := r.ReadFromUDP(buffer)
 		if err == io.EOF {
 			break
 		}
@@ -103,26 +144,33 @@ func (sfs *SflowServer) packetWorker(identity int, conn *net.UDPConn) {
 		atomic.AddUint64(&stats.GlobalStats.SflowPackets, 1)
 		atomic.AddUint64(&stats.GlobalStats.SflowBytes, uint64(length))
 
+		sfs.replicator.Replicate("sflow", remote, buffer[:length])
+
 		remote.IP = remote.IP.To4()
 		if remote.IP == nil {
 			glog.Errorf("Received IPv6 packet. Dropped.")
 			continue
 		}
 
-		sfs.processPacket(remote.IP, buffer[:length])
+		sfs.processPacket(remote.IP, buffer[:length], time.Now().Unix())
 	}
 	sfs.wg.Done()
 }
 
-// processPacket takes a raw sflow packet, send it to the decoder and passes the decoded packet
-func (sfs *SflowServer) processPacket(agent net.IP, buffer []byte) {
+// processPacket takes a raw sflow packet, send it to the decoder and passes the decoded packet.
+// `ts` is the time the packet was received.
+func (sfs *SflowServer) processPacket(remote net.IP, buffer []byte, ts int64) {
 	length := len(buffer)
-	p, err := sflow.Decode(buffer[:length], agent)
+	p, err := sflow.Decode(buffer[:length], remote)
 	if err != nil {
 		glog.Errorf("sflow.Decode: %v", err)
 		return
 	}
 
+	// Agents may be identified by the agent address rather than by the source address
+	agent := sfs.registry.ResolveSflowAgent(remote, p.Header.AgentAddress)
+
+	agentName := sfs.agentName(agent)
 	for _, fs := range p.FlowSamples {
 		if fs.RawPacketHeader == nil {
 			glog.Infof("Received sflow packet without raw packet header. Skipped.")
@@ -145,14 +193,19 @@ func (sfs *SflowServer) processPacket(agent net.IP, buffer []byte) {
 			continue
 		}
 
+		rate, dropped := sfs.samplePools.update(agentName, fs.FlowSampleHeader)
+		if dropped > 0 {
+			atomic.AddUint64(&stats.GetAgentStats(agentName).SflowDroppedSamples, dropped)
+		}
+
 		fl := &netflow.Flow{
 			Router:     agent,
 			IntIn:      fs.FlowSampleHeader.InputIf,
 			IntOut:     fs.FlowSampleHeader.OutputIf,
 			Size:       uint64(fs.RawPacketHeader.FlowDataLength),
 			Packets:    uint32(1),
-			Timestamp:  time.Now().Unix(),
-			Samplerate: uint64(fs.FlowSampleHeader.SamplingRate),
+			Timestamp:  ts,
+			Samplerate: rate,
 		}
 
 		// We're updating the sampleCache to allow the forntend to show current sampling rates
@@ -218,8 +271,20 @@ func (sfs *SflowServer) processPacket(agent net.IP, buffer []byte) {
 			glog.Errorf("Unknown EtherType: 0x%x", ether.EtherType)
 		}
 
-		sfs.Output <- fl
+		if !sfs.limiter.Admit(agent, fl) {
+			continue
+		}
+
+		sfs.queue.Put(fl)
+	}
+}
+
+// agentName returns the configured name of `agent` or its address if it is unknown
+func (sfs *SflowServer) agentName(agent net.IP) string {
+	if name, ok := sfs.registry.Name(agent); ok {
+		return name
 	}
+	return agent.String()
 }
 
 func getUDP(udpPtr unsafe.Pointer, length uint32, fl *netflow.Flow) error {
@@ -0,0 +1,104 @@
+// Package shedding sheds load by sampling flows when the pipeline is overloaded
+package shedding
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/bio-routing/tflow2/stats"
+	"github.com/golang/glog"
+)
+
+// Sampler samples flows at an adaptive ratio of 1:N. N is doubled while the fullest pipeline
+// queue is above the high watermark and halved while it is below the low watermark.
+type Sampler struct {
+	high     float64
+	low      float64
+	maxRatio uint64
+	ratio    uint64
+	counter  uint64
+	fill     func() float64
+}
+
+// New creates a new Sampler and starts monitoring the pipeline queues. It returns nil if load shedding is disabled.
+func New(cfg *config.Config) *Sampler {
+	if cfg.LoadShedding == nil || !cfg.LoadShedding.Enabled {
+		return nil
+	}
+
+	s := newSampler(cfg.LoadShedding)
+	go s.run(time.Duration(cfg.LoadShedding.Interval) * time.Millisecond)
+	return s
+}
+
+func newSampler(cfg *config.LoadShedding) *Sampler {
+	s := &Sampler{
+		high:     cfg.HighWatermark,
+		low:      cfg.LowWatermark,
+		maxRatio: cfg.MaxRatio,
+		ratio:    1,
+		fill:     stats.MaxQueueFill,
+	}
+	atomic.StoreUint64(&stats.GlobalStats.SheddingRatio, 1)
+	return s
+}
+
+func (s *Sampler) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.adjust()
+	}
+}
+
+// adjust adapts the sampling ratio to the current fill level of the pipeline queues
+func (s *Sampler) adjust() {
+	fill := s.fill()
+	ratio := atomic.LoadUint64(&s.ratio)
+	newRatio := ratio
+
+	switch {
+	case fill >= s.high && ratio < s.maxRatio:
+		newRatio = ratio * 2
+		if newRatio > s.maxRatio {
+			newRatio = s.maxRatio
+		}
+	case fill <= s.low && ratio > 1:
+		newRatio = ratio / 2
+	}
+
+	if newRatio == ratio {
+		return
+	}
+
+	glog.Warningf("Pipeline queues are %.0f%% full. Sampling flows at 1:%d", fill*100, newRatio)
+	atomic.StoreUint64(&s.ratio, newRatio)
+	atomic.StoreUint64(&stats.GlobalStats.SheddingRatio, newRatio)
+}
+
+// Sample checks if `fl` is to be kept. Every Nth flow is kept and its samplerate is multiplied
+// by N, so totals remain unbiased.
+func (s *Sampler) Sample(fl *netflow.Flow) bool {
+	if s == nil {
+		return true
+	}
+
+	ratio := atomic.LoadUint64(&s.ratio)
+	if ratio <= 1 {
+		return true
+	}
+
+	if atomic.AddUint64(&s.counter, 1)%ratio != 0 {
+		atomic.AddUint64(&stats.GlobalStats.ShedFlows, 1)
+		return false
+	}
+
+	if fl.Samplerate == 0 {
+		fl.Samplerate = 1
+	}
+	fl.Samplerate *= ratio
+	return true
+}
@@ -0,0 +1,77 @@
+package shedding
+
+import (
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/bio-routing/tflow2/netflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdjust(t *testing.T) {
+	s := newSampler(&config.LoadShedding{
+		HighWatermark: 0.8,
+		LowWatermark:  0.5,
+		MaxRatio:      6,
+	})
+
+	fill := 0.0
+	s.fill = func() float64 {
+		return fill
+	}
+
+	tests := []struct {
+		fill     float64
+		expected uint64
+	}{
+		{fill: 0.1, expected: 1},
+		{fill: 0.9, expected: 2},
+		{fill: 0.8, expected: 4},
+		{fill: 0.95, expected: 6},
+		{fill: 1, expected: 6},
+		{fill: 0.6, expected: 6},
+		{fill: 0.5, expected: 3},
+		{fill: 0.2, expected: 1},
+		{fill: 0, expected: 1},
+	}
+
+	for _, test := range tests {
+		fill = test.fill
+		s.adjust()
+		assert.Equalf(t, test.expected, s.ratio, "Fill %f", test.fill)
+	}
+}
+
+func TestSample(t *testing.T) {
+	s := newSampler(&config.LoadShedding{MaxRatio: 4})
+
+	// No sampling below the high watermark
+	for i := 0; i < 3; i++ {
+		fl := &netflow.Flow{Samplerate: 10}
+		assert.True(t, s.Sample(fl))
+		assert.Equal(t, uint64(10), fl.Samplerate)
+	}
+
+	s.ratio = 4
+	kept := 0
+	for i := 0; i < 100; i++ {
+		fl := &netflow.Flow{Samplerate: 10}
+		if s.Sample(fl) {
+			kept++
+			assert.Equal(t, uint64(40), fl.Samplerate)
+		}
+	}
+	assert.Equal(t, 25, kept)
+
+	// Flows without samplerate are considered unsampled
+	s.counter = 3
+	fl := &netflow.Flow{}
+	assert.True(t, s.Sample(fl))
+	assert.Equal(t, uint64(4), fl.Samplerate)
+}
+
+func TestDisabled(t *testing.T) {
+	s := New(&config.Config{LoadShedding: &config.LoadShedding{}})
+	assert.Nil(t, s)
+	assert.True(t, s.Sample(&netflow.Flow{}))
+}
@@ -9,14 +9,24 @@ import (
 
 // SamplerateCache caches information about samplerates
 type SamplerateCache struct {
-	cache map[string]uint64
-	mu    sync.RWMutex
+	cache      map[string]uint64
+	samplers   map[key]uint64
+	interfaces map[key]uint64
+	mu         sync.RWMutex
+}
+
+// key identifies a sampler or an interface of an agent
+type key struct {
+	rtr string
+	id  uint32
 }
 
 // New creates a new SamplerateCache and initializes it with values from the config
 func New(agents []config.Agent) *SamplerateCache {
 	c := &SamplerateCache{
-		cache: make(map[string]uint64),
+		cache:      make(map[string]uint64),
+		samplers:   make(map[key]uint64),
+		interfaces: make(map[key]uint64),
 	}
 
 	// Initialize cache with configured samplerates
@@ -32,7 +42,23 @@ func (s *SamplerateCache) Set(rtr net.IP, rate uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.cache[string(rtr)] = rate
+	s.cache[rtrKey(rtr)] = rate
+}
+
+// SetSampler updates the samplerate of sampler `samplerID` of agent `rtr`
+func (s *SamplerateCache) SetSampler(rtr net.IP, samplerID uint32, rate uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samplers[key{rtr: rtrKey(rtr), id: samplerID}] = rate
+}
+
+// SetInterface updates the samplerate of interface `ifIndex` of agent `rtr`
+func (s *SamplerateCache) SetInterface(rtr net.IP, ifIndex uint32, rate uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.interfaces[key{rtr: rtrKey(rtr), id: ifIndex}] = rate
 }
 
 // Get gets a cache entry
@@ -40,9 +66,52 @@ func (s *SamplerateCache) Get(rtr net.IP) uint64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if _, ok := s.cache[string(rtr)]; !ok {
+	return s.get(rtr)
+}
+
+// GetInterface gets the samplerate of interface `ifIndex` of agent `rtr`.
+// If there is none it falls back to the samplerate of the agent.
+func (s *SamplerateCache) GetInterface(rtr net.IP, ifIndex uint32) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getInterface(rtr, ifIndex)
+}
+
+// GetSampler gets the samplerate of sampler `samplerID` of agent `rtr`.
+// If there is none it falls back to the samplerate of interface `ifIndex`
+// and then to the samplerate of the agent.
+func (s *SamplerateCache) GetSampler(rtr net.IP, samplerID uint32, ifIndex uint32) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if rate, ok := s.samplers[key{rtr: rtrKey(rtr), id: samplerID}]; ok {
+		return rate
+	}
+
+	return s.getInterface(rtr, ifIndex)
+}
+
+func (s *SamplerateCache) getInterface(rtr net.IP, ifIndex uint32) uint64 {
+	if rate, ok := s.interfaces[key{rtr: rtrKey(rtr), id: ifIndex}]; ok {
+		return rate
+	}
+
+	return s.get(rtr)
+}
+
+func (s *SamplerateCache) get(rtr net.IP) uint64 {
+	if _, ok := s.cache[rtrKey(rtr)]; !ok {
 		return 1
 	}
 
-	return s.cache[string(rtr)]
+	return s.cache[rtrKey(rtr)]
+}
+
+// rtrKey normalizes `rtr` so IPv4 addresses in 4 and 16 byte representation map to the same entry
+func rtrKey(rtr net.IP) string {
+	if rtr4 := rtr.To4(); rtr4 != nil {
+		return string(rtr4)
+	}
+	return string(rtr)
 }
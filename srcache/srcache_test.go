@@ -0,0 +1,41 @@
+package srcache
+
+import (
+	"net"
+	"testing"
+
+	"github.com/bio-routing/tflow2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplerateCache(t *testing.T) {
+	assert := assert.New(t)
+
+	rtr := net.ParseIP("192.0.2.1")
+	c := New([]config.Agent{
+		{
+			Name:       "rtr01",
+			IPAddress:  "192.0.2.1",
+			SampleRate: 1000,
+		},
+	})
+
+	assert.Equal(uint64(1), c.Get(net.ParseIP("192.0.2.2")))
+	assert.Equal(uint64(1000), c.Get(rtr))
+	assert.Equal(uint64(1000), c.Get(net.IP{192, 0, 2, 1}))
+	assert.Equal(uint64(1000), c.GetInterface(rtr, 10))
+	assert.Equal(uint64(1000), c.GetSampler(rtr, 1, 10))
+
+	c.SetInterface(rtr, 10, 512)
+	assert.Equal(uint64(512), c.GetInterface(rtr, 10))
+	assert.Equal(uint64(1000), c.GetInterface(rtr, 11))
+	assert.Equal(uint64(512), c.GetSampler(rtr, 1, 10))
+
+	c.SetSampler(rtr, 1, 64)
+	c.SetSampler(rtr, 2, 4096)
+	assert.Equal(uint64(64), c.GetSampler(rtr, 1, 10))
+	assert.Equal(uint64(4096), c.GetSampler(rtr, 2, 10))
+	assert.Equal(uint64(512), c.GetSampler(rtr, 3, 10))
+	assert.Equal(uint64(1000), c.GetSampler(rtr, 3, 11))
+	assert.Equal(uint64(1), c.GetSampler(net.ParseIP("192.0.2.2"), 1, 10))
+}
@@ -15,31 +15,259 @@ package stats
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // Stats represents statistics of this program that are to be exported via /varz
 type Stats struct {
-	StartTime       int64
-	Flows4          uint64
-	Flows6          uint64
-	Queries         uint64
-	BirdCacheHits   uint64
-	BirdCacheMiss   uint64
-	FlowPackets     uint64
-	FlowBytes       uint64
-	Netflow9packets uint64
-	Netflow9bytes   uint64
-	IPFIXpackets    uint64
-	IPFIXbytes      uint64
-	SflowPackets    uint64
-	SflowBytes      uint64
+	StartTime        int64
+	Flows4           uint64
+	Flows6           uint64
+	Queries          uint64
+	BirdCacheHits    uint64
+	BirdCacheMiss    uint64
+	BirdCacheSize    uint64
+	BirdCacheEvicted uint64
+	BirdCacheFlushed uint64
+	FlowPackets      uint64
+	FlowBytes        uint64
+	Netflow9packets  uint64
+	Netflow9bytes    uint64
+	IPFIXpackets     uint64
+	IPFIXbytes       uint64
+	SflowPackets     uint64
+	SflowBytes       uint64
+	IngestFlows      uint64
+	IngestRejected   uint64
+	ExportRecords    uint64
+	ExportMessages   uint64
+	ExportDrops      uint64
+	ExportErrors     uint64
+	AgentsRegistered uint64
+	AgentsRefused    uint64
+	ShedFlows        uint64
+	SheddingRatio    uint64
 }
 
 // GlobalStats is instance of `Stats` to keep stats of this program
 var GlobalStats Stats
 
+// AgentStats represents statistics of a single agent
+type AgentStats struct {
+	SflowDroppedSamples uint64
+
+	// ThrottledFlows is the number of flows dropped because the agent exceeded its rate limit
+	ThrottledFlows uint64
+
+	// DownsampledFlows is the number of flows dropped and compensated by the samplerate of other flows
+	// because the agent exceeded its rate limit
+	DownsampledFlows uint64
+}
+
+var (
+	agentStats   = make(map[string]*AgentStats)
+	agentStatsMu sync.RWMutex
+)
+
+// SocketStats represents statistics of a single receive socket
+type SocketStats struct {
+	Collector string
+	Listen    string
+	ID        int
+
+	// Drops is the number of packets the kernel dropped because the receive buffer was full
+	Drops uint64
+}
+
+var (
+	socketStats   []*SocketStats
+	socketStatsMu sync.RWMutex
+)
+
+// NewSocketStats creates and registers statistics for socket `id` listening on `listen` for `collector`
+func NewSocketStats(collector string, listen string, id int) *SocketStats {
+	socketStatsMu.Lock()
+	defer socketStatsMu.Unlock()
+
+	s := &SocketStats{
+		Collector: collector,
+		Listen:    listen,
+		ID:        id,
+	}
+	socketStats = append(socketStats, s)
+	return s
+}
+
+// ReplicationStats represents statistics of a replication target
+type ReplicationStats struct {
+	Target  string
+	Packets uint64
+	Bytes   uint64
+
+	// Drops is the number of datagrams dropped because the queue of the target was full
+	Drops uint64
+
+	// Errors is the number of datagrams that could not be sent
+	Errors uint64
+}
+
+var (
+	replicationStats   []*ReplicationStats
+	replicationStatsMu sync.RWMutex
+)
+
+// NewReplicationStats creates and registers statistics for replication target `target`
+func NewReplicationStats(target string) *ReplicationStats {
+	replicationStatsMu.Lock()
+	defer replicationStatsMu.Unlock()
+
+	s := &ReplicationStats{
+		Target: target,
+	}
+	replicationStats = append(replicationStats, s)
+	return s
+}
+
+// QueueStats represents statistics of the queue of a pipeline stage
+type QueueStats struct {
+	Stage    string
+	Capacity int
+
+	// Drops is the number of flows dropped because the queue was full
+	Drops uint64
+
+	// Blocked is the number of times the previous stage had to wait because the queue was full
+	Blocked uint64
+
+	depth func() int
+}
+
+var (
+	queueStats   []*QueueStats
+	queueStatsMu sync.RWMutex
+)
+
+// NewQueueStats creates and registers statistics for the queue of stage `stage`.
+// `depth` returns the number of flows in the queue.
+func NewQueueStats(stage string, depth func() int, capacity int) *QueueStats {
+	queueStatsMu.Lock()
+	defer queueStatsMu.Unlock()
+
+	s := &QueueStats{
+		Stage:    stage,
+		Capacity: capacity,
+		depth:    depth,
+	}
+	queueStats = append(queueStats, s)
+	return s
+}
+
+// MaxQueueFill returns the fill level (0-1) of the fullest pipeline queue
+func MaxQueueFill() float64 {
+	queueStatsMu.RLock()
+	defer queueStatsMu.RUnlock()
+
+	max := 0.0
+	for _, s := range queueStats {
+		if s.Capacity == 0 {
+			continue
+		}
+		if fill := float64(s.depth()) / float64(s.Capacity); fill > max {
+			max = fill
+		}
+	}
+	return max
+}
+
+// AnnotatorStats represents statistics of an annotator
+type AnnotatorStats struct {
+	Annotator string
+
+	// Calls is the number of calls of the annotator
+	Calls uint64
+
+	// Errors is the number of failed calls including timeouts
+	Errors uint64
+
+	// Timeouts is the number of calls that exceeded the timeout
+	Timeouts uint64
+
+	// Bypassed is the number of flows that were not annotated because the annotator was unhealthy
+	Bypassed uint64
+
+	// LatencySum is the sum of the latencies of all calls in microseconds
+	LatencySum uint64
+
+	// CircuitOpen is 1 while the annotator is bypassed
+	CircuitOpen uint64
+}
+
+var (
+	annotatorStats   []*AnnotatorStats
+	annotatorStatsMu sync.RWMutex
+)
+
+// NewAnnotatorStats creates and registers statistics for annotator `annotator`
+func NewAnnotatorStats(annotator string) *AnnotatorStats {
+	annotatorStatsMu.Lock()
+	defer annotatorStatsMu.Unlock()
+
+	s := &AnnotatorStats{
+		Annotator: annotator,
+	}
+	annotatorStats = append(annotatorStats, s)
+	return s
+}
+
+// RuleStats represents statistics of an ingest rule
+type RuleStats struct {
+	Rule string
+
+	// Hits is the number of flows matched by the rule
+	Hits uint64
+}
+
+var (
+	ruleStats   []*RuleStats
+	ruleStatsMu sync.RWMutex
+)
+
+// NewRuleStats creates and registers statistics for rule `rule`
+func NewRuleStats(rule string) *RuleStats {
+	ruleStatsMu.Lock()
+	defer ruleStatsMu.Unlock()
+
+	s := &RuleStats{
+		Rule: rule,
+	}
+	ruleStats = append(ruleStats, s)
+	return s
+}
+
+// GetAgentStats returns the statistics of agent `name`. They are created if they do not exist yet.
+func GetAgentStats(name string) *AgentStats {
+	agentStatsMu.RLock()
+	s, ok := agentStats[name]
+	agentStatsMu.RUnlock()
+	if ok {
+		return s
+	}
+
+	agentStatsMu.Lock()
+	defer agentStatsMu.Unlock()
+
+	if s, ok := agentStats[name]; ok {
+		return s
+	}
+
+	s = &AgentStats{}
+	agentStats[name] = s
+	return s
+}
+
 // Init initilizes this module
 func Init() {
 	GlobalStats.StartTime = time.Now().Unix()
@@ -54,6 +282,9 @@ func Metrics(w http.ResponseWriter) {
 	fmt.Fprintf(w, "netflow_collector_queries %d\n", atomic.LoadUint64(&GlobalStats.Queries))
 	fmt.Fprintf(w, "netflow_collector_bird_cache_hits %d\n", atomic.LoadUint64(&GlobalStats.BirdCacheHits))
 	fmt.Fprintf(w, "netflow_collector_bird_cache_miss %d\n", atomic.LoadUint64(&GlobalStats.BirdCacheMiss))
+	fmt.Fprintf(w, "netflow_collector_bird_cache_size %d\n", atomic.LoadUint64(&GlobalStats.BirdCacheSize))
+	fmt.Fprintf(w, "netflow_collector_bird_cache_evictions %d\n", atomic.LoadUint64(&GlobalStats.BirdCacheEvicted))
+	fmt.Fprintf(w, "netflow_collector_bird_cache_invalidations %d\n", atomic.LoadUint64(&GlobalStats.BirdCacheFlushed))
 	fmt.Fprintf(w, "netflow_collector_packets %d\n", atomic.LoadUint64(&GlobalStats.FlowPackets))
 	fmt.Fprintf(w, "netflow_collector_bytes %d\n", atomic.LoadUint64(&GlobalStats.FlowBytes))
 	fmt.Fprintf(w, "netflow_collector_netflow9_packets %d\n", atomic.LoadUint64(&GlobalStats.Netflow9packets))
@@ -62,9 +293,93 @@ func Metrics(w http.ResponseWriter) {
 	fmt.Fprintf(w, "netflow_collector_ipfix_bytes %d\n", atomic.LoadUint64(&GlobalStats.IPFIXbytes))
 	fmt.Fprintf(w, "netflow_collector_sflow_packets %d\n", atomic.LoadUint64(&GlobalStats.SflowPackets))
 	fmt.Fprintf(w, "netflow_collector_sflow_bytes %d\n", atomic.LoadUint64(&GlobalStats.SflowBytes))
+	fmt.Fprintf(w, "netflow_collector_ingest_flows %d\n", atomic.LoadUint64(&GlobalStats.IngestFlows))
+	fmt.Fprintf(w, "netflow_collector_ingest_rejected %d\n", atomic.LoadUint64(&GlobalStats.IngestRejected))
+	fmt.Fprintf(w, "netflow_collector_export_records %d\n", atomic.LoadUint64(&GlobalStats.ExportRecords))
+	fmt.Fprintf(w, "netflow_collector_export_messages %d\n", atomic.LoadUint64(&GlobalStats.ExportMessages))
+	fmt.Fprintf(w, "netflow_collector_export_drops %d\n", atomic.LoadUint64(&GlobalStats.ExportDrops))
+	fmt.Fprintf(w, "netflow_collector_export_errors %d\n", atomic.LoadUint64(&GlobalStats.ExportErrors))
+	fmt.Fprintf(w, "netflow_collector_agents_registered %d\n", atomic.LoadUint64(&GlobalStats.AgentsRegistered))
+	fmt.Fprintf(w, "netflow_collector_agents_refused %d\n", atomic.LoadUint64(&GlobalStats.AgentsRefused))
+	fmt.Fprintf(w, "netflow_collector_shed_flows %d\n", atomic.LoadUint64(&GlobalStats.ShedFlows))
+	fmt.Fprintf(w, "netflow_collector_shedding_ratio %d\n", atomic.LoadUint64(&GlobalStats.SheddingRatio))
 	routerStats(w)
+	socketsStats(w)
+	replicationTargetStats(w)
+	pipelineStats(w)
+	rulesStats(w)
+	annotatorsStats(w)
 }
 
 func routerStats(w http.ResponseWriter) {
+	agentStatsMu.RLock()
+	defer agentStatsMu.RUnlock()
+
+	names := make([]string, 0, len(agentStats))
+	for name := range agentStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "netflow_collector_sflow_dropped_samples{agent=\"%s\"} %d\n", name, atomic.LoadUint64(&agentStats[name].SflowDroppedSamples))
+		fmt.Fprintf(w, "netflow_collector_throttled_flows{agent=\"%s\"} %d\n", name, atomic.LoadUint64(&agentStats[name].ThrottledFlows))
+		fmt.Fprintf(w, "netflow_collector_downsampled_flows{agent=\"%s\"} %d\n", name, atomic.LoadUint64(&agentStats[name].DownsampledFlows))
+	}
+}
+
+func socketsStats(w http.ResponseWriter) {
+	socketStatsMu.RLock()
+	defer socketStatsMu.RUnlock()
+
+	for _, s := range socketStats {
+		fmt.Fprintf(w, "netflow_collector_socket_drops{collector=\"%s\",listen=\"%s\",socket=\"%d\"} %d\n", s.Collector, s.Listen, s.ID, atomic.LoadUint64(&s.Drops))
+	}
+}
+
+func replicationTargetStats(w http.ResponseWriter) {
+	replicationStatsMu.RLock()
+	defer replicationStatsMu.RUnlock()
+
+	for _, s := range replicationStats {
+		fmt.Fprintf(w, "netflow_collector_replication_packets{target=\"%s\"} %d\n", s.Target, atomic.LoadUint64(&s.Packets))
+		fmt.Fprintf(w, "netflow_collector_replication_bytes{target=\"%s\"} %d\n", s.Target, atomic.LoadUint64(&s.Bytes))
+		fmt.Fprintf(w, "netflow_collector_replication_drops{target=\"%s\"} %d\n", s.Target, atomic.LoadUint64(&s.Drops))
+		fmt.Fprintf(w, "netflow_collector_replication_errors{target=\"%s\"} %d\n", s.Target, atomic.LoadUint64(&s.Errors))
+	}
+}
+
+func pipelineStats(w http.ResponseWriter) {
+	queueStatsMu.RLock()
+	defer queueStatsMu.RUnlock()
+
+	for _, s := range queueStats {
+		fmt.Fprintf(w, "netflow_collector_queue_depth{stage=\"%s\"} %d\n", s.Stage, s.depth())
+		fmt.Fprintf(w, "netflow_collector_queue_capacity{stage=\"%s\"} %d\n", s.Stage, s.Capacity)
+		fmt.Fprintf(w, "netflow_collector_queue_drops{stage=\"%s\"} %d\n", s.Stage, atomic.LoadUint64(&s.Drops))
+		fmt.Fprintf(w, "netflow_collector_queue_blocked{stage=\"%s\"} %d\n", s.Stage, atomic.LoadUint64(&s.Blocked))
+	}
+}
+
+func rulesStats(w http.ResponseWriter) {
+	ruleStatsMu.RLock()
+	defer ruleStatsMu.RUnlock()
+
+	for _, s := range ruleStats {
+		fmt.Fprintf(w, "netflow_collector_rule_hits{rule=\"%s\"} %d\n", s.Rule, atomic.LoadUint64(&s.Hits))
+	}
+}
+
+func annotatorsStats(w http.ResponseWriter) {
+	annotatorStatsMu.RLock()
+	defer annotatorStatsMu.RUnlock()
 
+	for _, s := range annotatorStats {
+		fmt.Fprintf(w, "netflow_collector_annotator_calls{annotator=\"%s\"} %d\n", s.Annotator, atomic.LoadUint64(&s.Calls))
+		fmt.Fprintf(w, "netflow_collector_annotator_errors{annotator=\"%s\"} %d\n", s.Annotator, atomic.LoadUint64(&s.Errors))
+		fmt.Fprintf(w, "netflow_collector_annotator_timeouts{annotator=\"%s\"} %d\n", s.Annotator, atomic.LoadUint64(&s.Timeouts))
+		fmt.Fprintf(w, "netflow_collector_annotator_bypassed{annotator=\"%s\"} %d\n", s.Annotator, atomic.LoadUint64(&s.Bypassed))
+		fmt.Fprintf(w, "netflow_collector_annotator_latency_microseconds_sum{annotator=\"%s\"} %d\n", s.Annotator, atomic.LoadUint64(&s.LatencySum))
+		fmt.Fprintf(w, "netflow_collector_annotator_circuit_open{annotator=\"%s\"} %d\n", s.Annotator, atomic.LoadUint64(&s.CircuitOpen))
+	}
 }
@@ -14,19 +14,27 @@ package main
 
 import (
 	"flag"
+	"net"
 	"runtime"
 	"sync"
 
 	"github.com/golang/glog"
+	"github.com/bio-routing/tflow2/agents"
 	"github.com/bio-routing/tflow2/annotation"
 	"github.com/bio-routing/tflow2/config"
 	"github.com/bio-routing/tflow2/database"
+	"github.com/bio-routing/tflow2/exporter"
 	"github.com/bio-routing/tflow2/frontend"
 	"github.com/bio-routing/tflow2/iana"
 	"github.com/bio-routing/tflow2/ifserver"
+	"github.com/bio-routing/tflow2/ingestserver"
 	"github.com/bio-routing/tflow2/intfmapper"
 	"github.com/bio-routing/tflow2/netflow"
 	"github.com/bio-routing/tflow2/nfserver"
+	"github.com/bio-routing/tflow2/queue"
+	"github.com/bio-routing/tflow2/ratelimit"
+	"github.com/bio-routing/tflow2/replicator"
+	"github.com/bio-routing/tflow2/rules"
 	"github.com/bio-routing/tflow2/sfserver"
 	"github.com/bio-routing/tflow2/srcache"
 	"github.com/bio-routing/tflow2/stats"
@@ -54,6 +62,18 @@ func main() {
 	// Initialize statistics module
 	stats.Init()
 
+	if cfg.Pipeline.QueueSize == 0 {
+		cfg.Pipeline.QueueSize = *channelBuffer
+	}
+
+	if flag.Arg(0) == "ingest-pcap" {
+		if err := ingestPcap(cfg, flag.Args()[1:]); err != nil {
+			glog.Exitf("Unable to ingest captures: %v", err)
+		}
+		glog.Flush()
+		return
+	}
+
 	inftMapper, err := intfmapper.New(cfg.Agents, cfg.AggregationPeriod)
 	if err != nil {
 		glog.Exitf("Unable to initialize interface mappper: %v", err)
@@ -64,28 +84,50 @@ func main() {
 	// Sample Rate Cache
 	srcache := srcache.New(cfg.Agents)
 
+	// Agent registry
+	registry, err := newRegistry(cfg, inftMapper, srcache)
+	if err != nil {
+		glog.Exitf("Unable to initialize agent registry: %v", err)
+	}
+
+	// Datagram replication to downstream collectors
+	repl, err := replicator.New(cfg)
+	if err != nil {
+		glog.Exitf("Unable to initialize replicator: %v", err)
+	}
+
+	// Per agent rate limiting shared by all collectors
+	limiter := ratelimit.New(cfg, registry)
+
 	// Netflow v9 Server
 	if *cfg.NetflowV9.Enabled {
-		nfs := nfserver.New(*sockReaders, cfg, srcache)
+		nfs := nfserver.New(*sockReaders, cfg, srcache, repl, registry, limiter)
 		chans = append(chans, nfs.Output)
 	}
 
 	// IPFIX Server
 	if *cfg.IPFIX.Enabled {
-		ifs := ifserver.New(*sockReaders, cfg, srcache)
+		ifs := ifserver.New(*sockReaders, cfg, srcache, repl, registry, limiter)
 		chans = append(chans, ifs.Output)
 	}
 
 	// sFlow Server
 	if *cfg.Sflow.Enabled {
-		sfs := sfserver.New(*sockReaders, cfg, srcache)
+		sfs := sfserver.New(*sockReaders, cfg, srcache, repl, registry, limiter)
 		chans = append(chans, sfs.Output)
 	}
 
+	// gRPC flow ingest server
+	if *cfg.Ingest.Enabled {
+		igs := ingestserver.New(cfg, registry)
+		chans = append(chans, igs.Output)
+	}
+
 	// Get IANA instance
 	iana := iana.New()
 
 	// Start the database layer
+	dbQueue := queue.ForStage(cfg, "database")
 	flowDB := database.New(
 		cfg.AggregationPeriod,
 		*cfg.CacheTime,
@@ -95,17 +137,43 @@ func main() {
 		cfg.DataDir,
 		cfg.Anonymize,
 		inftMapper,
-		cfg.AgentsNameByIP,
+		registry,
 		iana,
+		dbQueue.C,
 	)
 
+	// Annotated flows pass the ingest rules, are optionally exported as IPFIX and stored in the database
+	annotated := dbQueue
+	if cfg.Export.Enabled {
+		exp, err := exporter.New(cfg)
+		if err != nil {
+			glog.Exitf("Unable to initialize IPFIX exporter: %v", err)
+		}
+		exportQueue := queue.ForStage(cfg, "export")
+		exp.Tee(exportQueue, annotated)
+		annotated = exportQueue
+	}
+
+	ruleEngine, err := rules.New(cfg.Rules, registry)
+	if err != nil {
+		glog.Exitf("Unable to initialize rules: %v", err)
+	}
+	if ruleEngine != nil {
+		rulesQueue := queue.ForStage(cfg, "rules")
+		ruleEngine.Filter(rulesQueue, annotated, *nAggr)
+		annotated = rulesQueue
+	}
+
 	// Start the annotation layer
-	annotation.New(
+	_, err = annotation.New(
 		chans,
-		flowDB.Input,
+		annotated,
 		*nAggr,
 		cfg,
 	)
+	if err != nil {
+		glog.Exitf("Unable to initialize annotation layer: %v", err)
+	}
 
 	// Frontend
 	if *cfg.Frontend.Enabled {
@@ -113,6 +181,7 @@ func main() {
 			flowDB,
 			inftMapper,
 			iana,
+			registry,
 			cfg,
 		)
 	}
@@ -121,3 +190,19 @@ func main() {
 	wg.Add(1)
 	wg.Wait()
 }
+
+// newRegistry creates the agent registry. Automatically registered agents are
+// polled for interface names and their sample rate is added to `srcache`.
+func newRegistry(cfg *config.Config, inftMapper *intfmapper.Mapper, srcache *srcache.SamplerateCache) (*agents.Registry, error) {
+	registry, err := agents.New(cfg.Agents, cfg.AutoRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	registry.Subscribe(inftMapper.AddAgent)
+	registry.Subscribe(func(a config.Agent) {
+		srcache.Set(net.ParseIP(a.IPAddress), a.SampleRate)
+	})
+
+	return registry, nil
+}